@@ -2,18 +2,32 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
 
 	// Импортируем наши новые пакеты
 	"github.com/yerkebulanrai/securemesh/backend/internal/delivery/http"
 	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
 	"github.com/yerkebulanrai/securemesh/backend/pkg/database"
 	"github.com/yerkebulanrai/securemesh/backend/internal/delivery/ws"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/bus"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/auth"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/blob"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/crypto"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/ratelimit"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/transparency"
 )
 
 func main() {
@@ -22,14 +36,36 @@ func main() {
 		log.Println("⚠️ .env файл не найден")
 	}
 
+	// Подкоманда управления схемой: api migrate up|down [N]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
+	// Ключи подписи JWT: без них (кроме APP_ENV=dev) не стартуем
+	keyRing, err := auth.LoadKeyRing()
+	if err != nil {
+		log.Fatalf("❌ Ошибка ключей JWT: %v", err)
+	}
+	if os.Getenv("JWT_SIGNING_KEY") == "" {
+		log.Println("⚠️ JWT_SIGNING_KEY не задан, dev-режим: токены подписаны временным ключом")
+	}
+	auth.SetKeyRing(keyRing)
+
+	// Ключ подписи корней журнала прозрачности ключей
+	logKey, err := transparency.LoadSigningKey()
+	if err != nil {
+		log.Fatalf("❌ Ошибка ключа журнала ключей: %v", err)
+	}
+	if os.Getenv("KT_SIGNING_KEY") == "" {
+		log.Println("⚠️ KT_SIGNING_KEY не задан, dev-режим: корни журнала подписаны временным ключом")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// 2. БД
-	dbPool, err := database.NewPostgresDB(
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-	)
+	dbPool, err := connectDB()
 	if err != nil {
 		log.Fatalf("❌ Ошибка БД: %v", err)
 	}
@@ -42,16 +78,63 @@ func main() {
 
 	// === NEW: Инициализация слоев ===
 	userRepo := repository.NewUserRepository(dbPool)
-	authHandler := http.NewAuthHandler(userRepo)
+
+	// Имена юзеров хранятся только как HMAC с pepper; открытые имена из старых версий перехэшируем
+	usernames := usernameHasher()
+	rehashed, err := userRepo.RehashLegacyUsernames(ctx, func(username string) []string {
+		raw := usernames.Hash(username)
+		if normalized, err := crypto.NormalizeUsername(username); err == nil {
+			return []string{usernames.Hash(normalized), raw}
+		}
+		return []string{raw}
+	})
+	if err != nil {
+		log.Fatalf("❌ Ошибка перехэширования имён: %v", err)
+	}
+	if rehashed > 0 {
+		log.Printf("🔐 Перехэшировано имён пользователей: %d", rehashed)
+	}
+
+	deviceRepo := repository.NewDeviceRepository(dbPool)
+	sessionRepo := repository.NewSessionRepository(dbPool)
+	tokenRepo := repository.NewTokenRepository(dbPool)
+	challengeRepo := repository.NewChallengeRepository(dbPool)
+	ktRepo := repository.NewKTRepository(dbPool)
+	go sequenceKeyLog(ctx, ktRepo, logKey, envDuration("KT_SEQUENCE_INTERVAL", 5*time.Second))
+	preKeyHandler := http.NewPreKeyHandler(repository.NewPreKeyRepository(dbPool), deviceRepo)
 	// ================================
 
 	// === NEW: Инициализация WS Handler ===
 	msgRepo := repository.NewMessageRepository(dbPool)
-	wsHandler := ws.NewWebSocketHandler(msgRepo)
+	groupRepo := repository.NewGroupRepository(dbPool)
+	messageBus, presence, redisClient := newBus(ctx)
+	wsHandler := ws.NewWebSocketHandler(msgRepo, userRepo, tokenRepo, groupRepo, messageBus, presence, nodeID(), wsConfig())
+	if err := wsHandler.Start(ctx); err != nil {
+		log.Fatalf("❌ Ошибка подписки на шину: %v", err)
+	}
+	// Перерегистрация и смена ключей рассылают KEY_CHANGED через WebSocket
+	authHandler := http.NewAuthHandler(userRepo, deviceRepo, sessionRepo, challengeRepo, ktRepo, usernames, wsHandler, authAudience())
+	// Выход и отвязка устройства сразу закрывают его WebSocket
+	sessionHandler := http.NewSessionHandler(sessionRepo, tokenRepo, wsHandler)
+	deviceHandler := http.NewDeviceHandler(deviceRepo, wsHandler)
+	keyHandler := http.NewKeyHandler(deviceRepo, wsHandler)
+	messageHandler := http.NewMessageHandler(msgRepo)
+	presenceHandler := http.NewPresenceHandler(userRepo, msgRepo, presence)
+	groupHandler := http.NewGroupHandler(groupRepo, wsHandler)
+
+	// Вложения: зашифрованные файлы в MinIO/S3 или на диске, неиспользуемые удаляются в фоне
+	blobStore, fileStore := newBlobStore(ctx)
+	attachmentRepo := repository.NewAttachmentRepository(dbPool)
+	attachmentCfg := attachmentConfig()
+	attachmentHandler := http.NewAttachmentHandler(attachmentRepo, blobStore, attachmentCfg)
+	uploadRepo := repository.NewUploadRepository(dbPool)
+	uploadHandler := http.NewUploadHandler(uploadRepo, attachmentRepo, blobStore, attachmentCfg)
+	go collectAttachments(ctx, attachmentRepo, uploadRepo, blobStore, envDuration("ATTACHMENT_GC_INTERVAL", time.Hour))
 	// =====================================
 
 	// 3. Echo
 	e := echo.New()
+	requireAuth := http.JWTAuth(tokenRepo)
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.GET("/ws", wsHandler.Handle)
@@ -59,8 +142,101 @@ func main() {
 	// === NEW: Роуты ===
 	e.POST("/register", authHandler.Register)
 	// ==================
+	// Challenge доступен без авторизации и пишет в БД: не больше 10 подряд и 1 в секунду с одного IP
+	challengeLimit := http.RateLimit(rateLimitStore(redisClient, "challenge", 1, 10), http.ByIP)
+	e.POST("/auth/challenge", authHandler.Challenge, challengeLimit)
 	e.POST("/auth/token", authHandler.GetToken)
+	e.POST("/auth/refresh", sessionHandler.Refresh)
+	e.GET("/auth/sessions", sessionHandler.List, requireAuth)
+	e.DELETE("/auth/sessions/:id", sessionHandler.Revoke, requireAuth)
+	e.POST("/auth/logout", sessionHandler.Logout, requireAuth)
+	e.POST("/auth/logout-all", sessionHandler.LogoutAll, requireAuth)
+
+	// Администрирование — только если задан ADMIN_TOKEN
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		admin := e.Group("/admin", http.AdminAuth(adminToken))
+		admin.POST("/users/:id/logout-all", sessionHandler.AdminLogoutAll)
+	} else {
+		log.Println("⚠️ ADMIN_TOKEN не задан, /admin отключён")
+	}
 	e.GET("/keys/:id", authHandler.GetKey)
+	e.GET("/keys/:id/devices", deviceHandler.GetKeys)
+	e.GET("/keys/:id/history", keyHandler.History)
+	e.GET("/.well-known/jwks.json", http.NewJWKSHandler(keyRing).Get)
+
+	// Журнал прозрачности ключей: корни и доказательства для клиентов и аудиторов
+	ktHandler := http.NewKTHandler(ktRepo, logKey.Public().(ed25519.PublicKey))
+	e.GET("/kt/head", ktHandler.Head)
+	e.GET("/kt/consistency", ktHandler.Consistency)
+	e.GET("/kt/leaves", ktHandler.Leaves)
+
+	// Prekeys для X3DH: загрузка — своим устройством, бандл — любым авторизованным
+	keys := e.Group("/keys", requireAuth)
+	keys.PUT("/signed-prekey", preKeyHandler.SetSignedPreKey)
+	keys.POST("/prekeys", preKeyHandler.AddOneTimePreKeys)
+	keys.GET("/prekeys/count", preKeyHandler.Count)
+	// Каждый бандл расходует one-time prekey цели: ограничиваем и запрашивающего, и цель,
+	// чтобы ключи жертвы нельзя было выбрать ни с одного аккаунта, ни с нескольких
+	bundleUserLimit := http.RateLimit(rateLimitStore(redisClient, "bundle-user", 0.5, 20), http.ByUser)
+	bundleTargetLimit := http.RateLimit(rateLimitStore(redisClient, "bundle-target", 0.5, 30), http.ByParam("id"))
+	keys.GET("/:id/bundle", preKeyHandler.GetBundle, bundleUserLimit, bundleTargetLimit)
+	keys.POST("/rotate", keyHandler.Rotate)
+
+	// Мультидевайс (только с токеном устройства)
+	devices := e.Group("/devices", requireAuth)
+	devices.POST("", deviceHandler.Link)
+	devices.GET("", deviceHandler.List)
+	devices.DELETE("/:id", deviceHandler.Revoke)
+
+	// История сообщений для новых и переустановленных устройств
+	e.GET("/messages", messageHandler.History, requireAuth)
+
+	// Групповые чаты: участники, роли, системные события через WebSocket
+	groups := e.Group("/groups", requireAuth)
+	groups.POST("", groupHandler.Create)
+	groups.GET("", groupHandler.List)
+	groups.GET("/:id", groupHandler.Get)
+	groups.GET("/:id/devices", groupHandler.Devices)
+	groups.PUT("/:id", groupHandler.Update)
+	groups.POST("/:id/members", groupHandler.AddMembers)
+	groups.DELETE("/:id/members/:user_id", groupHandler.RemoveMember)
+	groups.PUT("/:id/members/:user_id/role", groupHandler.SetRole)
+	groups.POST("/:id/leave", groupHandler.Leave)
+
+	// Вложения: ссылки на загрузку и скачивание зашифрованных файлов
+	attachments := e.Group("/attachments", requireAuth)
+	attachments.POST("", attachmentHandler.Create)
+	attachments.POST("/:id/complete", attachmentHandler.Complete)
+	attachments.GET("/:id", attachmentHandler.Download)
+
+	// Докачиваемые загрузки больших вложений (tus-подобный протокол)
+	uploads := e.Group("/uploads", requireAuth)
+	uploads.POST("", uploadHandler.Create)
+	uploads.HEAD("/:id", uploadHandler.Head)
+	uploads.PATCH("/:id", uploadHandler.Patch)
+	uploads.DELETE("/:id", uploadHandler.Delete)
+	if fileStore != nil {
+		// Файловое хранилище: сами данные идут через API, доступ — по подписи в ссылке
+		blobHandler := http.NewBlobHandler(fileStore)
+		e.PUT("/blobs/:key", blobHandler.Put)
+		e.GET("/blobs/:key", blobHandler.Get)
+	}
+
+	// Регистрационная блокировка (PIN)
+	accountHandler := http.NewAccountHandler(userRepo)
+	e.PUT("/account/registration-lock", accountHandler.SetRegistrationLock, requireAuth)
+	e.DELETE("/account/registration-lock", accountHandler.RemoveRegistrationLock, requireAuth)
+
+	// Поиск по имени: не больше 10 запросов подряд и 1 в 5 секунд на юзера и втрое больше на IP.
+	// Лимит на IP не даёт обойти лимит пачкой одноразовых аккаунтов, общий Redis — репликами.
+	userHandler := http.NewUserHandler(userRepo, deviceRepo, usernames)
+	lookupUserLimit := http.RateLimit(rateLimitStore(redisClient, "lookup-user", 0.2, 10), http.ByUser)
+	lookupIPLimit := http.RateLimit(rateLimitStore(redisClient, "lookup-ip", 0.6, 30), http.ByIP)
+	e.POST("/users/lookup", userHandler.Lookup, requireAuth, lookupUserLimit, lookupIPLimit)
+
+	// Присутствие и приватность
+	e.GET("/users/:id/presence", presenceHandler.Get, requireAuth)
+	e.PUT("/settings/privacy", presenceHandler.SetPrivacy, requireAuth)
 	
 	// Тест
 	e.GET("/health", func(c echo.Context) error {
@@ -77,4 +253,411 @@ func main() {
 		port = "8080"
 	}
 	e.Logger.Fatal(e.Start(":" + port))
-}
\ No newline at end of file
+}
+
+// connectDB подключается к PostgreSQL по DB_* из окружения
+func connectDB() (*pgxpool.Pool, error) {
+	return database.NewPostgresDB(
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_PORT"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+	)
+}
+
+// runMigrate — подкоманда migrate:
+//
+//	migrate up        применить все новые миграции
+//	migrate down [N]  откатить N последних (по умолчанию одну)
+//	migrate status    показать применённые и ожидающие миграции
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal("❌ Использование: migrate up|down [N]|status")
+	}
+
+	dbPool, err := connectDB()
+	if err != nil {
+		log.Fatalf("❌ Ошибка БД: %v", err)
+	}
+	defer dbPool.Close()
+
+	migrator, err := database.NewMigrator(dbPool)
+	if err != nil {
+		log.Fatalf("❌ Ошибка миграций: %v", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("❌ Ошибка миграции: %v", err)
+		}
+		log.Printf("📦 Применено миграций: %d", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				log.Fatalf("❌ Неверное число миграций для отката: %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("❌ Ошибка отката: %v", err)
+		}
+		log.Printf("↩️ Откачено миграций: %d", reverted)
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("❌ Ошибка чтения миграций: %v", err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.AppliedAt != nil {
+				state = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			switch {
+			case st.Unknown:
+				state += " (unknown to this build)"
+			case st.Modified:
+				state += " (MODIFIED after apply)"
+			}
+			fmt.Printf("%04d  %-24s %s\n", st.Version, st.Name, state)
+		}
+
+	default:
+		log.Fatalf("❌ Неизвестная команда migrate %q, ожидается up, down или status", args[0])
+	}
+}
+
+// newBus выбирает шину между узлами: Redis, если задан REDIS_ADDR, иначе память процесса.
+// Клиент Redis (или nil) возвращается и для общих лимитов запросов.
+func newBus(ctx context.Context) (bus.Bus, bus.Presence, *redis.Client) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		log.Println("⚠️ REDIS_ADDR не задан, маршрутизация и лимиты запросов только внутри узла")
+		return bus.NewMemoryBus(), bus.NewMemoryPresence(), nil
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Fatalf("❌ Redis недоступен: %v", err)
+	}
+
+	presence := bus.NewRedisPresence(client)
+	go presence.Heartbeat(ctx, nodeID())
+
+	log.Println("✅ Успешное подключение к Redis")
+	return bus.NewRedisBus(client), presence, client
+}
+
+// rateLimitStore — хранилище лимита name: общий Redis, если он есть, иначе память узла
+func rateLimitStore(client *redis.Client, name string, limit rate.Limit, burst int) middleware.RateLimiterStore {
+	if client != nil {
+		return ratelimit.NewRedisStore(client, name, limit, burst)
+	}
+	return middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:      limit,
+		Burst:     burst,
+		ExpiresIn: 10 * time.Minute,
+	})
+}
+
+// newBlobStore выбирает хранилище вложений: S3/MinIO, если задан BLOB_S3_ENDPOINT, иначе каталог BLOB_DIR.
+// Для файлового хранилища возвращает его же вторым значением — его ссылки обслуживает сам API.
+func newBlobStore(ctx context.Context) (blob.Store, *blob.FileStore) {
+	if endpoint := os.Getenv("BLOB_S3_ENDPOINT"); endpoint != "" {
+		accessKey, secretKey := os.Getenv("BLOB_S3_ACCESS_KEY"), os.Getenv("BLOB_S3_SECRET_KEY")
+		if accessKey == "" {
+			accessKey, secretKey = os.Getenv("MINIO_ROOT_USER"), os.Getenv("MINIO_ROOT_PASSWORD")
+		}
+		bucket := os.Getenv("BLOB_S3_BUCKET")
+		if bucket == "" {
+			bucket = "attachments"
+		}
+
+		store, err := blob.NewS3Store(ctx, endpoint, accessKey, secretKey, bucket, os.Getenv("BLOB_S3_SSL") == "true")
+		if err != nil {
+			log.Fatalf("❌ Хранилище вложений недоступно: %v", err)
+		}
+		log.Printf("✅ Вложения хранятся в S3 (%s, бакет %s)", endpoint, bucket)
+		return store, nil
+	}
+
+	dir := os.Getenv("BLOB_DIR")
+	if dir == "" {
+		dir = "data/blobs"
+	}
+	baseURL := os.Getenv("BLOB_PUBLIC_URL")
+	if baseURL == "" {
+		port := os.Getenv("SERVER_PORT")
+		if port == "" {
+			port = "8080"
+		}
+		baseURL = "http://localhost:" + port
+	}
+
+	// Секрет подписи ссылок. Без него ссылки перестают действовать при перезапуске — допустимо только в dev.
+	secret := []byte(os.Getenv("BLOB_URL_SECRET"))
+	if len(secret) == 0 {
+		if os.Getenv("APP_ENV") != "dev" {
+			log.Fatalf("❌ BLOB_URL_SECRET не задан (можно не задавать только при APP_ENV=dev или с BLOB_S3_ENDPOINT)")
+		}
+		log.Println("⚠️ BLOB_URL_SECRET не задан, dev-режим: ссылки на вложения подписаны временным ключом")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+
+	store, err := blob.NewFileStore(dir, baseURL, secret)
+	if err != nil {
+		log.Fatalf("❌ Хранилище вложений недоступно: %v", err)
+	}
+	log.Printf("⚠️ Вложения хранятся на диске (%s): только для разработки и одного узла", dir)
+	return store, store
+}
+
+// attachmentConfig читает ограничения вложений из окружения
+// (ATTACHMENT_MAX_SIZE в байтах, ATTACHMENT_MAX_PENDING, ATTACHMENT_RETENTION, UPLOAD_IDLE_TIMEOUT)
+func attachmentConfig() http.AttachmentConfig {
+	cfg := http.DefaultAttachmentConfig()
+
+	if v := os.Getenv("ATTACHMENT_MAX_SIZE"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Неверный ATTACHMENT_MAX_SIZE: %q", v)
+		}
+		cfg.MaxSize = n
+	}
+
+	if v := os.Getenv("ATTACHMENT_MAX_PENDING"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Неверный ATTACHMENT_MAX_PENDING: %q", v)
+		}
+		cfg.MaxPending = n
+	}
+
+	cfg.Retention = envDuration("ATTACHMENT_RETENTION", cfg.Retention)
+	cfg.UploadIdle = envDuration("UPLOAD_IDLE_TIMEOUT", cfg.UploadIdle)
+	return cfg
+}
+
+// collectAttachments периодически удаляет вложения: истёкшие, так и не загруженные
+// и загруженные, но не прикреплённые ни к одному сообщению. Сначала объект, потом запись:
+// если удаление объекта не удалось, запись остаётся и попытка повторится.
+// Перед этим удаляются брошенные докачиваемые загрузки: пока они есть, их вложения не трогаются.
+func collectAttachments(ctx context.Context, attachmentRepo *repository.AttachmentRepository, uploadRepo *repository.UploadRepository, store blob.Store, interval time.Duration) {
+	const (
+		uploadWindow      = 24 * time.Hour // Столько ждём подтверждения загрузки
+		unreferencedGrace = 24 * time.Hour // Столько загруженное вложение может ждать отправки
+		batchSize         = 500
+	)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n := collectUploads(ctx, uploadRepo, store, batchSize); n > 0 {
+			log.Printf("🧹 Удалено брошенных загрузок: %d", n)
+		}
+
+		ids, err := attachmentRepo.Garbage(ctx, uploadWindow, unreferencedGrace, batchSize)
+		if err != nil {
+			log.Printf("❌ Сборка вложений: %v", err)
+		}
+
+		deleted := 0
+		for _, id := range ids {
+			if err := store.Delete(ctx, id); err != nil {
+				log.Printf("❌ Сборка вложений: %v", err)
+				continue
+			}
+			if err := attachmentRepo.Delete(ctx, id); err != nil {
+				log.Printf("❌ Сборка вложений: %v", err)
+				continue
+			}
+			deleted++
+		}
+		if deleted > 0 {
+			log.Printf("🧹 Удалено вложений: %d", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectUploads удаляет до limit истёкших загрузок: сначала объекты кусков, потом учёт
+func collectUploads(ctx context.Context, uploadRepo *repository.UploadRepository, store blob.Store, limit int) int {
+	ids, err := uploadRepo.Expired(ctx, limit)
+	if err != nil {
+		log.Printf("❌ Сборка загрузок: %v", err)
+		return 0
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		chunks, err := uploadRepo.Chunks(ctx, id)
+		if err != nil {
+			log.Printf("❌ Сборка загрузок: %v", err)
+			continue
+		}
+
+		failed := false
+		for _, chunk := range chunks {
+			if err := store.Delete(ctx, chunk.BlobKey); err != nil {
+				log.Printf("❌ Сборка загрузок: %v", err)
+				failed = true
+				break
+			}
+		}
+		if failed {
+			continue
+		}
+
+		if err := uploadRepo.Delete(ctx, id); err != nil {
+			log.Printf("❌ Сборка загрузок: %v", err)
+			continue
+		}
+		deleted++
+	}
+	return deleted
+}
+
+// usernameHasher — HMAC имён с секретом USERNAME_PEPPER. Pepper нельзя менять после запуска:
+// старые хэши перестанут совпадать. Без него стартуем только при APP_ENV=dev.
+func usernameHasher() *crypto.UsernameHasher {
+	pepper := os.Getenv("USERNAME_PEPPER")
+	if pepper == "" {
+		if os.Getenv("APP_ENV") != "dev" {
+			log.Fatalf("❌ USERNAME_PEPPER не задан (можно не задавать только при APP_ENV=dev)")
+		}
+		log.Println("⚠️ USERNAME_PEPPER не задан, dev-режим: используется небезопасный pepper")
+		pepper = "securemesh-dev-pepper"
+	}
+	return crypto.NewUsernameHasher([]byte(pepper))
+}
+
+// authAudience — имя сервера, к которому привязана подпись входа (AUTH_AUDIENCE).
+// Брать его из Host запроса нельзя: Host задаёт клиент. Без него стартуем только при APP_ENV=dev.
+func authAudience() string {
+	audience := os.Getenv("AUTH_AUDIENCE")
+	if audience == "" {
+		if os.Getenv("APP_ENV") != "dev" {
+			log.Fatalf("❌ AUTH_AUDIENCE не задан (можно не задавать только при APP_ENV=dev)")
+		}
+		log.Println("⚠️ AUTH_AUDIENCE не задан, dev-режим: подписи входа привязаны к securemesh-dev")
+		audience = "securemesh-dev"
+	}
+	return audience
+}
+
+// nodeID — имя узла в шине: NODE_ID или hostname (в Docker — id контейнера)
+func nodeID() string {
+	if id := os.Getenv("NODE_ID"); id != "" {
+		return id
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("❌ Не удалось определить NODE_ID: %v", err)
+	}
+	return hostname
+}
+
+// sequenceKeyLog периодически публикует новые ключи устройств в журнале прозрачности.
+// Узлов может быть несколько: журнал дописывает тот, кто взял блокировку в БД.
+func sequenceKeyLog(ctx context.Context, ktRepo *repository.KTRepository, key ed25519.PrivateKey, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var logged uint64
+	for {
+		head, err := ktRepo.Sequence(ctx, key)
+		if err != nil {
+			log.Printf("❌ Журнал ключей: %v", err)
+		} else if head.TreeSize != logged {
+			logged = head.TreeSize
+			log.Printf("🌳 Журнал ключей: %d записей", logged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// wsConfig читает настройки /ws из окружения
+// (WS_SEND_BUFFER, WS_OVERFLOW_POLICY, WS_RATE_LIMIT, WS_RATE_BURST,
+// WS_WRITE_TIMEOUT, WS_PING_INTERVAL, WS_PONG_WAIT, WS_REVALIDATE_INTERVAL)
+func wsConfig() ws.Config {
+	cfg := ws.DefaultConfig()
+
+	if v := os.Getenv("WS_SEND_BUFFER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Неверный WS_SEND_BUFFER: %q", v)
+		}
+		cfg.SendBuffer = n
+	}
+
+	if v := os.Getenv("WS_OVERFLOW_POLICY"); v != "" {
+		policy, err := ws.ParseOverflowPolicy(v)
+		if err != nil {
+			log.Fatalf("❌ Неверный WS_OVERFLOW_POLICY: %v", err)
+		}
+		cfg.Overflow = policy
+	}
+
+	if v := os.Getenv("WS_RATE_LIMIT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			log.Fatalf("❌ Неверный WS_RATE_LIMIT: %q", v)
+		}
+		cfg.RateLimit = f
+	}
+
+	if v := os.Getenv("WS_RATE_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("❌ Неверный WS_RATE_BURST: %q", v)
+		}
+		cfg.RateBurst = n
+	}
+
+	cfg.WriteTimeout = envDuration("WS_WRITE_TIMEOUT", cfg.WriteTimeout)
+	cfg.PingInterval = envDuration("WS_PING_INTERVAL", cfg.PingInterval)
+	cfg.PongWait = envDuration("WS_PONG_WAIT", cfg.PongWait)
+	cfg.RevalidateInterval = envDuration("WS_REVALIDATE_INTERVAL", cfg.RevalidateInterval)
+	if cfg.PongWait <= cfg.PingInterval {
+		log.Fatalf("❌ WS_PONG_WAIT (%s) должен быть больше WS_PING_INTERVAL (%s)", cfg.PongWait, cfg.PingInterval)
+	}
+
+	return cfg
+}
+
+// envDuration читает длительность вида "30s" из переменной окружения
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("❌ Неверный %s: %q", key, v)
+	}
+	return d
+}
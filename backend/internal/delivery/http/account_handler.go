@@ -0,0 +1,66 @@
+package http
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/crypto"
+)
+
+// Допустимая длина PIN: от короткого цифрового до производного ключа, посчитанного клиентом
+const (
+	minPINLength = 4
+	maxPINLength = 128
+)
+
+type AccountHandler struct {
+	userRepo *repository.UserRepository
+}
+
+func NewAccountHandler(userRepo *repository.UserRepository) *AccountHandler {
+	return &AccountHandler{userRepo: userRepo}
+}
+
+// ===== REGISTRATION LOCK =====
+
+type RegistrationLockRequest struct {
+	PIN string `json:"pin"`
+}
+
+// SetRegistrationLock включает регистрационную блокировку: перерегистрировать имя
+// (и заменить ключи аккаунта) можно будет, только зная PIN
+func (h *AccountHandler) SetRegistrationLock(c echo.Context) error {
+	var req RegistrationLockRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	if n := utf8.RuneCountInString(req.PIN); n < minPINLength || n > maxPINLength {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "pin: от 4 до 128 символов"})
+	}
+
+	pinHash, err := crypto.HashPIN(req.PIN)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	if err := h.userRepo.SetRegistrationLock(c.Request().Context(), currentUserID(c), pinHash); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"status": "enabled"})
+}
+
+// RemoveRegistrationLock выключает регистрационную блокировку
+func (h *AccountHandler) RemoveRegistrationLock(c echo.Context) error {
+	if err := h.userRepo.SetRegistrationLock(c.Request().Context(), currentUserID(c), ""); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"status": "disabled"})
+}
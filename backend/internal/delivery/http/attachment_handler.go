@@ -0,0 +1,168 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/blob"
+)
+
+// AttachmentConfig — ограничения вложений
+type AttachmentConfig struct {
+	MaxSize     int64         // Максимальный размер зашифрованного файла
+	MaxPending  int           // Сколько загрузок юзер может держать неподтверждёнными
+	UploadTTL   time.Duration // Сколько действует ссылка на загрузку
+	DownloadTTL time.Duration // Сколько действует ссылка на скачивание
+	Retention   time.Duration // Сколько вложение хранится после создания
+	UploadIdle  time.Duration // Сколько докачиваемая загрузка живёт без новых кусков
+}
+
+// DefaultAttachmentConfig — 100 МБ на файл, ссылки на 15 минут и час, хранение 30 дней,
+// брошенная докачиваемая загрузка удаляется через сутки
+func DefaultAttachmentConfig() AttachmentConfig {
+	return AttachmentConfig{
+		MaxSize:     100 << 20,
+		MaxPending:  20,
+		UploadTTL:   15 * time.Minute,
+		DownloadTTL: time.Hour,
+		Retention:   30 * 24 * time.Hour,
+		UploadIdle:  24 * time.Hour,
+	}
+}
+
+type AttachmentHandler struct {
+	attachmentRepo *repository.AttachmentRepository
+	store          blob.Store
+	cfg            AttachmentConfig
+}
+
+func NewAttachmentHandler(attachmentRepo *repository.AttachmentRepository, store blob.Store, cfg AttachmentConfig) *AttachmentHandler {
+	return &AttachmentHandler{attachmentRepo: attachmentRepo, store: store, cfg: cfg}
+}
+
+// ===== CREATE =====
+
+type CreateAttachmentRequest struct {
+	Size int64 `json:"size"` // Размер уже зашифрованного файла
+}
+
+// Create заводит вложение и выдаёт ссылку, по которой клиент загружает зашифрованный файл (PUT).
+// После загрузки клиент подтверждает её через POST /attachments/:id/complete.
+func (h *AttachmentHandler) Create(c echo.Context) error {
+	var req CreateAttachmentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+	if req.Size <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "size must be positive"})
+	}
+	if req.Size > h.cfg.MaxSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "attachment too large"})
+	}
+
+	ctx := c.Request().Context()
+	userID := currentUserID(c)
+
+	pending, err := h.attachmentRepo.CountPending(ctx, userID)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if pending >= h.cfg.MaxPending {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many unfinished uploads"})
+	}
+
+	attachment, err := h.attachmentRepo.Create(ctx, userID, req.Size, time.Now().Add(h.cfg.Retention))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	uploadURL, err := h.store.UploadURL(ctx, attachment.ID, attachment.Size, h.cfg.UploadTTL)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"id":                attachment.ID,
+		"upload_url":        uploadURL,
+		"upload_method":     http.MethodPut,
+		"upload_expires_at": time.Now().Add(h.cfg.UploadTTL).Unix(),
+		"expires_at":        attachment.ExpiresAt.Unix(),
+	})
+}
+
+// ===== COMPLETE =====
+
+// Complete подтверждает загрузку: размер объекта в хранилище должен совпасть с заявленным.
+// Иначе объект удаляется, а клиент начинает загрузку заново.
+func (h *AttachmentHandler) Complete(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	attachment, err := h.attachmentRepo.Get(ctx, c.Param("id"))
+	if errors.Is(err, repository.ErrAttachmentNotFound) || (err == nil && attachment.OwnerID != currentUserID(c)) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "attachment not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if attachment.UploadedAt != nil {
+		return c.JSON(http.StatusOK, map[string]string{"status": "uploaded"})
+	}
+
+	size, err := h.store.Size(ctx, attachment.ID)
+	if errors.Is(err, blob.ErrNotFound) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "attachment is not uploaded yet"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if size != attachment.Size {
+		if err := h.store.Delete(ctx, attachment.ID); err != nil {
+			c.Logger().Error(err)
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": blob.ErrSizeMismatch.Error()})
+	}
+
+	if err := h.attachmentRepo.MarkUploaded(ctx, attachment.ID); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"status": "uploaded"})
+}
+
+// ===== DOWNLOAD =====
+
+// Download выдаёт ссылку на скачивание. Доступно владельцу и тем, кто видит сообщение с вложением.
+func (h *AttachmentHandler) Download(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	attachment, err := h.attachmentRepo.Readable(ctx, c.Param("id"), currentUserID(c))
+	if errors.Is(err, repository.ErrAttachmentNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "attachment not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	downloadURL, err := h.store.DownloadURL(ctx, attachment.ID, h.cfg.DownloadTTL)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":           attachment.ID,
+		"size":         attachment.Size,
+		"download_url": downloadURL,
+		"expires_at":   time.Now().Add(h.cfg.DownloadTTL).Unix(),
+	})
+}
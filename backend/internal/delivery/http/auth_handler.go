@@ -1,8 +1,10 @@
 package http
 
 import (
-	"fmt"
+	"encoding/base64"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -13,11 +15,18 @@ import (
 )
 
 type AuthHandler struct {
-	userRepo *repository.UserRepository
+	userRepo      *repository.UserRepository
+	deviceRepo    *repository.DeviceRepository
+	sessionRepo   *repository.SessionRepository
+	challengeRepo *repository.ChallengeRepository
+	ktRepo        *repository.KTRepository
+	usernames     *crypto.UsernameHasher
+	notifier      KeyChangeNotifier // Перерегистрация меняет ключи: контакты получают KEY_CHANGED
+	audience      string            // Имя сервера, к которому привязана подпись входа (AUTH_AUDIENCE)
 }
 
-func NewAuthHandler(repo *repository.UserRepository) *AuthHandler {
-	return &AuthHandler{userRepo: repo}
+func NewAuthHandler(repo *repository.UserRepository, deviceRepo *repository.DeviceRepository, sessionRepo *repository.SessionRepository, challengeRepo *repository.ChallengeRepository, ktRepo *repository.KTRepository, usernames *crypto.UsernameHasher, notifier KeyChangeNotifier, audience string) *AuthHandler {
+	return &AuthHandler{userRepo: repo, deviceRepo: deviceRepo, sessionRepo: sessionRepo, challengeRepo: challengeRepo, ktRepo: ktRepo, usernames: usernames, notifier: notifier, audience: audience}
 }
 
 // ===== REGISTER =====
@@ -26,6 +35,10 @@ type RegisterRequest struct {
 	Username   string `json:"username"`
 	PublicKey  string `json:"public_key"`  // Curve25519 для шифрования
 	SigningKey string `json:"signing_key"` // Ed25519 для подписей
+	Signature  string `json:"signature"`   // Base64 подпись crypto.RegistrationMessage ключом signing_key
+	DeviceName string `json:"device_name"` // Необязательно, имя основного устройства
+	// PIN регистрационной блокировки: нужен, только если имя уже занято и владелец включил блокировку
+	RegistrationLock string `json:"registration_lock"`
 }
 
 func (h *AuthHandler) Register(c echo.Context) error {
@@ -36,19 +49,45 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	}
 
 	// Валидация
-	if req.Username == "" || req.PublicKey == "" || req.SigningKey == "" {
+	if req.Username == "" || req.PublicKey == "" || req.SigningKey == "" || req.Signature == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "username, public_key и signing_key обязательны",
+			"error": "username, public_key, signing_key и signature обязательны",
 		})
 	}
 
+	username, err := crypto.NormalizeUsername(req.Username)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Ключи должны быть настоящими точками кривых, а клиент — владеть приватным ключом подписи
+	identityKey, signingKey, err := decodeDeviceKeys(req.PublicKey, req.SigningKey)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	message := crypto.RegistrationMessage(username, req.PublicKey, req.SigningKey)
+	if err := crypto.VerifySignature(signingKey, []byte(message), req.Signature); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "signature: " + err.Error()})
+	}
+
+	// В БД попадает только HMAC имени, открытое имя сервер не хранит
 	user := domain.User{
-		UsernameHash:      req.Username, // TODO: Argon2 хэш
-		PublicIdentityKey: []byte(req.PublicKey),
-		PublicSigningKey:  []byte(req.SigningKey),
+		UsernameHash:      h.usernames.Hash(username),
+		PublicIdentityKey: identityKey,
+		PublicSigningKey:  signingKey,
+	}
+
+	// Ключи регистрации становятся ключами основного устройства
+	device := domain.Device{
+		Name:              req.DeviceName,
+		PublicIdentityKey: user.PublicIdentityKey,
+		PublicSigningKey:  user.PublicSigningKey,
 	}
 
-	err := h.userRepo.CreateUser(c.Request().Context(), &user)
+	err = h.userRepo.CreateUser(c.Request().Context(), &user, &device)
+	if errors.Is(err, repository.ErrUsernameTaken) {
+		return h.reRegister(c, &user, &device, req.RegistrationLock)
+	}
 	if err != nil {
 		c.Logger().Error(err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{
@@ -57,36 +96,141 @@ func (h *AuthHandler) Register(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"status":  "created",
-		"user_id": user.ID,
+		"status":    "created",
+		"user_id":   user.ID,
+		"device_id": device.ID,
+	})
+}
+
+// reRegister перерегистрирует занятое имя. Без регистрационной блокировки имя не отдаём никому,
+// с блокировкой — тому, кто знает PIN. Ключи меняются без подписи старым ключом,
+// поэтому контакты получают KEY_CHANGED с пустым proof.
+func (h *AuthHandler) reRegister(c echo.Context, user *domain.User, device *domain.Device, pin string) error {
+	ctx := c.Request().Context()
+
+	if pin == "" {
+		locked, err := h.userRepo.HasRegistrationLock(ctx, user.UsernameHash)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			c.Logger().Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		}
+		if locked {
+			return c.JSON(http.StatusLocked, map[string]string{"error": "registration lock PIN required"})
+		}
+		return c.JSON(http.StatusConflict, map[string]string{"error": "username already taken"})
+	}
+
+	lockedUntil, err := h.userRepo.ReRegister(ctx, user, device, func(pinHash string) (bool, error) {
+		return crypto.VerifyPIN(pin, pinHash)
+	})
+	switch {
+	case errors.Is(err, repository.ErrRegistrationLockNotSet), errors.Is(err, repository.ErrUserNotFound):
+		return c.JSON(http.StatusConflict, map[string]string{"error": "username already taken"})
+	case errors.Is(err, repository.ErrRegistrationLockInvalid):
+		return c.JSON(http.StatusLocked, map[string]string{"error": "invalid registration lock PIN"})
+	case errors.Is(err, repository.ErrRegistrationLocked):
+		retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many invalid PIN attempts"})
+	case err != nil:
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.notifier.NotifyKeyChanged(domain.KeyChange{
+		UserID:            user.ID,
+		DeviceID:          device.ID,
+		PublicIdentityKey: device.PublicIdentityKey,
+		PublicSigningKey:  device.PublicSigningKey,
+		CreatedAt:         device.CreatedAt,
+	})
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"status":    "reregistered",
+		"user_id":   user.ID,
+		"device_id": device.ID,
 	})
 }
 
 // ===== GET KEY =====
 
+// GetKey отдаёт ключ юзера и доказательства, что ключи его устройств опубликованы в журнале прозрачности
 func (h *AuthHandler) GetKey(c echo.Context) error {
 	userID := c.Param("id")
 	if userID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "id is required"})
 	}
 
-	key, err := h.userRepo.GetPublicKey(c.Request().Context(), userID)
+	ctx := c.Request().Context()
+	key, err := h.userRepo.GetPublicKey(ctx, userID)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	response := map[string]interface{}{
 		"user_id":    userID,
-		"public_key": key,
+		"public_key": base64.StdEncoding.EncodeToString(key),
+	}
+
+	proofs, err := inclusionProofs(ctx, h.ktRepo, userID)
+	switch {
+	case err == nil:
+		response["transparency"] = proofs
+	case errors.Is(err, repository.ErrTreeHeadNotFound):
+		// Журнал ещё пуст — ключ отдаём без доказательств
+	default:
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// ===== CHALLENGE =====
+
+type ChallengeRequest struct {
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"` // Пусто — основное устройство
+}
+
+// Challenge выдаёт одноразовый nonce для входа. Устройство подписывает
+// auth.ChallengeMessage(audience, user_id, device_id, nonce) и отправляет подпись в /auth/token.
+func (h *AuthHandler) Challenge(c echo.Context) error {
+	var req ChallengeRequest
+	if err := c.Bind(&req); err != nil || req.UserID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "user_id is required"})
+	}
+
+	deviceID, _, err := h.deviceRepo.GetSigningKey(c.Request().Context(), req.UserID, req.DeviceID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "user not found"})
+	}
+
+	nonce, err := auth.NewChallengeNonce()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "challenge generation failed"})
+	}
+
+	err = h.challengeRepo.Create(c.Request().Context(), nonce, req.UserID, deviceID, time.Now().Add(auth.ChallengeTTL))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"nonce":      nonce,
+		"device_id":  deviceID,
+		"expires_in": strconv.Itoa(int(auth.ChallengeTTL / time.Second)),
 	})
 }
 
-// ===== GET TOKEN (NEW!) =====
+// ===== GET TOKEN =====
 
 type TokenRequest struct {
 	UserID    string `json:"user_id"`
-	Timestamp int64  `json:"timestamp"` // Unix timestamp
-	Signature string `json:"signature"` // Base64 Ed25519 подпись
+	DeviceID  string `json:"device_id"` // Пусто — устройство, которому выдан nonce
+	Nonce     string `json:"nonce"`     // Из /auth/challenge
+	Signature string `json:"signature"` // Base64 Ed25519 подпись auth.ChallengeMessage
 }
 
 func (h *AuthHandler) GetToken(c echo.Context) error {
@@ -95,27 +239,28 @@ func (h *AuthHandler) GetToken(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
 	}
 
-	// 1. Проверяем timestamp (±5 минут)
-	now := time.Now().Unix()
-	diff := now - req.Timestamp
-	if diff < 0 {
-		diff = -diff
+	// 1. Забираем nonce: он одноразовый и сгорает даже при неверной подписи
+	challengeUser, deviceID, err := h.challengeRepo.Consume(c.Request().Context(), req.Nonce)
+	if errors.Is(err, repository.ErrChallengeNotFound) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "challenge expired or already used"})
 	}
-	if diff > 300 {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "timestamp expired (must be within 5 minutes)",
-		})
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if challengeUser != req.UserID || (req.DeviceID != "" && req.DeviceID != deviceID) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "challenge was issued to another device"})
 	}
 
-	// 2. Получаем signing key из БД
-	signingKey, err := h.userRepo.GetSigningKey(c.Request().Context(), req.UserID)
+	// 2. Получаем signing key устройства из БД (оно могло быть отвязано после выдачи nonce)
+	_, signingKey, err := h.deviceRepo.GetSigningKey(c.Request().Context(), req.UserID, deviceID)
 	if err != nil {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "user not found"})
 	}
 
-	// 3. Формируем сообщение для проверки подписи
-	// Подписываем: "securemesh:auth:{user_id}:{timestamp}"
-	message := fmt.Sprintf("securemesh:auth:%s:%d", req.UserID, req.Timestamp)
+	// 3. Подпись привязана к серверу, юзеру, устройству и nonce:
+	// "securemesh:auth:v2:{audience}:{user_id}:{device_id}:{nonce}"
+	message := auth.ChallengeMessage(h.audience, req.UserID, deviceID, req.Nonce)
 
 	// 4. Проверяем подпись
 	err = crypto.VerifySignature(signingKey, []byte(message), req.Signature)
@@ -124,14 +269,23 @@ func (h *AuthHandler) GetToken(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid signature"})
 	}
 
-	// 5. Генерируем JWT
-	token, err := auth.GenerateToken(req.UserID)
+	// 5. Открываем сессию с refresh-токеном
+	refreshToken, hash, err := auth.NewRefreshToken()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "token generation failed"})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"token":      token,
-		"expires_in": "900",
-	})
+	sessionID, err := h.sessionRepo.Create(c.Request().Context(), req.UserID, deviceID, hash, time.Now().Add(auth.RefreshTokenTTL))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	// 6. Генерируем JWT
+	token, err := auth.GenerateToken(req.UserID, deviceID, sessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "token generation failed"})
+	}
+
+	return c.JSON(http.StatusOK, tokenPair(token, refreshToken, deviceID, sessionID))
 }
\ No newline at end of file
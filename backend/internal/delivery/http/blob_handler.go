@@ -0,0 +1,69 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/blob"
+)
+
+// BlobHandler отдаёт и принимает объекты blob.FileStore по подписанным ссылкам.
+// Нужен только файловому хранилищу: у S3 ссылки ведут в само хранилище.
+type BlobHandler struct {
+	store *blob.FileStore
+}
+
+func NewBlobHandler(store *blob.FileStore) *BlobHandler {
+	return &BlobHandler{store: store}
+}
+
+// Put принимает объект: PUT /blobs/:key?expires=&size=&sig=
+func (h *BlobHandler) Put(c echo.Context) error {
+	size, err := h.store.Verify(http.MethodPut, c.Param("key"), c.QueryParams())
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+	if c.Request().ContentLength >= 0 && c.Request().ContentLength != size {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": blob.ErrSizeMismatch.Error()})
+	}
+
+	err = h.store.Write(c.Param("key"), c.Request().Body, size)
+	if errors.Is(err, blob.ErrSizeMismatch) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// Get отдаёт объект: GET /blobs/:key?expires=&sig=
+func (h *BlobHandler) Get(c echo.Context) error {
+	if _, err := h.store.Verify(http.MethodGet, c.Param("key"), c.QueryParams()); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	f, err := h.store.Open(c.Param("key"))
+	if errors.Is(err, blob.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	// ServeContent поддерживает Range: большие файлы можно докачивать
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	http.ServeContent(c.Response(), c.Request(), "", info.ModTime(), f)
+	return nil
+}
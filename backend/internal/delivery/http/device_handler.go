@@ -0,0 +1,173 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/crypto"
+)
+
+type DeviceHandler struct {
+	deviceRepo *repository.DeviceRepository
+	sockets    SocketCloser
+}
+
+func NewDeviceHandler(repo *repository.DeviceRepository, sockets SocketCloser) *DeviceHandler {
+	return &DeviceHandler{deviceRepo: repo, sockets: sockets}
+}
+
+// DeviceKeys — публичные ключи устройства, по которым собеседник шифрует сообщения
+type DeviceKeys struct {
+	DeviceID   string `json:"device_id"`
+	Name       string `json:"name,omitempty"`
+	PublicKey  string `json:"public_key"`
+	SigningKey string `json:"signing_key"`
+}
+
+func toDeviceKeys(d domain.Device) DeviceKeys {
+	return DeviceKeys{
+		DeviceID:   d.ID,
+		Name:       d.Name,
+		PublicKey:  base64.StdEncoding.EncodeToString(d.PublicIdentityKey),
+		SigningKey: base64.StdEncoding.EncodeToString(d.PublicSigningKey),
+	}
+}
+
+// decodeDeviceKeys проверяет пару ключей из запроса (Base64 Curve25519 и Ed25519)
+// и возвращает их байты для хранения. Ошибка начинается с имени поля — её можно отдать клиенту как есть.
+func decodeDeviceKeys(publicKeyB64, signingKeyB64 string) (identityKey, signingKey []byte, err error) {
+	identityKey, err = crypto.DecodeX25519PublicKey(publicKeyB64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("public_key: %w", err)
+	}
+	signingKey, err = crypto.DecodeEd25519PublicKey(signingKeyB64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("signing_key: %w", err)
+	}
+	return identityKey, signingKey, nil
+}
+
+// ===== LINK DEVICE =====
+
+type LinkDeviceRequest struct {
+	Name       string `json:"name"`
+	PublicKey  string `json:"public_key"`  // Curve25519 нового устройства
+	SigningKey string `json:"signing_key"` // Ed25519 нового устройства
+	Signature  string `json:"signature"`   // Base64 подпись crypto.LinkMessage ключом signing_key
+}
+
+// Link привязывает новое устройство. Вызывается с уже авторизованного устройства,
+// после чего новое устройство получает токен через /auth/token со своим device_id.
+func (h *DeviceHandler) Link(c echo.Context) error {
+	var req LinkDeviceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	if req.PublicKey == "" || req.SigningKey == "" || req.Signature == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "public_key, signing_key и signature обязательны",
+		})
+	}
+
+	// Как при регистрации: новое устройство должно владеть приватным ключом подписи,
+	// иначе к аккаунту можно привязать чужие публичные ключи
+	userID := currentUserID(c)
+	identityKey, signingKey, err := decodeDeviceKeys(req.PublicKey, req.SigningKey)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	message := crypto.LinkMessage(userID, req.PublicKey, req.SigningKey)
+	if err := crypto.VerifySignature(signingKey, []byte(message), req.Signature); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "signature: " + err.Error()})
+	}
+
+	device := domain.Device{
+		UserID:            userID,
+		Name:              req.Name,
+		PublicIdentityKey: identityKey,
+		PublicSigningKey:  signingKey,
+	}
+
+	if err := h.deviceRepo.Create(c.Request().Context(), &device); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Ошибка сохранения устройства"})
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"status":    "created",
+		"device_id": device.ID,
+	})
+}
+
+// ===== LIST MY DEVICES =====
+
+func (h *DeviceHandler) List(c echo.Context) error {
+	devices, err := h.deviceRepo.ListByUser(c.Request().Context(), currentUserID(c))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	result := make([]DeviceKeys, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, toDeviceKeys(d))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"current_device_id": currentDeviceID(c),
+		"devices":           result,
+	})
+}
+
+// ===== REVOKE DEVICE =====
+
+// Revoke отвязывает устройство; его токены перестают приниматься, а соединение закрывается сразу
+func (h *DeviceHandler) Revoke(c echo.Context) error {
+	// Соединения хранятся под каноническим id устройства: его же отзываем и отключаем
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	deviceID := id.String()
+
+	err = h.deviceRepo.Revoke(c.Request().Context(), currentUserID(c), deviceID)
+	if errors.Is(err, repository.ErrDeviceNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.sockets.DisconnectDevice(currentUserID(c), deviceID)
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// ===== GET DEVICE KEYS =====
+
+// GetKeys возвращает ключи всех активных устройств юзера — сообщение шифруется под каждое
+func (h *DeviceHandler) GetKeys(c echo.Context) error {
+	userID := c.Param("id")
+
+	devices, err := h.deviceRepo.ListByUser(c.Request().Context(), userID)
+	if err != nil || len(devices) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+
+	result := make([]DeviceKeys, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, toDeviceKeys(d))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"devices": result,
+	})
+}
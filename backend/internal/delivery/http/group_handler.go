@@ -0,0 +1,368 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+)
+
+// GroupNotifier рассылает участникам системные события группы (реализует ws.WebSocketHandler)
+type GroupNotifier interface {
+	NotifyGroupEvent(ctx context.Context, ev domain.GroupEvent) error
+}
+
+type GroupHandler struct {
+	groupRepo *repository.GroupRepository
+	notifier  GroupNotifier
+}
+
+func NewGroupHandler(groupRepo *repository.GroupRepository, notifier GroupNotifier) *GroupHandler {
+	return &GroupHandler{groupRepo: groupRepo, notifier: notifier}
+}
+
+// notify рассылает событие. Изменение уже сохранено, поэтому ошибка рассылки только логируется.
+func (h *GroupHandler) notify(c echo.Context, ev domain.GroupEvent) {
+	ev.ActorID = currentUserID(c)
+	if err := h.notifier.NotifyGroupEvent(c.Request().Context(), ev); err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// validUserIDs — все id являются UUID
+func validUserIDs(ids []string) bool {
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// memberRole возвращает роль текущего юзера в группе :id.
+// Если он не участник, ответ 404 уже отправлен и ok == false.
+func (h *GroupHandler) memberRole(c echo.Context) (role domain.GroupRole, ok bool, err error) {
+	role, err = h.groupRepo.Role(c.Request().Context(), c.Param("id"), currentUserID(c))
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		return "", false, c.JSON(http.StatusNotFound, map[string]string{"error": "group not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return "", false, c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	return role, true, nil
+}
+
+// ===== CREATE =====
+
+type CreateGroupRequest struct {
+	Metadata []byte   `json:"metadata"` // Base64, зашифровано клиентом
+	Members  []string `json:"members"`
+}
+
+// Create создаёт группу; создатель становится владельцем
+func (h *GroupHandler) Create(c echo.Context) error {
+	var req CreateGroupRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	if len(req.Metadata) > domain.MaxGroupMetadataSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "metadata too large"})
+	}
+	if !validUserIDs(req.Members) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "members must be user ids"})
+	}
+	if len(req.Members) >= domain.MaxGroupMembers {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": repository.ErrGroupFull.Error()})
+	}
+
+	group := domain.Group{Metadata: req.Metadata, CreatedBy: currentUserID(c)}
+	added, err := h.groupRepo.Create(c.Request().Context(), &group, req.Members)
+	switch {
+	case errors.Is(err, repository.ErrMemberNotFound), errors.Is(err, repository.ErrGroupFull):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.notify(c, domain.GroupEvent{
+		GroupID:  group.ID,
+		Kind:     domain.GroupCreated,
+		UserIDs:  append([]string{group.CreatedBy}, added...),
+		Metadata: group.Metadata,
+		Epoch:    group.Epoch,
+	})
+
+	return c.JSON(http.StatusCreated, group)
+}
+
+// ===== LIST / GET =====
+
+// List возвращает группы текущего юзера с его ролью в каждой
+func (h *GroupHandler) List(c echo.Context) error {
+	groups, err := h.groupRepo.ListByUser(c.Request().Context(), currentUserID(c))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"groups": groups})
+}
+
+// Get возвращает группу и её участников. Не участнику группа не видна (404).
+func (h *GroupHandler) Get(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	group, err := h.groupRepo.Get(ctx, c.Param("id"), currentUserID(c))
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "group not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	members, err := h.groupRepo.Members(ctx, group.ID)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"group":   group,
+		"members": members,
+	})
+}
+
+// GroupDevice — устройство участника, под которое шифруется ключ отправителя
+type GroupDevice struct {
+	UserID string `json:"user_id"`
+	DeviceKeys
+}
+
+// Devices возвращает текущую эпоху группы и активные устройства всех участников:
+// при смене эпохи клиент рассылает новый ключ отправителя каждому из них
+func (h *GroupHandler) Devices(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	epoch, err := h.groupRepo.Epoch(ctx, c.Param("id"), currentUserID(c))
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "group not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	devices, err := h.groupRepo.MemberDevices(ctx, c.Param("id"))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	result := make([]GroupDevice, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, GroupDevice{UserID: d.UserID, DeviceKeys: toDeviceKeys(d)})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"epoch":   epoch,
+		"devices": result,
+	})
+}
+
+// ===== UPDATE =====
+
+type UpdateGroupRequest struct {
+	Metadata []byte `json:"metadata"`
+}
+
+// Update заменяет метаданные группы (админ и выше)
+func (h *GroupHandler) Update(c echo.Context) error {
+	var req UpdateGroupRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+	if len(req.Metadata) > domain.MaxGroupMetadataSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "metadata too large"})
+	}
+
+	role, ok, err := h.memberRole(c)
+	if !ok {
+		return err
+	}
+	if !role.CanAddMembers() {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can edit the group"})
+	}
+
+	if err := h.groupRepo.UpdateMetadata(c.Request().Context(), c.Param("id"), req.Metadata); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.notify(c, domain.GroupEvent{GroupID: c.Param("id"), Kind: domain.GroupUpdated, Metadata: req.Metadata})
+	return c.JSON(http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// ===== MEMBERS =====
+
+type AddMembersRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// AddMembers добавляет участников (админ и выше). Уже состоящие пропускаются.
+func (h *GroupHandler) AddMembers(c echo.Context) error {
+	var req AddMembersRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+	if len(req.UserIDs) == 0 || len(req.UserIDs) > domain.MaxGroupMembers || !validUserIDs(req.UserIDs) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "user_ids must be a non-empty list of user ids"})
+	}
+
+	role, ok, err := h.memberRole(c)
+	if !ok {
+		return err
+	}
+	if !role.CanAddMembers() {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can add members"})
+	}
+
+	added, epoch, err := h.groupRepo.AddMembers(c.Request().Context(), c.Param("id"), currentUserID(c), req.UserIDs)
+	switch {
+	case errors.Is(err, repository.ErrMemberNotFound), errors.Is(err, repository.ErrGroupFull):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	if len(added) > 0 {
+		h.notify(c, domain.GroupEvent{GroupID: c.Param("id"), Kind: domain.GroupMembersAdded, UserIDs: added, Epoch: epoch})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"added": added})
+}
+
+// RemoveMember исключает участника: админ — обычных участников, владелец — и админов.
+// Выйти самому — POST /groups/:id/leave.
+func (h *GroupHandler) RemoveMember(c echo.Context) error {
+	ctx := c.Request().Context()
+	groupID, targetID := c.Param("id"), c.Param("user_id")
+
+	if targetID == currentUserID(c) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "use /groups/:id/leave to leave the group"})
+	}
+
+	role, ok, err := h.memberRole(c)
+	if !ok {
+		return err
+	}
+
+	targetRole, err := h.groupRepo.Role(ctx, groupID, targetID)
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "member not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if !role.CanRemove(targetRole) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "not allowed to remove this member"})
+	}
+
+	epoch, err := h.groupRepo.RemoveMember(ctx, groupID, targetID)
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "member not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.notify(c, domain.GroupEvent{
+		GroupID: groupID,
+		Kind:    domain.GroupMemberRemoved,
+		UserIDs: []string{targetID},
+		Removed: []string{targetID},
+		Epoch:   epoch,
+	})
+	return c.JSON(http.StatusOK, map[string]string{"status": "removed"})
+}
+
+type SetRoleRequest struct {
+	Role domain.GroupRole `json:"role"` // admin или member
+}
+
+// SetRole назначает или снимает админа (только владелец)
+func (h *GroupHandler) SetRole(c echo.Context) error {
+	var req SetRoleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+	if req.Role != domain.GroupRoleAdmin && req.Role != domain.GroupRoleMember {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "role must be admin or member"})
+	}
+
+	role, ok, err := h.memberRole(c)
+	if !ok {
+		return err
+	}
+	if role != domain.GroupRoleOwner {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only the owner can change roles"})
+	}
+
+	groupID, targetID := c.Param("id"), c.Param("user_id")
+	err = h.groupRepo.SetRole(c.Request().Context(), groupID, targetID, req.Role)
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "member not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.notify(c, domain.GroupEvent{
+		GroupID: groupID,
+		Kind:    domain.GroupRoleChanged,
+		UserIDs: []string{targetID},
+		Role:    req.Role,
+	})
+	return c.JSON(http.StatusOK, map[string]string{"status": "updated"})
+}
+
+// Leave — выход из группы. Если выходит владелец, роль переходит к самому давнему админу или участнику.
+func (h *GroupHandler) Leave(c echo.Context) error {
+	groupID, userID := c.Param("id"), currentUserID(c)
+
+	newOwner, epoch, err := h.groupRepo.Leave(c.Request().Context(), groupID, userID)
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "group not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.notify(c, domain.GroupEvent{
+		GroupID: groupID,
+		Kind:    domain.GroupMemberLeft,
+		UserIDs: []string{userID},
+		Removed: []string{userID},
+		Epoch:   epoch,
+	})
+	if newOwner != "" {
+		h.notify(c, domain.GroupEvent{
+			GroupID: groupID,
+			Kind:    domain.GroupRoleChanged,
+			UserIDs: []string{newOwner},
+			Role:    domain.GroupRoleOwner,
+		})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "left"})
+}
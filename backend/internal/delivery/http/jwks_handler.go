@@ -0,0 +1,23 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/auth"
+)
+
+type JWKSHandler struct {
+	keyRing *auth.KeyRing
+}
+
+func NewJWKSHandler(ring *auth.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keyRing: ring}
+}
+
+// Get отдаёт публичные ключи проверки JWT (/.well-known/jwks.json).
+// Кэш короткий: после ротации новый ключ должен появиться у проверяющих быстро.
+func (h *JWKSHandler) Get(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return c.JSON(http.StatusOK, h.keyRing.JWKS())
+}
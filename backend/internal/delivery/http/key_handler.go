@@ -0,0 +1,135 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/crypto"
+)
+
+// KeyChangeNotifier рассылает KEY_CHANGED контактам (реализует ws.WebSocketHandler)
+type KeyChangeNotifier interface {
+	NotifyKeyChanged(change domain.KeyChange)
+}
+
+type KeyHandler struct {
+	deviceRepo *repository.DeviceRepository
+	notifier   KeyChangeNotifier
+}
+
+func NewKeyHandler(deviceRepo *repository.DeviceRepository, notifier KeyChangeNotifier) *KeyHandler {
+	return &KeyHandler{deviceRepo: deviceRepo, notifier: notifier}
+}
+
+// ===== ROTATE KEYS =====
+
+type RotateKeysRequest struct {
+	PublicKey  string `json:"public_key"`  // Новый Curve25519
+	SigningKey string `json:"signing_key"` // Новый Ed25519
+	Signature  string `json:"signature"`   // Base64 подпись crypto.KeyChangeMessage старым ключом подписи
+}
+
+// Rotate меняет ключи текущего устройства. Смену подтверждает подпись старым ключом:
+// украденный JWT без приватного ключа не позволит подменить ключи.
+func (h *KeyHandler) Rotate(c echo.Context) error {
+	var req RotateKeysRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	identityKey, signingKey, err := decodeDeviceKeys(req.PublicKey, req.SigningKey)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	userID, deviceID := currentUserID(c), currentDeviceID(c)
+
+	_, oldSigningKey, err := h.deviceRepo.GetSigningKey(ctx, userID, deviceID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "device not found"})
+	}
+
+	message := crypto.KeyChangeMessage(userID, deviceID, req.PublicKey, req.SigningKey)
+	if err := crypto.VerifySignature(oldSigningKey, []byte(message), req.Signature); err != nil {
+		c.Logger().Error("Key change verification failed: ", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid signature"})
+	}
+
+	proof, _ := base64.StdEncoding.DecodeString(req.Signature)
+	change := domain.KeyChange{
+		UserID:            userID,
+		DeviceID:          deviceID,
+		PublicIdentityKey: identityKey,
+		PublicSigningKey:  signingKey,
+		Proof:             proof,
+	}
+
+	err = h.deviceRepo.RotateKeys(ctx, &change, oldSigningKey)
+	if errors.Is(err, repository.ErrStaleSigningKey) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "keys were changed concurrently, sign with the current key"})
+	}
+	if errors.Is(err, repository.ErrDeviceNotFound) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "device not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.notifier.NotifyKeyChanged(change)
+
+	// Старый signed prekey удалён: он подписан старым ключом
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":                 "rotated",
+		"signed_prekey_required": true,
+	})
+}
+
+// ===== KEY HISTORY =====
+
+type KeyHistoryEntry struct {
+	DeviceID   string `json:"device_id"`
+	PublicKey  string `json:"public_key"`
+	SigningKey string `json:"signing_key"`
+	Proof      string `json:"proof,omitempty"` // Base64 подпись предыдущим ключом устройства
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// History возвращает все ключи устройств юзера с доказательствами смены,
+// чтобы клиент мог проверить цепочку от ключа, которому он уже доверяет
+func (h *KeyHandler) History(c echo.Context) error {
+	userID := c.Param("id")
+
+	history, err := h.deviceRepo.KeyHistory(c.Request().Context(), userID)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if len(history) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+
+	result := make([]KeyHistoryEntry, 0, len(history))
+	for _, k := range history {
+		entry := KeyHistoryEntry{
+			DeviceID:   k.DeviceID,
+			PublicKey:  base64.StdEncoding.EncodeToString(k.PublicIdentityKey),
+			SigningKey: base64.StdEncoding.EncodeToString(k.PublicSigningKey),
+			CreatedAt:  k.CreatedAt.Unix(),
+		}
+		if len(k.Proof) > 0 {
+			entry.Proof = base64.StdEncoding.EncodeToString(k.Proof)
+		}
+		result = append(result, entry)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"keys":    result,
+	})
+}
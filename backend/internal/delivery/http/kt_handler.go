@@ -0,0 +1,180 @@
+package http
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/transparency"
+)
+
+// maxLeavesPerPage — сколько записей журнала отдаётся аудитору за один запрос
+const maxLeavesPerPage = 1000
+
+type KTHandler struct {
+	ktRepo *repository.KTRepository
+	logKey ed25519.PublicKey
+}
+
+func NewKTHandler(ktRepo *repository.KTRepository, logKey ed25519.PublicKey) *KTHandler {
+	return &KTHandler{ktRepo: ktRepo, logKey: logKey}
+}
+
+// treeHeadResponse — подписанный корень журнала. Байтовые поля в JSON — Base64.
+type treeHeadResponse struct {
+	TreeSize  uint64 `json:"tree_size"`
+	RootHash  []byte `json:"root_hash"`
+	Timestamp int64  `json:"timestamp"` // мс, входит в подпись
+	Signature []byte `json:"signature"`
+}
+
+func newTreeHeadResponse(head *transparency.TreeHead) treeHeadResponse {
+	return treeHeadResponse{
+		TreeSize:  head.TreeSize,
+		RootHash:  head.RootHash,
+		Timestamp: head.Timestamp.UnixMilli(),
+		Signature: head.Signature,
+	}
+}
+
+// deviceInclusion — доказательство, что текущие ключи устройства есть в журнале
+type deviceInclusion struct {
+	DeviceID  string   `json:"device_id"`
+	LeafIndex uint64   `json:"leaf_index"`
+	Epoch     uint64   `json:"epoch"`
+	Entry     []byte   `json:"entry"` // transparency.Entry, лист = SHA-256(0x00 || entry)
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// keyTransparency — поле transparency в ответе /keys/:id.
+// Устройства, которых нет в devices, ещё не попали в журнал: клиент повторяет запрос позже.
+type keyTransparency struct {
+	TreeHead treeHeadResponse  `json:"tree_head"`
+	Devices  []deviceInclusion `json:"devices"`
+}
+
+// inclusionProofs собирает доказательства включения ключей устройств юзера относительно последнего корня
+func inclusionProofs(ctx context.Context, ktRepo *repository.KTRepository, userID string) (*keyTransparency, error) {
+	head, err := ktRepo.LatestTreeHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	leaves, err := ktRepo.DeviceLeaves(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := ktRepo.Tree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &keyTransparency{TreeHead: newTreeHeadResponse(head), Devices: []deviceInclusion{}}
+	for _, leaf := range leaves {
+		// Запись добавлена после последнего корня — её подтвердит следующий
+		if leaf.Index >= head.TreeSize {
+			continue
+		}
+		path, err := tree.InclusionProof(leaf.Index, head.TreeSize)
+		if err != nil {
+			return nil, err
+		}
+		result.Devices = append(result.Devices, deviceInclusion{
+			DeviceID:  leaf.DeviceID,
+			LeafIndex: leaf.Index,
+			Epoch:     leaf.Epoch,
+			Entry:     leaf.Data,
+			AuditPath: path,
+		})
+	}
+
+	return result, nil
+}
+
+// ===== TREE HEAD =====
+
+// Head отдаёт последний подписанный корень журнала и публичный ключ, которым он подписан
+func (h *KTHandler) Head(c echo.Context) error {
+	head, err := h.ktRepo.LatestTreeHead(c.Request().Context())
+	if errors.Is(err, repository.ErrTreeHeadNotFound) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "log is not initialized yet"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tree_head": newTreeHeadResponse(head),
+		"log_key":   []byte(h.logKey),
+	})
+}
+
+// ===== CONSISTENCY =====
+
+// Consistency доказывает, что дерево размера second продолжает дерево размера first (оба — выданные корни).
+// Клиент хранит последний увиденный корень и проверяет каждый новый: так заметна подмена истории.
+func (h *KTHandler) Consistency(c echo.Context) error {
+	first, err1 := strconv.ParseUint(c.QueryParam("first"), 10, 64)
+	second, err2 := strconv.ParseUint(c.QueryParam("second"), 10, 64)
+	if err1 != nil || err2 != nil || first > second {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "first and second must be tree sizes, first <= second"})
+	}
+
+	ctx := c.Request().Context()
+	for _, size := range []uint64{first, second} {
+		_, err := h.ktRepo.TreeHead(ctx, size)
+		if errors.Is(err, repository.ErrTreeHeadNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "tree head not found"})
+		}
+		if err != nil {
+			c.Logger().Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		}
+	}
+
+	tree, err := h.ktRepo.Tree(ctx)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	proof, err := tree.ConsistencyProof(first, second)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"first":  first,
+		"second": second,
+		"proof":  proof,
+	})
+}
+
+// ===== LEAVES =====
+
+// Leaves отдаёт записи журнала [start, end) для аудиторов (не больше maxLeavesPerPage за раз)
+func (h *KTHandler) Leaves(c echo.Context) error {
+	start, err1 := strconv.ParseUint(c.QueryParam("start"), 10, 64)
+	end, err2 := strconv.ParseUint(c.QueryParam("end"), 10, 64)
+	if err1 != nil || err2 != nil || start >= end {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "start and end must be leaf indexes, start < end"})
+	}
+	if end-start > maxLeavesPerPage {
+		end = start + maxLeavesPerPage
+	}
+
+	leaves, err := h.ktRepo.Leaves(c.Request().Context(), start, end)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"leaves": leaves})
+}
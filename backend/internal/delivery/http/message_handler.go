@@ -0,0 +1,100 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// mimeProtobuf — клиент просит историю в protobuf (HistoryResponse) вместо JSON
+const mimeProtobuf = "application/x-protobuf"
+
+type MessageHandler struct {
+	msgRepo *repository.MessageRepository
+}
+
+func NewMessageHandler(repo *repository.MessageRepository) *MessageHandler {
+	return &MessageHandler{msgRepo: repo}
+}
+
+// MessageResponse — сообщение в JSON-ответе; payload остаётся шифротекстом (Base64)
+type MessageResponse struct {
+	ID             string `json:"id"`
+	Type           string `json:"type"`
+	Payload        []byte `json:"payload"`
+	SenderID       string `json:"sender_id"`
+	RecipientID    string `json:"recipient_id,omitempty"`
+	SenderDeviceID string `json:"sender_device_id,omitempty"`
+	GroupID        string `json:"group_id,omitempty"`
+	Timestamp      int64  `json:"timestamp"`
+}
+
+// ===== HISTORY =====
+
+// History отдаёт страницу истории: GET /messages?peer=&group=&cursor=&limit=
+// Ответ в JSON, либо protobuf HistoryResponse при "Accept: application/x-protobuf".
+func (h *MessageHandler) History(c echo.Context) error {
+	var before *repository.MessageCursor
+	if raw := c.QueryParam("cursor"); raw != "" {
+		cur, err := repository.DecodeCursor(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+		}
+		before = &cur
+	}
+
+	limit := 0
+	if raw := c.QueryParam("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		limit = n
+	}
+
+	messages, next, err := h.msgRepo.History(
+		c.Request().Context(),
+		currentUserID(c),
+		c.QueryParam("peer"),
+		c.QueryParam("group"),
+		before,
+		repository.HistoryLimit(limit),
+	)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), mimeProtobuf) {
+		data, err := proto.Marshal(&pb.HistoryResponse{Messages: messages, NextCursor: next})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		}
+		return c.Blob(http.StatusOK, mimeProtobuf, data)
+	}
+
+	result := make([]MessageResponse, 0, len(messages))
+	for _, m := range messages {
+		result = append(result, MessageResponse{
+			ID:             m.Id,
+			Type:           m.Type.String(),
+			Payload:        m.Payload,
+			SenderID:       m.SenderId,
+			RecipientID:    m.RecipientId,
+			SenderDeviceID: m.SenderDeviceId,
+			GroupID:        m.GroupId,
+			Timestamp:      m.Timestamp,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"messages":    result,
+		"next_cursor": next,
+	})
+}
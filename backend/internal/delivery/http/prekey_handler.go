@@ -0,0 +1,205 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/crypto"
+)
+
+// maxPreKeysPerUpload — сколько одноразовых ключей можно загрузить за раз
+const maxPreKeysPerUpload = 100
+
+type PreKeyHandler struct {
+	preKeyRepo *repository.PreKeyRepository
+	deviceRepo *repository.DeviceRepository
+}
+
+func NewPreKeyHandler(preKeyRepo *repository.PreKeyRepository, deviceRepo *repository.DeviceRepository) *PreKeyHandler {
+	return &PreKeyHandler{preKeyRepo: preKeyRepo, deviceRepo: deviceRepo}
+}
+
+// ===== UPLOAD SIGNED PREKEY =====
+
+type SignedPreKeyRequest struct {
+	KeyID     int32  `json:"key_id"`
+	PublicKey string `json:"public_key"` // Base64 Curve25519
+	Signature string `json:"signature"`  // Base64 Ed25519 подпись над байтами public_key
+}
+
+func (h *PreKeyHandler) SetSignedPreKey(c echo.Context) error {
+	var req SignedPreKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	publicKey, err := crypto.DecodeX25519PublicKey(req.PublicKey)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "public_key: " + err.Error()})
+	}
+
+	// Подпись проверяем ключом того устройства, которое загружает prekey
+	_, signingKey, err := h.deviceRepo.GetSigningKey(c.Request().Context(), currentUserID(c), currentDeviceID(c))
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "device not found"})
+	}
+
+	if err := crypto.VerifySignature(signingKey, publicKey, req.Signature); err != nil {
+		c.Logger().Error("Signed prekey verification failed: ", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid signature"})
+	}
+
+	signature, _ := base64.StdEncoding.DecodeString(req.Signature)
+	key := domain.SignedPreKey{
+		DeviceID:  currentDeviceID(c),
+		KeyID:     req.KeyID,
+		PublicKey: publicKey,
+		Signature: signature,
+	}
+
+	if err := h.preKeyRepo.SetSignedPreKey(c.Request().Context(), &key); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "ok",
+		"key_id": key.KeyID,
+	})
+}
+
+// ===== UPLOAD ONE-TIME PREKEYS =====
+
+type PreKey struct {
+	KeyID     int32  `json:"key_id"`
+	PublicKey string `json:"public_key"` // Base64 Curve25519
+}
+
+type OneTimePreKeysRequest struct {
+	PreKeys []PreKey `json:"prekeys"`
+}
+
+func (h *PreKeyHandler) AddOneTimePreKeys(c echo.Context) error {
+	var req OneTimePreKeysRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	if len(req.PreKeys) == 0 || len(req.PreKeys) > maxPreKeysPerUpload {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "prekeys: от 1 до 100 ключей за раз",
+		})
+	}
+
+	deviceID := currentDeviceID(c)
+	keys := make([]domain.OneTimePreKey, 0, len(req.PreKeys))
+	for _, k := range req.PreKeys {
+		publicKey, err := crypto.DecodeX25519PublicKey(k.PublicKey)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("prekeys[%d].public_key: %v", k.KeyID, err)})
+		}
+		keys = append(keys, domain.OneTimePreKey{DeviceID: deviceID, KeyID: k.KeyID, PublicKey: publicKey})
+	}
+
+	added, err := h.preKeyRepo.AddOneTimePreKeys(c.Request().Context(), keys)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "ok",
+		"added":  added,
+	})
+}
+
+// ===== ONE-TIME PREKEYS LEFT =====
+
+// Count — клиент периодически проверяет остаток и догружает ключи
+func (h *PreKeyHandler) Count(c echo.Context) error {
+	count, err := h.preKeyRepo.CountOneTimePreKeys(c.Request().Context(), currentDeviceID(c))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]int64{"count": count})
+}
+
+// ===== GET BUNDLE =====
+
+type SignedPreKeyResponse struct {
+	KeyID     int32  `json:"key_id"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+type PreKeyBundle struct {
+	DeviceID      string               `json:"device_id"`
+	IdentityKey   string               `json:"identity_key"`
+	SigningKey    string               `json:"signing_key"`
+	SignedPreKey  SignedPreKeyResponse `json:"signed_prekey"`
+	OneTimePreKey *PreKey              `json:"one_time_prekey,omitempty"`
+}
+
+// GetBundle возвращает X3DH-бандлы устройств юзера (или одного, если указан ?device_id=).
+// Каждый вызов забирает по одному одноразовому ключу с устройства.
+func (h *PreKeyHandler) GetBundle(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID := c.Param("id")
+	onlyDevice := c.QueryParam("device_id")
+
+	devices, err := h.deviceRepo.ListByUser(ctx, userID)
+	if err != nil || len(devices) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+
+	bundles := make([]PreKeyBundle, 0, len(devices))
+	for _, d := range devices {
+		if onlyDevice != "" && d.ID != onlyDevice {
+			continue
+		}
+
+		signed, oneTime, err := h.preKeyRepo.TakeBundle(ctx, d.ID)
+		if errors.Is(err, repository.ErrPreKeyNotFound) {
+			// Устройство ещё не загрузило ключи — сессию с ним не начать
+			continue
+		}
+		if err != nil {
+			c.Logger().Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		}
+
+		bundle := PreKeyBundle{
+			DeviceID:    d.ID,
+			IdentityKey: base64.StdEncoding.EncodeToString(d.PublicIdentityKey),
+			SigningKey:  base64.StdEncoding.EncodeToString(d.PublicSigningKey),
+			SignedPreKey: SignedPreKeyResponse{
+				KeyID:     signed.KeyID,
+				PublicKey: base64.StdEncoding.EncodeToString(signed.PublicKey),
+				Signature: base64.StdEncoding.EncodeToString(signed.Signature),
+			},
+		}
+		if oneTime != nil {
+			bundle.OneTimePreKey = &PreKey{
+				KeyID:     oneTime.KeyID,
+				PublicKey: base64.StdEncoding.EncodeToString(oneTime.PublicKey),
+			}
+		}
+		bundles = append(bundles, bundle)
+	}
+
+	if len(bundles) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "prekey bundle not available"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"devices": bundles,
+	})
+}
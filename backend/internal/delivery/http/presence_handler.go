@@ -0,0 +1,97 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/bus"
+)
+
+type PresenceHandler struct {
+	userRepo *repository.UserRepository
+	msgRepo  *repository.MessageRepository
+	presence bus.Presence
+}
+
+func NewPresenceHandler(userRepo *repository.UserRepository, msgRepo *repository.MessageRepository, presence bus.Presence) *PresenceHandler {
+	return &PresenceHandler{userRepo: userRepo, msgRepo: msgRepo, presence: presence}
+}
+
+// ===== GET PRESENCE =====
+
+// Get возвращает онлайн-статус и last seen юзера с учётом его настроек приватности
+func (h *PresenceHandler) Get(c echo.Context) error {
+	ctx := c.Request().Context()
+	targetID := c.Param("id")
+	viewerID := currentUserID(c)
+
+	visibility, lastSeen, err := h.userRepo.GetLastSeen(ctx, targetID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+
+	if viewerID != targetID {
+		isContact := false
+		if visibility == domain.LastSeenContacts {
+			isContact, err = h.msgRepo.AreContacts(ctx, targetID, viewerID)
+			if err != nil {
+				c.Logger().Error(err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+			}
+		}
+		if !visibility.Allows(isContact) {
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"user_id": targetID,
+				"visible": false,
+			})
+		}
+	}
+
+	nodes, err := h.presence.Nodes(ctx, targetID)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	result := map[string]interface{}{
+		"user_id": targetID,
+		"visible": true,
+		"online":  len(nodes) > 0,
+	}
+	if lastSeen != nil {
+		result["last_seen"] = lastSeen.Unix()
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// ===== PRIVACY SETTINGS =====
+
+type PrivacyRequest struct {
+	LastSeen domain.LastSeenVisibility `json:"last_seen"` // everyone | contacts | nobody
+}
+
+func (h *PresenceHandler) SetPrivacy(c echo.Context) error {
+	var req PrivacyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	if !req.LastSeen.Valid() {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "last_seen: everyone, contacts или nobody",
+		})
+	}
+
+	if err := h.userRepo.SetLastSeenVisibility(c.Request().Context(), currentUserID(c), req.LastSeen); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"status":    "ok",
+		"last_seen": string(req.LastSeen),
+	})
+}
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/auth"
+)
+
+// SocketCloser закрывает живые WebSocket-соединения на всех узлах (реализует ws.WebSocketHandler)
+type SocketCloser interface {
+	DisconnectUser(userID string)
+	DisconnectDevice(userID, deviceID string)
+}
+
+type SessionHandler struct {
+	sessionRepo *repository.SessionRepository
+	tokenRepo   *repository.TokenRepository
+	sockets     SocketCloser
+}
+
+func NewSessionHandler(repo *repository.SessionRepository, tokenRepo *repository.TokenRepository, sockets SocketCloser) *SessionHandler {
+	return &SessionHandler{sessionRepo: repo, tokenRepo: tokenRepo, sockets: sockets}
+}
+
+// tokenPair — ответ /auth/token и /auth/refresh
+func tokenPair(accessToken, refreshToken, deviceID, sessionID string) map[string]string {
+	return map[string]string{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"device_id":     deviceID,
+		"session_id":    sessionID,
+		"expires_in":    strconv.Itoa(int(auth.AccessTokenTTL / time.Second)),
+	}
+}
+
+// ===== REFRESH =====
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh меняет refresh-токен на новую пару токенов. Старый refresh-токен сгорает;
+// если его предъявят ещё раз, сессия будет отозвана целиком.
+func (h *SessionHandler) Refresh(c echo.Context) error {
+	var req RefreshRequest
+	if err := c.Bind(&req); err != nil || req.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "refresh_token is required"})
+	}
+
+	refreshToken, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "token generation failed"})
+	}
+
+	grant, err := h.sessionRepo.Rotate(c.Request().Context(),
+		auth.HashRefreshToken(req.RefreshToken), hash, time.Now().Add(auth.RefreshTokenTTL))
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		c.Logger().Warn("Refresh token reuse detected, session revoked")
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "refresh token reused, session revoked"})
+	}
+	if errors.Is(err, repository.ErrRefreshTokenInvalid) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid or expired refresh token"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	token, err := auth.GenerateToken(grant.UserID, grant.DeviceID, grant.SessionID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "token generation failed"})
+	}
+
+	return c.JSON(http.StatusOK, tokenPair(token, refreshToken, grant.DeviceID, grant.SessionID))
+}
+
+// ===== LIST MY SESSIONS =====
+
+func (h *SessionHandler) List(c echo.Context) error {
+	sessions, err := h.sessionRepo.ListActive(c.Request().Context(), currentUserID(c))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	if sessions == nil {
+		sessions = []domain.Session{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"current_session_id": currentSessionID(c),
+		"sessions":           sessions,
+	})
+}
+
+// ===== REVOKE SESSION =====
+
+// Revoke завершает сессию: её refresh-токен больше не обменяется,
+// выданные в ней JWT отклоняются, а WebSocket её устройства закрывается сразу.
+func (h *SessionHandler) Revoke(c echo.Context) error {
+	userID := currentUserID(c)
+	deviceID, err := h.sessionRepo.Revoke(c.Request().Context(), userID, c.Param("id"))
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "session not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.sockets.DisconnectDevice(userID, deviceID)
+	return c.JSON(http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// ===== LOGOUT =====
+
+// Logout завершает текущую сессию устройства: отзывает её JWT и refresh-токен
+// и закрывает WebSocket устройства.
+func (h *SessionHandler) Logout(c echo.Context) error {
+	ctx := c.Request().Context()
+	userID, deviceID := currentUserID(c), currentDeviceID(c)
+
+	if err := h.tokenRepo.Revoke(ctx, currentClaims(c)); err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	if sessionID := currentSessionID(c); sessionID != "" {
+		_, err := h.sessionRepo.Revoke(ctx, userID, sessionID)
+		if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			c.Logger().Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		}
+	}
+
+	h.sockets.DisconnectDevice(userID, deviceID)
+	return c.JSON(http.StatusOK, map[string]string{"status": "logged out"})
+}
+
+// ===== LOGOUT EVERYWHERE =====
+
+// LogoutAll — "выйти везде": отзывает все токены и сессии юзера и закрывает все его соединения
+func (h *SessionHandler) LogoutAll(c echo.Context) error {
+	return h.logoutAll(c, currentUserID(c))
+}
+
+// AdminLogoutAll — то же самое для чужого аккаунта (например, при компрометации), только с ADMIN_TOKEN
+func (h *SessionHandler) AdminLogoutAll(c echo.Context) error {
+	return h.logoutAll(c, c.Param("id"))
+}
+
+func (h *SessionHandler) logoutAll(c echo.Context, userID string) error {
+	err := h.tokenRepo.RevokeAll(c.Request().Context(), userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	h.sockets.DisconnectUser(userID)
+	return c.JSON(http.StatusOK, map[string]string{"status": "logged out"})
+}
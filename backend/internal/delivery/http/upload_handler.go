@@ -0,0 +1,341 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/blob"
+)
+
+const (
+	tusResumable          = "1.0.0"
+	mimeOffsetOctetStream = "application/offset+octet-stream"
+	// statusChecksumMismatch — код tus для файла, чей хэш не совпал с заявленным
+	statusChecksumMismatch = 460
+)
+
+var (
+	errChunkTooLarge  = errors.New("кусок выходит за размер загрузки")
+	errDigestMismatch = errors.New("sha256 файла не совпал с заявленным")
+)
+
+// UploadHandler — докачиваемые загрузки больших вложений через API (tus-подобный протокол):
+// POST /uploads заводит загрузку, HEAD /uploads/:id отдаёт принятое смещение,
+// PATCH /uploads/:id досылает кусок с этого смещения, DELETE /uploads/:id бросает загрузку.
+// Каждый кусок сразу сохраняется в blob-хранилище отдельным объектом, поэтому после обрыва
+// загрузку можно продолжить, в том числе через другой узел API.
+type UploadHandler struct {
+	uploadRepo     *repository.UploadRepository
+	attachmentRepo *repository.AttachmentRepository
+	store          blob.Store
+	cfg            AttachmentConfig
+}
+
+func NewUploadHandler(uploadRepo *repository.UploadRepository, attachmentRepo *repository.AttachmentRepository, store blob.Store, cfg AttachmentConfig) *UploadHandler {
+	return &UploadHandler{uploadRepo: uploadRepo, attachmentRepo: attachmentRepo, store: store, cfg: cfg}
+}
+
+func setUploadHeaders(c echo.Context, upload *domain.Upload) {
+	header := c.Response().Header()
+	header.Set("Tus-Resumable", tusResumable)
+	header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	header.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	header.Set(echo.HeaderCacheControl, "no-store")
+}
+
+// ===== CREATE =====
+
+type CreateUploadRequest struct {
+	Size   int64  `json:"size"`   // Размер уже зашифрованного файла
+	SHA256 string `json:"sha256"` // base64 хэша всего зашифрованного файла, сверяется после последнего куска
+}
+
+// Create заводит вложение и докачиваемую загрузку к нему
+func (h *UploadHandler) Create(c echo.Context) error {
+	var req CreateUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+	if req.Size <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "size must be positive"})
+	}
+	if req.Size > h.cfg.MaxSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "attachment too large"})
+	}
+	digest, err := base64.StdEncoding.DecodeString(req.SHA256)
+	if err != nil || len(digest) != sha256.Size {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "sha256 must be 32 bytes in base64"})
+	}
+
+	ctx := c.Request().Context()
+	userID := currentUserID(c)
+
+	pending, err := h.attachmentRepo.CountPending(ctx, userID)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if pending >= h.cfg.MaxPending {
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "too many unfinished uploads"})
+	}
+
+	now := time.Now()
+	upload, err := h.uploadRepo.Create(ctx, userID, req.Size, digest, now.Add(h.cfg.Retention), now.Add(h.cfg.UploadIdle))
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	setUploadHeaders(c, upload)
+	c.Response().Header().Set(echo.HeaderLocation, "/uploads/"+upload.ID)
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"id":            upload.ID,
+		"attachment_id": upload.AttachmentID,
+		"size":          upload.Size,
+		"offset":        upload.Offset,
+		"expires_at":    upload.ExpiresAt.Unix(),
+	})
+}
+
+// ===== HEAD =====
+
+// Head отдаёт принятое смещение. Завершённой или брошенной загрузки нет — 404,
+// статус вложения тогда смотрят через GET /attachments/:id.
+func (h *UploadHandler) Head(c echo.Context) error {
+	c.Response().Header().Set("Tus-Resumable", tusResumable)
+
+	upload, err := h.uploadRepo.Get(c.Request().Context(), c.Param("id"), currentUserID(c))
+	if errors.Is(err, repository.ErrUploadNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	setUploadHeaders(c, upload)
+	return c.NoContent(http.StatusOK)
+}
+
+// ===== PATCH =====
+
+// Patch принимает кусок с Upload-Offset, который должен совпасть с уже принятым.
+// При обрыве соединения сохраняется то, что успело прийти. Последний кусок собирает файл,
+// сверяет sha256 и подтверждает вложение; при несовпадении загрузка удаляется целиком (460).
+func (h *UploadHandler) Patch(c echo.Context) error {
+	c.Response().Header().Set("Tus-Resumable", tusResumable)
+
+	if c.Request().Header.Get(echo.HeaderContentType) != mimeOffsetOctetStream {
+		return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": "Content-Type must be " + mimeOffsetOctetStream})
+	}
+	offset, err := strconv.ParseInt(c.Request().Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Upload-Offset required"})
+	}
+
+	ctx := c.Request().Context()
+
+	upload, err := h.uploadRepo.Get(ctx, c.Param("id"), currentUserID(c))
+	if errors.Is(err, repository.ErrUploadNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "upload not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+	if offset != upload.Offset {
+		setUploadHeaders(c, upload)
+		return c.JSON(http.StatusConflict, map[string]string{"error": repository.ErrUploadOffsetConflict.Error()})
+	}
+
+	received, readErr, err := h.receiveChunk(c, upload)
+	switch {
+	case errors.Is(err, errChunkTooLarge):
+		setUploadHeaders(c, upload)
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	case errors.Is(err, repository.ErrUploadOffsetConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, repository.ErrTooManyUploadChunks):
+		setUploadHeaders(c, upload)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case err != nil:
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	upload.Offset += received
+	if received > 0 {
+		upload.ExpiresAt = time.Now().Add(h.cfg.UploadIdle)
+	}
+	setUploadHeaders(c, upload)
+
+	if readErr != nil {
+		// Принятое сохранено, клиент продолжит с нового смещения
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "chunk interrupted"})
+	}
+	if upload.Offset < upload.Size {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	err = h.finish(c, upload)
+	if errors.Is(err, errDigestMismatch) {
+		return c.JSON(statusChecksumMismatch, map[string]string{"error": "sha256 mismatch, upload discarded"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// receiveChunk читает тело во временный файл (не больше остатка загрузки), сохраняет его
+// в хранилище отдельным объектом и учитывает. readErr — обрыв чтения: принятая часть при этом сохраняется.
+func (h *UploadHandler) receiveChunk(c echo.Context, upload *domain.Upload) (received int64, readErr, err error) {
+	// При обрыве контекст запроса отменяется, а принятую часть всё равно нужно сохранить
+	ctx := context.WithoutCancel(c.Request().Context())
+
+	tmp, err := os.CreateTemp("", "securemesh-chunk-*")
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка приёма куска: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Читаем на байт больше остатка, чтобы заметить лишнее
+	remaining := upload.Size - upload.Offset
+	n, readErr := io.Copy(tmp, io.LimitReader(c.Request().Body, remaining+1))
+	if n > remaining {
+		return 0, nil, errChunkTooLarge
+	}
+	if n == 0 {
+		return 0, readErr, nil
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, nil, fmt.Errorf("ошибка приёма куска: %w", err)
+	}
+
+	chunk := domain.UploadChunk{Offset: upload.Offset, Size: n, BlobKey: upload.ID + "." + uuid.NewString()}
+	if err := h.store.Put(ctx, chunk.BlobKey, tmp, n); err != nil {
+		return 0, nil, err
+	}
+
+	if err := h.uploadRepo.AddChunk(ctx, upload.ID, chunk, time.Now().Add(h.cfg.UploadIdle)); err != nil {
+		if delErr := h.store.Delete(ctx, chunk.BlobKey); delErr != nil {
+			c.Logger().Errorf("не удалось удалить кусок %s: %v", chunk.BlobKey, delErr)
+		}
+		return 0, nil, err
+	}
+
+	return n, readErr, nil
+}
+
+// finish склеивает куски в объект вложения, считая sha256 по пути, и подтверждает вложение.
+// Хэш не совпал — объект и загрузка удаляются, возвращается errDigestMismatch.
+func (h *UploadHandler) finish(c echo.Context, upload *domain.Upload) error {
+	ctx := c.Request().Context()
+	chunks, err := h.uploadRepo.Chunks(ctx, upload.ID)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for _, chunk := range chunks {
+			rc, err := h.store.Get(ctx, chunk.BlobKey)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(pw, rc)
+			rc.Close()
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	hash := sha256.New()
+	err = h.store.Put(ctx, upload.AttachmentID, io.TeeReader(pr, hash), upload.Size)
+	pr.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return fmt.Errorf("ошибка сборки загрузки %s: %w", upload.ID, err)
+	}
+
+	if !bytes.Equal(hash.Sum(nil), upload.SHA256) {
+		if err := h.store.Delete(ctx, upload.AttachmentID); err != nil {
+			c.Logger().Errorf("не удалось удалить вложение %s: %v", upload.AttachmentID, err)
+		}
+		if err := h.discard(ctx, upload.ID, chunks); err != nil {
+			c.Logger().Errorf("не удалось удалить загрузку %s: %v", upload.ID, err)
+		}
+		return errDigestMismatch
+	}
+
+	if err := h.uploadRepo.Complete(ctx, upload); err != nil {
+		return err
+	}
+
+	// Учёт кусков уже удалён: если объект не удалился, он останется сиротой, поэтому пишем в лог
+	for _, chunk := range chunks {
+		if err := h.store.Delete(ctx, chunk.BlobKey); err != nil {
+			c.Logger().Errorf("не удалось удалить кусок %s: %v", chunk.BlobKey, err)
+		}
+	}
+	return nil
+}
+
+// discard удаляет объекты кусков, затем учёт загрузки
+func (h *UploadHandler) discard(ctx context.Context, uploadID string, chunks []domain.UploadChunk) error {
+	for _, chunk := range chunks {
+		if err := h.store.Delete(ctx, chunk.BlobKey); err != nil {
+			return err
+		}
+	}
+	return h.uploadRepo.Delete(ctx, uploadID)
+}
+
+// ===== DELETE =====
+
+// Delete бросает загрузку; неподтверждённое вложение уберёт сборка вложений
+func (h *UploadHandler) Delete(c echo.Context) error {
+	c.Response().Header().Set("Tus-Resumable", tusResumable)
+	ctx := c.Request().Context()
+
+	upload, err := h.uploadRepo.Get(ctx, c.Param("id"), currentUserID(c))
+	if errors.Is(err, repository.ErrUploadNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "upload not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	chunks, err := h.uploadRepo.Chunks(ctx, upload.ID)
+	if err == nil {
+		err = h.discard(ctx, upload.ID, chunks)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
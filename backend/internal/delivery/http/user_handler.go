@@ -0,0 +1,68 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/crypto"
+)
+
+type UserHandler struct {
+	userRepo   *repository.UserRepository
+	deviceRepo *repository.DeviceRepository
+	usernames  *crypto.UsernameHasher
+}
+
+func NewUserHandler(userRepo *repository.UserRepository, deviceRepo *repository.DeviceRepository, usernames *crypto.UsernameHasher) *UserHandler {
+	return &UserHandler{userRepo: userRepo, deviceRepo: deviceRepo, usernames: usernames}
+}
+
+// ===== LOOKUP BY USERNAME =====
+
+type LookupRequest struct {
+	Username string `json:"username"`
+}
+
+// Lookup находит юзера по имени и возвращает ключи его устройств.
+// Имя передаётся в теле POST, чтобы не попадать в логи запросов;
+// частота запросов ограничена (см. main), чтобы перебором нельзя было выкачать список имён.
+func (h *UserHandler) Lookup(c echo.Context) error {
+	var req LookupRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Неверный формат JSON"})
+	}
+
+	username, err := crypto.NormalizeUsername(req.Username)
+	if err != nil {
+		// Невалидное имя не может быть занято — ответ тот же, что для свободного
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+
+	ctx := c.Request().Context()
+	userID, err := h.userRepo.GetIDByUsernameHash(ctx, h.usernames.Hash(username))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	devices, err := h.deviceRepo.ListByUser(ctx, userID)
+	if err != nil {
+		c.Logger().Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	}
+
+	result := make([]DeviceKeys, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, toDeviceKeys(d))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"user_id": userID,
+		"devices": result,
+	})
+}
@@ -0,0 +1,118 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// newAckFrame собирает кадр ACK с квитанцией внутри
+func newAckFrame(ack *pb.AckPayload) ([]byte, error) {
+	payload, err := proto.Marshal(ack)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&pb.WebSocketMessage{
+		Type:      pb.WebSocketMessage_ACK,
+		Id:        uuid.NewString(),
+		Payload:   payload,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// sendServerAck сообщает устройству-отправителю, что сервер сохранил сообщение (одна галочка)
+func (h *WebSocketHandler) sendServerAck(senderID, deviceID, messageID string) {
+	data, err := newAckFrame(&pb.AckPayload{
+		MessageId: messageID,
+		Status:    pb.AckPayload_SERVER,
+	})
+	if err != nil {
+		return
+	}
+
+	h.sendToDevice(senderID, deviceID, data)
+}
+
+// handleAck обрабатывает квитанцию от устройства получателя (DELIVERED или READ):
+// фиксирует статус в БД и пересылает квитанцию отправителю сообщения.
+// ACK от других устройств отправителя только снимает сообщение с их очереди.
+func (h *WebSocketHandler) handleAck(ctx context.Context, userID, deviceID string, msg *pb.WebSocketMessage) {
+	var ack pb.AckPayload
+	if err := proto.Unmarshal(msg.Payload, &ack); err != nil || ack.MessageId == "" {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "invalid ack payload")
+		return
+	}
+
+	var (
+		senderID string
+		err      error
+	)
+	switch ack.Status {
+	case pb.AckPayload_DELIVERED:
+		senderID, err = h.msgRepo.MarkDelivered(ctx, ack.MessageId, userID, deviceID)
+	case pb.AckPayload_READ:
+		senderID, err = h.msgRepo.MarkRead(ctx, ack.MessageId, userID, deviceID)
+	default:
+		// SERVER выдаёт только сервер
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_UNAUTHORIZED, "clients cannot send SERVER acks")
+		return
+	}
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+
+	// Статус не изменился (повторный ACK) или отправитель неизвестен
+	if senderID == "" {
+		return
+	}
+
+	h.relayReceipt(senderID, &pb.AckPayload{
+		MessageId: ack.MessageId,
+		SenderId:  userID,
+		Status:    ack.Status,
+	})
+}
+
+// relayReceipt пересылает квитанцию на онлайн-устройства отправителя. В БД квитанция остаётся
+// ожидающей: каждое устройство отправителя забирает её при подключении (см. flushReceipts),
+// поэтому устройство, бывшее онлайн, может получить её повторно — статус квитанции идемпотентен.
+func (h *WebSocketHandler) relayReceipt(senderID string, ack *pb.AckPayload) {
+	data, err := newAckFrame(ack)
+	if err != nil {
+		return
+	}
+
+	h.sendToUser(senderID, data, "")
+}
+
+// flushReceipts отправляет устройству квитанции, которые накопились, пока оно было офлайн.
+// Квитанция отмечается полученной только этим устройством: остальные устройства юзера
+// получат её при своём подключении.
+func (h *WebSocketHandler) flushReceipts(ctx context.Context, userID, deviceID string, cl *client) {
+	receipts, err := h.msgRepo.GetPendingReceipts(ctx, userID, deviceID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+
+	for _, ack := range receipts {
+		data, err := newAckFrame(ack)
+		if err != nil {
+			continue
+		}
+		if !cl.push(data) {
+			log.Printf("❌ Не удалось отдать квитанции устройству %s юзера %s: соединение закрыто или не успевает", deviceID, userID)
+			return
+		}
+		if err := h.msgRepo.ClearReceipt(ctx, ack.MessageId, deviceID, ack.Status); err != nil {
+			log.Printf("❌ %v", err)
+		}
+	}
+}
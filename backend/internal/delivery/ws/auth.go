@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/yerkebulanrai/securemesh/backend/pkg/auth"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/bus"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// Коды закрытия соединения (диапазон 4000–4999 отдан приложениям).
+// На CloseTokenExpired клиент обновляет токен и переподключается,
+// на CloseTokenRevoked — заново проходит /auth/token.
+const (
+	CloseTokenExpired = 4001
+	CloseTokenRevoked = 4003
+)
+
+// authorize проверяет токен соединения: подпись, срок и список отзыва
+func (h *WebSocketHandler) authorize(ctx context.Context, token string) (*auth.Claims, error) {
+	claims, err := auth.ValidateToken(token)
+	if err != nil || claims.DeviceID == "" {
+		return nil, auth.ErrInvalidToken
+	}
+
+	revoked, err := h.tokenRepo.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, auth.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// handleAuth продлевает живое соединение: в payload кадра AUTH — новый JWT того же устройства.
+// Без этого соединение закроется с CloseTokenExpired, когда истечёт исходный токен.
+func (h *WebSocketHandler) handleAuth(ctx context.Context, userID, deviceID string, cl *client, msg *pb.WebSocketMessage) {
+	claims, err := h.authorize(ctx, string(msg.Payload))
+	if err != nil {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_UNAUTHORIZED, "invalid or expired token")
+		return
+	}
+	if claims.UserID != userID || claims.DeviceID != deviceID {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_UNAUTHORIZED, "token belongs to another device")
+		return
+	}
+
+	cl.claims.Store(claims)
+	h.sendServerAck(userID, deviceID, msg.Id)
+}
+
+// DisconnectUser закрывает все соединения юзера на всех узлах ("выйти везде")
+func (h *WebSocketHandler) DisconnectUser(userID string) {
+	h.disconnect(bus.Envelope{UserID: userID, CloseCode: CloseTokenRevoked, CloseReason: "logged out"})
+}
+
+// DisconnectDevice закрывает соединение одного устройства юзера на любом узле
+func (h *WebSocketHandler) DisconnectDevice(userID, deviceID string) {
+	h.disconnect(bus.Envelope{UserID: userID, DeviceID: deviceID, CloseCode: CloseTokenRevoked, CloseReason: "logged out"})
+}
+
+func (h *WebSocketHandler) disconnect(env bus.Envelope) {
+	h.deliverLocal(env)
+	h.publishRemote(env)
+	log.Printf("🚪 Соединения юзера %s закрыты принудительно", env.UserID)
+}
+
+// revalidateLoop периодически перепроверяет токены живых соединений:
+// истёкшие закрываются с CloseTokenExpired, отозванные — с CloseTokenRevoked.
+func (h *WebSocketHandler) revalidateLoop(ctx context.Context) {
+	if h.cfg.RevalidateInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(h.cfg.RevalidateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.revalidate(ctx)
+		}
+	}
+}
+
+func (h *WebSocketHandler) revalidate(ctx context.Context) {
+	h.mutex.Lock()
+	clients := make([]*client, 0, len(h.clients))
+	for _, devices := range h.clients {
+		for _, cl := range devices {
+			clients = append(clients, cl)
+		}
+	}
+	h.mutex.Unlock()
+
+	now := time.Now()
+	for _, cl := range clients {
+		claims := cl.claims.Load()
+		if claims == nil {
+			continue
+		}
+
+		if claims.ExpiresAt != nil && !now.Before(claims.ExpiresAt.Time) {
+			log.Printf("⌛ Токен устройства %s юзера %s истёк, соединение закрыто", claims.DeviceID, claims.UserID)
+			cl.closeWith(CloseTokenExpired, "token expired")
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, busTimeout)
+		revoked, err := h.tokenRepo.IsRevoked(checkCtx, claims)
+		cancel()
+		if err != nil {
+			// БД недоступна — не рвём соединения, проверим на следующем круге
+			log.Printf("❌ %v", err)
+			continue
+		}
+		if revoked {
+			log.Printf("🚪 Токен устройства %s юзера %s отозван, соединение закрыто", claims.DeviceID, claims.UserID)
+			cl.closeWith(CloseTokenRevoked, "token revoked")
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package ws
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+
+	"github.com/yerkebulanrai/securemesh/backend/pkg/auth"
+)
+
+// OverflowPolicy — что делать, когда очередь исходящих кадров соединения заполнена
+type OverflowPolicy int
+
+const (
+	// OverflowSpill выбрасывает кадр из живой очереди, а когда очередь разгрузится,
+	// заново отдаёт устройству его офлайн-очередь из БД
+	OverflowSpill OverflowPolicy = iota
+	// OverflowDrop молча выбрасывает кадр (сохранённые сообщения придут при переподключении)
+	OverflowDrop
+	// OverflowDisconnect закрывает медленное соединение, клиент переподключится и дочитает очередь
+	OverflowDisconnect
+)
+
+// ParseOverflowPolicy разбирает политику из конфига: spill, drop или disconnect
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch s {
+	case "spill":
+		return OverflowSpill, nil
+	case "drop":
+		return OverflowDrop, nil
+	case "disconnect":
+		return OverflowDisconnect, nil
+	default:
+		return 0, fmt.Errorf("unknown overflow policy %q (want spill, drop or disconnect)", s)
+	}
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDrop:
+		return "drop"
+	case OverflowDisconnect:
+		return "disconnect"
+	default:
+		return "spill"
+	}
+}
+
+// Config — настройки соединений /ws
+type Config struct {
+	SendBuffer   int            // Сколько исходящих кадров держим в очереди соединения
+	Overflow     OverflowPolicy // Что делать при переполнении очереди
+	WriteTimeout time.Duration  // Дедлайн на запись одного кадра
+	PingInterval time.Duration  // Как часто сервер шлёт ping
+	PongWait     time.Duration  // Сколько ждём pong (или любой кадр), прежде чем считать соединение мёртвым
+	RateLimit    float64        // Сколько кадров в секунду принимаем от соединения (0 — без ограничения)
+	RateBurst    int            // Допустимый всплеск сверх RateLimit
+
+	RevalidateInterval time.Duration // Как часто перепроверяем токены живых соединений
+}
+
+// DefaultConfig — настройки по умолчанию
+func DefaultConfig() Config {
+	return Config{
+		SendBuffer:   256,
+		Overflow:     OverflowSpill,
+		WriteTimeout: 10 * time.Second,
+		PingInterval: 30 * time.Second,
+		PongWait:     60 * time.Second,
+		RateLimit:    20,
+		RateBurst:    40,
+
+		RevalidateInterval: time.Minute,
+	}
+}
+
+// client — активное соединение устройства.
+// gorilla/websocket не допускает параллельных писателей, поэтому в сокет пишет
+// только writePump, а остальные горутины кладут кадры в ограниченную очередь send.
+type client struct {
+	conn    *websocket.Conn
+	cfg     Config
+	send    chan []byte
+	limiter *rate.Limiter // Ограничение входящих кадров
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// spilled — из-за переполнения были выброшены кадры, нужна пересинхронизация
+	spilled atomic.Bool
+	// resync заново отдаёт устройству его офлайн-очередь
+	resync func()
+
+	// Токен, которым авторизовано соединение; клиент продлевает его кадром AUTH
+	claims atomic.Pointer[auth.Claims]
+
+	// Когда последний раз переслали TYPING STARTED каждому собеседнику (только из цикла чтения)
+	typingSent map[string]time.Time
+}
+
+func newClient(conn *websocket.Conn, cfg Config) *client {
+	limit := rate.Inf
+	if cfg.RateLimit > 0 {
+		limit = rate.Limit(cfg.RateLimit)
+	}
+
+	return &client{
+		conn:    conn,
+		cfg:     cfg,
+		send:    make(chan []byte, cfg.SendBuffer),
+		limiter: rate.NewLimiter(limit, cfg.RateBurst),
+		done:    make(chan struct{}),
+
+		typingSent: make(map[string]time.Time),
+	}
+}
+
+// enqueue кладёт кадр в очередь без блокировки.
+// Если очередь заполнена, применяет политику переполнения и возвращает false.
+func (cl *client) enqueue(data []byte) bool {
+	select {
+	case <-cl.done:
+		return false
+	default:
+	}
+
+	select {
+	case cl.send <- data:
+		return true
+	default:
+	}
+
+	switch cl.cfg.Overflow {
+	case OverflowDisconnect:
+		cl.close()
+	case OverflowSpill:
+		cl.spilled.Store(true)
+	}
+	return false
+}
+
+// push кладёт кадр в очередь, дожидаясь места (но не дольше WriteTimeout).
+// Используется для выгрузки офлайн-очереди, где терять кадры нельзя.
+func (cl *client) push(data []byte) bool {
+	// Как в enqueue: при свободном месте select выбрал бы запись в очередь закрытого соединения
+	select {
+	case <-cl.done:
+		return false
+	default:
+	}
+
+	timer := time.NewTimer(cl.cfg.WriteTimeout)
+	defer timer.Stop()
+
+	select {
+	case cl.send <- data:
+		return true
+	case <-cl.done:
+		return false
+	case <-timer.C:
+		return false
+	}
+}
+
+// keepalive продлевает дедлайн чтения при каждом pong.
+// Если клиент перестал отвечать, ReadMessage в Handle вернёт таймаут и соединение будет снято.
+func (cl *client) keepalive() {
+	cl.conn.SetReadDeadline(time.Now().Add(cl.cfg.PongWait))
+	cl.conn.SetPongHandler(func(string) error {
+		return cl.conn.SetReadDeadline(time.Now().Add(cl.cfg.PongWait))
+	})
+}
+
+// writePump — единственный писатель в сокет: кадры из очереди и ping по таймеру.
+// Завершается при ошибке записи или close.
+func (cl *client) writePump() {
+	ping := time.NewTicker(cl.cfg.PingInterval)
+	defer func() {
+		ping.Stop()
+		cl.close()
+	}()
+
+	for {
+		select {
+		case <-cl.done:
+			return
+		case <-ping.C:
+			cl.conn.SetWriteDeadline(time.Now().Add(cl.cfg.WriteTimeout))
+			if err := cl.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case data := <-cl.send:
+			cl.conn.SetWriteDeadline(time.Now().Add(cl.cfg.WriteTimeout))
+			if err := cl.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				log.Printf("❌ Ошибка записи в сокет: %v", err)
+				return
+			}
+		}
+
+		// Очередь разгрузилась — дочитываем то, что выбросили при переполнении
+		if len(cl.send) == 0 && cl.resync != nil && cl.spilled.CompareAndSwap(true, false) {
+			go cl.resync()
+		}
+	}
+}
+
+// closeWith отправляет клиенту close-кадр с кодом и причиной и закрывает соединение.
+// WriteControl можно вызывать параллельно с writePump.
+func (cl *client) closeWith(code int, reason string) {
+	deadline := time.Now().Add(cl.cfg.WriteTimeout)
+	cl.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+	cl.close()
+}
+
+// close закрывает соединение; безопасно вызывать многократно и из разных горутин
+func (cl *client) close() {
+	cl.closeOnce.Do(func() {
+		close(cl.done)
+		cl.conn.Close()
+	})
+}
@@ -0,0 +1,223 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestClient поднимает настоящее WebSocket-соединение: серверная сторона — client,
+// клиентская (peer) читает то, что записал writePump
+func newTestClient(t *testing.T, cfg Config) (*client, *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	cl := newClient(<-conns, cfg)
+	t.Cleanup(cl.close)
+	return cl, peer
+}
+
+func testConfig(policy OverflowPolicy) Config {
+	cfg := DefaultConfig()
+	cfg.SendBuffer = 2
+	cfg.Overflow = policy
+	cfg.WriteTimeout = time.Second
+	cfg.PingInterval = time.Hour
+	return cfg
+}
+
+func isClosed(cl *client) bool {
+	select {
+	case <-cl.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestEnqueueOverflow(t *testing.T) {
+	tests := []struct {
+		policy      OverflowPolicy
+		wantSpilled bool
+		wantClosed  bool
+	}{
+		{OverflowSpill, true, false},
+		{OverflowDrop, false, false},
+		{OverflowDisconnect, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			cl, _ := newTestClient(t, testConfig(tt.policy))
+
+			// writePump не запущен: очередь заполняется и не разгружается
+			for _, frame := range []string{"1", "2"} {
+				if !cl.enqueue([]byte(frame)) {
+					t.Fatalf("enqueue(%q) = false with room in the queue", frame)
+				}
+			}
+			if cl.spilled.Load() || isClosed(cl) {
+				t.Fatal("overflow policy applied before the queue was full")
+			}
+
+			if cl.enqueue([]byte("3")) {
+				t.Error("enqueue() = true with a full queue")
+			}
+			if got := cl.spilled.Load(); got != tt.wantSpilled {
+				t.Errorf("spilled = %v, want %v", got, tt.wantSpilled)
+			}
+			if got := isClosed(cl); got != tt.wantClosed {
+				t.Errorf("closed = %v, want %v", got, tt.wantClosed)
+			}
+			if len(cl.send) != 2 {
+				t.Errorf("queue holds %d frames, want 2: queued frames must not be replaced", len(cl.send))
+			}
+		})
+	}
+}
+
+func TestEnqueueAfterClose(t *testing.T) {
+	cl, _ := newTestClient(t, testConfig(OverflowSpill))
+	cl.close()
+
+	if cl.enqueue([]byte("1")) {
+		t.Error("enqueue() = true on a closed connection")
+	}
+	if cl.push([]byte("1")) {
+		t.Error("push() = true on a closed connection")
+	}
+}
+
+// push ждёт места в очереди не дольше WriteTimeout
+func TestPushTimesOutOnFullQueue(t *testing.T) {
+	cfg := testConfig(OverflowSpill)
+	cfg.WriteTimeout = 50 * time.Millisecond
+	cl, _ := newTestClient(t, cfg)
+
+	for _, frame := range []string{"1", "2"} {
+		if !cl.push([]byte(frame)) {
+			t.Fatalf("push(%q) = false with room in the queue", frame)
+		}
+	}
+
+	start := time.Now()
+	if cl.push([]byte("3")) {
+		t.Error("push() = true with a full queue and no writer")
+	}
+	if elapsed := time.Since(start); elapsed < cfg.WriteTimeout {
+		t.Errorf("push() gave up after %v, want at least %v", elapsed, cfg.WriteTimeout)
+	}
+	if isClosed(cl) {
+		t.Error("push() timeout closed the connection")
+	}
+}
+
+// После переполнения writePump сначала дописывает то, что осталось в очереди, затем один раз
+// запускает resync; кадры resync идут через ту же очередь и приходят по порядку
+func TestWritePumpResyncAfterSpill(t *testing.T) {
+	cl, peer := newTestClient(t, testConfig(OverflowSpill))
+
+	var resyncs atomic.Int32
+	cl.resync = func() {
+		resyncs.Add(1)
+		for _, frame := range []string{"r1", "r2", "r3", "r4"} {
+			if !cl.push([]byte(frame)) {
+				t.Errorf("push(%q) failed during resync", frame)
+				return
+			}
+		}
+	}
+
+	for _, frame := range []string{"1", "2", "3"} {
+		cl.enqueue([]byte(frame))
+	}
+	if !cl.spilled.Load() {
+		t.Fatal("spilled = false after overflow")
+	}
+
+	go cl.writePump()
+
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{"1", "2", "r1", "r2", "r3", "r4"} {
+		kind, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("reading %q: %v", want, err)
+		}
+		if kind != websocket.BinaryMessage || string(data) != want {
+			t.Fatalf("received %q (type %d), want binary %q", data, kind, want)
+		}
+	}
+
+	// Выброшенный кадр "3" не приходит, resync больше не запускается
+	peer.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, data, err := peer.ReadMessage(); err == nil {
+		t.Errorf("received unexpected frame %q", data)
+	}
+	if got := resyncs.Load(); got != 1 {
+		t.Errorf("resync ran %d times, want 1", got)
+	}
+	if cl.spilled.Load() {
+		t.Error("spilled = true after resync")
+	}
+}
+
+// При политике disconnect переполнение закрывает соединение, и writePump завершается
+func TestWritePumpStopsAfterDisconnect(t *testing.T) {
+	cl, peer := newTestClient(t, testConfig(OverflowDisconnect))
+
+	for _, frame := range []string{"1", "2", "3"} {
+		cl.enqueue([]byte(frame))
+	}
+	if !isClosed(cl) {
+		t.Fatal("overflow did not close the connection")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cl.writePump()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writePump did not return after the connection was closed")
+	}
+
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := peer.ReadMessage(); err == nil {
+		t.Error("peer read a frame from a connection closed on overflow")
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowSpill, OverflowDrop, OverflowDisconnect} {
+		got, err := ParseOverflowPolicy(policy.String())
+		if err != nil || got != policy {
+			t.Errorf("ParseOverflowPolicy(%q) = %v, %v; want %v", policy.String(), got, err, policy)
+		}
+	}
+	if _, err := ParseOverflowPolicy("block"); err == nil {
+		t.Error("ParseOverflowPolicy(\"block\") accepted an unknown policy")
+	}
+}
@@ -0,0 +1,82 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// saveMessage сохраняет сообщение и подтверждает его отправителю.
+// Возвращает true, если сообщение нужно разослать получателям.
+func (h *WebSocketHandler) saveMessage(ctx context.Context, userID, deviceID string, msg *pb.WebSocketMessage) bool {
+	err := h.msgRepo.Save(ctx, msg)
+	switch {
+	case err == nil:
+		h.sendServerAck(userID, deviceID, msg.Id)
+		return true
+	case errors.Is(err, repository.ErrDuplicateMessage):
+		// Повтор после потерянного ACK: сообщение уже в очереди получателя, просто подтверждаем
+		h.sendServerAck(userID, deviceID, msg.Id)
+		return false
+	case errors.Is(err, repository.ErrRecipientNotFound):
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_RECIPIENT_NOT_FOUND, err.Error())
+		return false
+	case errors.Is(err, repository.ErrGroupNotFound):
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_NOT_GROUP_MEMBER, err.Error())
+		return false
+	case errors.Is(err, repository.ErrInvalidMessageID), errors.Is(err, repository.ErrMessageIDTaken),
+		errors.Is(err, repository.ErrAttachmentNotFound), errors.Is(err, repository.ErrTooManyAttachments):
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, err.Error())
+		return false
+	default:
+		log.Printf("❌ %v", err)
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_PERSISTENCE_FAILED, "message not saved")
+		return false
+	}
+}
+
+// retryable — после каких ошибок клиенту имеет смысл повторить тот же кадр
+func retryable(code pb.ErrorPayload_Code) bool {
+	switch code {
+	case pb.ErrorPayload_RATE_LIMITED, pb.ErrorPayload_PERSISTENCE_FAILED, pb.ErrorPayload_INTERNAL:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendError сообщает устройству-отправителю, что кадр messageID не принят
+func (h *WebSocketHandler) sendError(userID, deviceID, messageID string, code pb.ErrorPayload_Code, text string) {
+	h.sendErrorPayload(userID, deviceID, &pb.ErrorPayload{
+		Code:      code,
+		Message:   text,
+		MessageId: messageID,
+		Retryable: retryable(code),
+	})
+}
+
+// sendErrorPayload отправляет устройству кадр ERROR с готовым описанием ошибки
+func (h *WebSocketHandler) sendErrorPayload(userID, deviceID string, e *pb.ErrorPayload) {
+	payload, err := proto.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	data, err := proto.Marshal(&pb.WebSocketMessage{
+		Type:      pb.WebSocketMessage_ERROR,
+		Id:        e.MessageId,
+		Payload:   payload,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+
+	h.sendToDevice(userID, deviceID, data)
+}
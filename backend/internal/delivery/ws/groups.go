@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// checkGroupFrame проверяет кадр с group_id: адресат у кадра один (группа или юзер),
+// а отправитель должен состоять в группе. Зашифрованное (сообщение, ключ отправителя)
+// принимается только в текущей эпохе группы. При отказе сообщает устройству об ошибке.
+func (h *WebSocketHandler) checkGroupFrame(ctx context.Context, userID, deviceID string, msg *pb.WebSocketMessage) bool {
+	if msg.RecipientId != "" {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "recipient_id and group_id are mutually exclusive")
+		return false
+	}
+
+	epoch, err := h.groupRepo.Epoch(ctx, msg.GroupId, userID)
+	if errors.Is(err, repository.ErrNotGroupMember) {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_NOT_GROUP_MEMBER, err.Error())
+		return false
+	}
+	if err != nil {
+		log.Printf("❌ %v", err)
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INTERNAL, "group unavailable")
+		return false
+	}
+
+	switch msg.Type {
+	case pb.WebSocketMessage_TEXT_MESSAGE, pb.WebSocketMessage_ATTACHMENT, pb.WebSocketMessage_SENDER_KEY_DISTRIBUTION:
+		if msg.GroupEpoch != epoch {
+			// Состав группы изменился: клиент рассылает новый ключ отправителя и шифрует заново
+			h.sendErrorPayload(userID, deviceID, &pb.ErrorPayload{
+				Code:       pb.ErrorPayload_STALE_GROUP_EPOCH,
+				Message:    "group epoch has changed",
+				MessageId:  msg.Id,
+				GroupEpoch: epoch,
+			})
+			return false
+		}
+	}
+
+	return true
+}
+
+// sendToGroup рассылает кадр всем участникам группы, кроме устройства-отправителя:
+// другие устройства отправителя тоже получают исходящее.
+// Кто офлайн, получит сообщение из очереди при подключении.
+func (h *WebSocketHandler) sendToGroup(ctx context.Context, groupID string, data []byte, senderID, senderDeviceID string) {
+	memberIDs, err := h.groupRepo.MemberIDs(ctx, groupID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+
+	for _, memberID := range memberIDs {
+		exclude := ""
+		if memberID == senderID {
+			exclude = senderDeviceID
+		}
+		h.sendToUser(memberID, data, exclude)
+	}
+}
+
+func toGroupEventKind(kind domain.GroupEventKind) pb.GroupEvent_Kind {
+	switch kind {
+	case domain.GroupMembersAdded:
+		return pb.GroupEvent_MEMBERS_ADDED
+	case domain.GroupMemberLeft:
+		return pb.GroupEvent_MEMBER_LEFT
+	case domain.GroupMemberRemoved:
+		return pb.GroupEvent_MEMBER_REMOVED
+	case domain.GroupRoleChanged:
+		return pb.GroupEvent_ROLE_CHANGED
+	case domain.GroupUpdated:
+		return pb.GroupEvent_UPDATED
+	default:
+		return pb.GroupEvent_CREATED
+	}
+}
+
+// NotifyGroupEvent сохраняет системное событие группы и рассылает его участникам кадром GROUP_EVENT.
+// Событие сохраняется как сообщение группы без отправителя, поэтому офлайн-участники получат его из очереди.
+// Выбывшим (ev.Removed) событие сохраняется и доставляется отдельной копией:
+// участниками они уже не считаются.
+func (h *WebSocketHandler) NotifyGroupEvent(ctx context.Context, ev domain.GroupEvent) error {
+	payload, err := proto.Marshal(&pb.GroupEvent{
+		Kind:     toGroupEventKind(ev.Kind),
+		ActorId:  ev.ActorID,
+		UserIds:  ev.UserIDs,
+		Role:     string(ev.Role),
+		Metadata: ev.Metadata,
+		Epoch:    ev.Epoch,
+	})
+	if err != nil {
+		return err
+	}
+
+	frame := &pb.WebSocketMessage{
+		Type:      pb.WebSocketMessage_GROUP_EVENT,
+		Id:        uuid.NewString(),
+		Payload:   payload,
+		Timestamp: time.Now().Unix(),
+		GroupId:   ev.GroupID,
+	}
+	if err := h.msgRepo.Save(ctx, frame); err != nil {
+		return fmt.Errorf("ошибка сохранения события группы: %w", err)
+	}
+
+	data, err := proto.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	h.sendToGroup(ctx, ev.GroupID, data, "", "")
+
+	for _, userID := range ev.Removed {
+		direct := proto.Clone(frame).(*pb.WebSocketMessage)
+		direct.Id = uuid.NewString()
+		direct.RecipientId = userID
+		if err := h.msgRepo.Save(ctx, direct); err != nil {
+			return fmt.Errorf("ошибка сохранения события группы: %w", err)
+		}
+
+		data, err := proto.Marshal(direct)
+		if err != nil {
+			return err
+		}
+		h.sendToUser(userID, data, "")
+	}
+
+	log.Printf("👥 Событие %s в группе %s", toGroupEventKind(ev.Kind), ev.GroupID)
+	return nil
+}
@@ -1,16 +1,20 @@
 package ws
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
-	"github.com/yerkebulanrai/securemesh/backend/pkg/auth"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/bus"
 	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
 )
 
@@ -19,15 +23,32 @@ var upgrader = websocket.Upgrader{
 }
 
 type WebSocketHandler struct {
-	msgRepo *repository.MessageRepository
-	clients map[string]*websocket.Conn
+	msgRepo   *repository.MessageRepository
+	userRepo  *repository.UserRepository
+	tokenRepo *repository.TokenRepository
+	groupRepo *repository.GroupRepository
+	// userID -> deviceID -> соединение: у юзера может быть несколько устройств онлайн
+	clients map[string]map[string]*client
 	mutex   sync.Mutex
+	cfg     Config
+
+	// Маршрутизация между узлами: юзер может быть подключён к другой реплике
+	nodeID   string
+	bus      bus.Bus
+	presence bus.Presence
 }
 
-func NewWebSocketHandler(repo *repository.MessageRepository) *WebSocketHandler {
+func NewWebSocketHandler(repo *repository.MessageRepository, userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, groupRepo *repository.GroupRepository, messageBus bus.Bus, presence bus.Presence, nodeID string, cfg Config) *WebSocketHandler {
 	return &WebSocketHandler{
-		msgRepo: repo,
-		clients: make(map[string]*websocket.Conn),
+		msgRepo:   repo,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		groupRepo: groupRepo,
+		clients:   make(map[string]map[string]*client),
+		cfg:       cfg,
+		nodeID:    nodeID,
+		bus:       messageBus,
+		presence:  presence,
 	}
 }
 
@@ -38,12 +59,13 @@ func (h *WebSocketHandler) Handle(c echo.Context) error {
 		return c.String(http.StatusUnauthorized, "token is required")
 	}
 
-	// Валидируем JWT и извлекаем userID
-	userID, err := auth.ValidateToken(token)
+	// Валидируем JWT (включая список отзыва) и извлекаем userID и deviceID
+	claims, err := h.authorize(c.Request().Context(), token)
 	if err != nil {
 		log.Printf("❌ Invalid token: %v", err)
 		return c.String(http.StatusUnauthorized, "invalid or expired token")
 	}
+	userID, deviceID := claims.UserID, claims.DeviceID
 	// ========================================================
 
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
@@ -51,59 +73,212 @@ func (h *WebSocketHandler) Handle(c echo.Context) error {
 		return err
 	}
 
-	h.mutex.Lock()
-	h.clients[userID] = ws
-	h.mutex.Unlock()
+	ctx := c.Request().Context()
+	cl := newClient(ws, h.cfg)
+	cl.claims.Store(claims)
+	cl.resync = func() {
+		h.flushPending(context.Background(), userID, deviceID, cl)
+	}
+	cl.keepalive()
+	go cl.writePump()
 
-	log.Printf("👤 Пользователь подключился: %s", userID)
+	h.register(ctx, userID, deviceID, cl)
+	log.Printf("👤 Пользователь подключился: %s (устройство %s)", userID, deviceID)
 
 	defer func() {
-		h.mutex.Lock()
-		delete(h.clients, userID)
-		h.mutex.Unlock()
-		ws.Close()
-		log.Printf("👤 Пользователь отключился: %s", userID)
+		h.unregister(userID, deviceID, cl)
+		cl.close()
+		log.Printf("👤 Пользователь отключился: %s (устройство %s)", userID, deviceID)
 	}()
 
+	// Отдаём всё, что накопилось, пока устройство было офлайн
+	h.flushPending(ctx, userID, deviceID, cl)
+	h.flushReceipts(ctx, userID, deviceID, cl)
+
 	for {
 		_, msgData, err := ws.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("☠️ Устройство %s юзера %s не отвечает на ping, соединение снято", deviceID, userID)
+			}
 			break
 		}
 
+		// Любой кадр от клиента тоже подтверждает, что соединение живо
+		ws.SetReadDeadline(time.Now().Add(h.cfg.PongWait))
+
 		var protoMsg pb.WebSocketMessage
 		if err := proto.Unmarshal(msgData, &protoMsg); err != nil {
+			h.sendError(userID, deviceID, "", pb.ErrorPayload_MALFORMED_FRAME, "frame is not a WebSocketMessage")
 			continue
 		}
 
-		// sender_id устанавливается сервером из JWT — нельзя подделать!
+		if !cl.limiter.Allow() {
+			h.sendError(userID, deviceID, protoMsg.Id, pb.ErrorPayload_RATE_LIMITED, "too many frames")
+			continue
+		}
+
+		// sender_id и sender_device_id устанавливаются сервером из JWT — нельзя подделать!
 		protoMsg.SenderId = userID
+		protoMsg.SenderDeviceId = deviceID
+		// Адресацию на конкретное устройство тоже задаёт только сервер
+		protoMsg.RecipientDeviceId = ""
 
-		if protoMsg.Type == pb.WebSocketMessage_TEXT_MESSAGE {
-			go h.msgRepo.Save(c.Request().Context(), &protoMsg)
+		// В группу пишут только её участники
+		if protoMsg.GroupId != "" && !h.checkGroupFrame(ctx, userID, deviceID, &protoMsg) {
+			continue
 		}
 
-		if protoMsg.RecipientId != "" {
-			h.sendToUser(protoMsg.RecipientId, msgData)
+		switch protoMsg.Type {
+		case pb.WebSocketMessage_ERROR, pb.WebSocketMessage_HISTORY_RESPONSE, pb.WebSocketMessage_PRESENCE,
+			pb.WebSocketMessage_KEY_CHANGED, pb.WebSocketMessage_GROUP_EVENT:
+			// Эти кадры шлёт только сервер
+			h.sendError(userID, deviceID, protoMsg.Id, pb.ErrorPayload_UNAUTHORIZED, "server-only frame type")
+			continue
+		case pb.WebSocketMessage_AUTH:
+			h.handleAuth(ctx, userID, deviceID, cl, &protoMsg)
+			continue
+		case pb.WebSocketMessage_TEXT_MESSAGE, pb.WebSocketMessage_ATTACHMENT:
+			if protoMsg.Type == pb.WebSocketMessage_ATTACHMENT && len(protoMsg.AttachmentIds) == 0 {
+				h.sendError(userID, deviceID, protoMsg.Id, pb.ErrorPayload_INVALID_MESSAGE, "attachment message requires attachment_ids")
+				continue
+			}
+			// Сохраняем до отправки: если получатель офлайн, сообщение ждёт его в очереди
+			if !h.saveMessage(ctx, userID, deviceID, &protoMsg) {
+				continue
+			}
+		case pb.WebSocketMessage_SENDER_KEY_DISTRIBUTION:
+			// Рассылается по устройствам внутри: каждому — свой шифротекст
+			h.handleSenderKeys(ctx, userID, deviceID, &protoMsg)
+			continue
+		case pb.WebSocketMessage_ACK:
+			// Квитанции адресуем сами: отправитель берётся из БД, а не из кадра
+			h.handleAck(ctx, userID, deviceID, &protoMsg)
+			continue
+		case pb.WebSocketMessage_TYPING:
+			h.handleTyping(ctx, userID, deviceID, cl, &protoMsg)
+			continue
+		case pb.WebSocketMessage_PRESENCE_SUBSCRIBE:
+			h.handlePresenceSubscribe(ctx, userID, deviceID, cl, &protoMsg)
+			continue
+		case pb.WebSocketMessage_HISTORY_REQUEST:
+			// Запрос к серверу, никуда не пересылается
+			h.handleHistory(ctx, userID, deviceID, cl, &protoMsg)
+			continue
+		}
+
+		// Пересобираем кадр, чтобы получатель увидел sender_id от сервера
+		outData, err := proto.Marshal(&protoMsg)
+		if err != nil {
+			continue
+		}
+
+		if protoMsg.GroupId != "" {
+			h.sendToGroup(ctx, protoMsg.GroupId, outData, userID, deviceID)
+		} else if protoMsg.RecipientId != "" {
+			h.sendToUser(protoMsg.RecipientId, outData, "")
+			// Остальные устройства отправителя тоже должны увидеть исходящее
+			if protoMsg.RecipientId != userID {
+				h.sendToUser(userID, outData, deviceID)
+			}
 		} else {
-			h.sendToUser(userID, msgData)
+			h.sendToUser(userID, outData, "")
 		}
 	}
 
 	return nil
 }
 
-func (h *WebSocketHandler) sendToUser(recipientID string, data []byte) {
+// register добавляет соединение устройства в реестр и отмечает его присутствие на этом узле.
+// Если устройство переподключилось, старое соединение закрываем.
+func (h *WebSocketHandler) register(ctx context.Context, userID, deviceID string, cl *client) {
+	h.mutex.Lock()
+	devices, ok := h.clients[userID]
+	if !ok {
+		devices = make(map[string]*client)
+		h.clients[userID] = devices
+	}
+	old := devices[deviceID]
+	devices[deviceID] = cl
+	h.mutex.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+
+	nodes, err := h.presence.Nodes(ctx, userID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+	}
+	wasOnline := len(nodes) > 0
+
+	if err := h.presence.SetOnline(ctx, userID, deviceID, h.nodeID); err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+
+	// Первое устройство в сети — юзер стал онлайн
+	if !wasOnline {
+		go h.broadcastPresence(userID, true)
+	}
+}
+
+func (h *WebSocketHandler) unregister(userID, deviceID string, cl *client) {
 	h.mutex.Lock()
-	targetConn, ok := h.clients[recipientID]
+	devices := h.clients[userID]
+	// Устройство могло уже переподключиться — не удаляем чужое соединение
+	if devices[deviceID] != cl {
+		h.mutex.Unlock()
+		return
+	}
+	delete(devices, deviceID)
+	if len(devices) == 0 {
+		delete(h.clients, userID)
+	}
 	h.mutex.Unlock()
 
-	if ok {
-		err := targetConn.WriteMessage(websocket.BinaryMessage, data)
+	// Контекст запроса к этому моменту уже отменён
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	if err := h.presence.SetOffline(ctx, userID, deviceID, h.nodeID); err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+
+	// Последнее устройство ушло из сети — запоминаем last seen и сообщаем подписчикам
+	nodes, err := h.presence.Nodes(ctx, userID)
+	if err != nil || len(nodes) > 0 {
+		return
+	}
+	if err := h.userRepo.TouchLastSeen(ctx, userID); err != nil {
+		log.Printf("❌ %v", err)
+	}
+	go h.broadcastPresence(userID, false)
+}
+
+// flushPending отправляет юзеру недоставленные сообщения в порядке отправки.
+// Из очереди они уходят только после ACK от клиента.
+func (h *WebSocketHandler) flushPending(ctx context.Context, userID, deviceID string, cl *client) {
+	pending, err := h.msgRepo.GetPending(ctx, userID, deviceID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+
+	for _, msg := range pending {
+		data, err := proto.Marshal(msg)
 		if err != nil {
-			log.Printf("❌ Ошибка отправки юзеру %s: %v", recipientID, err)
+			continue
+		}
+		if !cl.push(data) {
+			log.Printf("❌ Не удалось отдать очередь юзеру %s: соединение закрыто или не успевает", userID)
+			return
 		}
-	} else {
-		log.Printf("💤 Юзер %s офлайн", recipientID)
 	}
-}
\ No newline at end of file
+
+	if len(pending) > 0 {
+		log.Printf("📬 Устройству %s юзера %s доставлено из очереди: %d", deviceID, userID, len(pending))
+	}
+}
@@ -0,0 +1,56 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// handleHistory отвечает на HISTORY_REQUEST страницей истории (аналог GET /messages).
+// Ответ уходит только запросившему устройству с тем же id, что у запроса.
+func (h *WebSocketHandler) handleHistory(ctx context.Context, userID, deviceID string, cl *client, msg *pb.WebSocketMessage) {
+	var req pb.HistoryRequest
+	if err := proto.Unmarshal(msg.Payload, &req); err != nil {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "invalid history request")
+		return
+	}
+
+	var before *repository.MessageCursor
+	if req.Cursor != "" {
+		cur, err := repository.DecodeCursor(req.Cursor)
+		if err != nil {
+			h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, err.Error())
+			return
+		}
+		before = &cur
+	}
+
+	messages, next, err := h.msgRepo.History(ctx, userID, req.PeerId, req.GroupId, before, repository.HistoryLimit(int(req.Limit)))
+	if err != nil {
+		log.Printf("❌ %v", err)
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INTERNAL, "history unavailable")
+		return
+	}
+
+	payload, err := proto.Marshal(&pb.HistoryResponse{Messages: messages, NextCursor: next})
+	if err != nil {
+		return
+	}
+
+	data, err := proto.Marshal(&pb.WebSocketMessage{
+		Type:      pb.WebSocketMessage_HISTORY_RESPONSE,
+		Id:        msg.Id,
+		Payload:   payload,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return
+	}
+
+	cl.push(data)
+}
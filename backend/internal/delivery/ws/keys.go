@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// keyChangeTimeout — на сколько может затянуться рассылка KEY_CHANGED по контактам
+const keyChangeTimeout = time.Minute
+
+// NotifyKeyChanged рассылает KEY_CHANGED всем контактам юзера и его остальным устройствам.
+// Кадр сохраняется для каждого контакта, поэтому дойдёт и до тех, кто сейчас офлайн.
+func (h *WebSocketHandler) NotifyKeyChanged(change domain.KeyChange) {
+	go h.notifyKeyChanged(change)
+}
+
+func (h *WebSocketHandler) notifyKeyChanged(change domain.KeyChange) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyChangeTimeout)
+	defer cancel()
+
+	payload, err := proto.Marshal(&pb.KeyChangedPayload{
+		UserId:      change.UserID,
+		DeviceId:    change.DeviceID,
+		IdentityKey: change.PublicIdentityKey,
+		SigningKey:  change.PublicSigningKey,
+		Proof:       change.Proof,
+		ChangedAt:   change.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return
+	}
+
+	frame := func(recipientID string) *pb.WebSocketMessage {
+		return &pb.WebSocketMessage{
+			Type:           pb.WebSocketMessage_KEY_CHANGED,
+			Id:             uuid.NewString(),
+			Payload:        payload,
+			Timestamp:      time.Now().Unix(),
+			SenderId:       change.UserID,
+			SenderDeviceId: change.DeviceID,
+			RecipientId:    recipientID,
+		}
+	}
+
+	// Остальные устройства самого юзера узнают о смене сразу
+	if data, err := proto.Marshal(frame("")); err == nil {
+		h.sendToUser(change.UserID, data, change.DeviceID)
+	}
+
+	contacts, err := h.msgRepo.Contacts(ctx, change.UserID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+
+	for _, contactID := range contacts {
+		msg := frame(contactID)
+		if err := h.msgRepo.Save(ctx, msg); err != nil {
+			log.Printf("❌ KEY_CHANGED для %s не сохранён: %v", contactID, err)
+			continue
+		}
+
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			continue
+		}
+		h.sendToUser(contactID, data, "")
+	}
+
+	log.Printf("🔑 Юзер %s сменил ключи устройства %s, уведомлено контактов: %d", change.UserID, change.DeviceID, len(contacts))
+}
@@ -0,0 +1,202 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+const (
+	// Подписка на статусы живёт час, клиент продлевает её при переподключении
+	presenceWatchTTL = time.Hour
+	// Сколько контактов можно отслеживать одной подпиской
+	maxPresenceTargets = 500
+
+	// STARTED пересылаем не чаще раза в typingThrottle на собеседника
+	typingThrottle = 3 * time.Second
+	// Если STOPPED потерялся, клиент гасит индикатор сам через typingExpiry
+	typingExpiry = 6 * time.Second
+)
+
+// handleTyping пересылает индикатор набора получателю или участникам группы, прореживая повторные STARTED.
+// Кадры TYPING не сохраняются и не синхронизируются на другие устройства отправителя.
+func (h *WebSocketHandler) handleTyping(ctx context.Context, userID, deviceID string, cl *client, msg *pb.WebSocketMessage) {
+	// Прореживаем по собеседнику или по группе (членство уже проверено)
+	target := msg.RecipientId
+	if msg.GroupId != "" {
+		target = msg.GroupId
+	}
+	if target == "" {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "typing requires recipient_id or group_id")
+		return
+	}
+
+	var typing pb.TypingPayload
+	if err := proto.Unmarshal(msg.Payload, &typing); err != nil {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "invalid typing payload")
+		return
+	}
+
+	now := time.Now()
+	switch typing.State {
+	case pb.TypingPayload_STARTED:
+		if last, ok := cl.typingSent[target]; ok && now.Sub(last) < typingThrottle {
+			return
+		}
+		cl.typingSent[target] = now
+		typing.ExpiresIn = int32(typingExpiry / time.Second)
+	case pb.TypingPayload_STOPPED:
+		delete(cl.typingSent, target)
+		typing.ExpiresIn = 0
+	}
+
+	payload, err := proto.Marshal(&typing)
+	if err != nil {
+		return
+	}
+	msg.Payload = payload
+	msg.Timestamp = now.Unix()
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	if msg.GroupId == "" {
+		h.sendToUser(msg.RecipientId, data, "")
+		return
+	}
+
+	memberIDs, err := h.groupRepo.MemberIDs(ctx, msg.GroupId)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+	for _, memberID := range memberIDs {
+		if memberID != userID {
+			h.sendToUser(memberID, data, "")
+		}
+	}
+}
+
+// handlePresenceSubscribe подписывает юзера на статусы контактов и сразу отдаёт текущие
+func (h *WebSocketHandler) handlePresenceSubscribe(ctx context.Context, userID, deviceID string, cl *client, msg *pb.WebSocketMessage) {
+	var sub pb.PresenceSubscribe
+	if err := proto.Unmarshal(msg.Payload, &sub); err != nil || len(sub.UserIds) > maxPresenceTargets {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "invalid presence subscription")
+		return
+	}
+
+	if err := h.presence.Watch(ctx, userID, sub.UserIds, presenceWatchTTL); err != nil {
+		log.Printf("❌ %v", err)
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INTERNAL, "presence unavailable")
+		return
+	}
+
+	for _, targetID := range sub.UserIds {
+		status, ok := h.presenceFor(ctx, targetID, userID)
+		if !ok {
+			continue
+		}
+		data, err := newPresenceFrame(status)
+		if err != nil {
+			continue
+		}
+		cl.push(data)
+	}
+}
+
+// presenceFor возвращает статус targetID так, как его должен видеть watcherID.
+// false — статус скрыт настройками приватности или юзера нет.
+func (h *WebSocketHandler) presenceFor(ctx context.Context, targetID, watcherID string) (*pb.PresencePayload, bool) {
+	visibility, lastSeen, err := h.userRepo.GetLastSeen(ctx, targetID)
+	if err != nil {
+		return nil, false
+	}
+
+	if !h.canSeePresence(ctx, visibility, targetID, watcherID) {
+		return nil, false
+	}
+
+	nodes, err := h.presence.Nodes(ctx, targetID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return nil, false
+	}
+
+	status := &pb.PresencePayload{UserId: targetID, Online: len(nodes) > 0}
+	if !status.Online && lastSeen != nil {
+		status.LastSeen = lastSeen.Unix()
+	}
+	return status, true
+}
+
+// canSeePresence применяет настройку приватности targetID к конкретному наблюдателю
+func (h *WebSocketHandler) canSeePresence(ctx context.Context, visibility domain.LastSeenVisibility, targetID, watcherID string) bool {
+	isContact := false
+	if visibility == domain.LastSeenContacts {
+		var err error
+		isContact, err = h.msgRepo.AreContacts(ctx, targetID, watcherID)
+		if err != nil {
+			log.Printf("❌ %v", err)
+			return false
+		}
+	}
+	return visibility.Allows(isContact)
+}
+
+// broadcastPresence рассылает подписчикам смену статуса юзера (первое устройство
+// подключилось или последнее отключилось), с учётом его настроек приватности
+func (h *WebSocketHandler) broadcastPresence(userID string, online bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	watchers, err := h.presence.Watchers(ctx, userID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return
+	}
+	if len(watchers) == 0 {
+		return
+	}
+
+	visibility, lastSeen, err := h.userRepo.GetLastSeen(ctx, userID)
+	if err != nil {
+		return
+	}
+
+	status := &pb.PresencePayload{UserId: userID, Online: online}
+	if !online && lastSeen != nil {
+		status.LastSeen = lastSeen.Unix()
+	}
+	data, err := newPresenceFrame(status)
+	if err != nil {
+		return
+	}
+
+	for _, watcherID := range watchers {
+		if h.canSeePresence(ctx, visibility, userID, watcherID) {
+			h.sendToUser(watcherID, data, "")
+		}
+	}
+}
+
+func newPresenceFrame(status *pb.PresencePayload) ([]byte, error) {
+	payload, err := proto.Marshal(status)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&pb.WebSocketMessage{
+		Type:      pb.WebSocketMessage_PRESENCE,
+		Id:        uuid.NewString(),
+		Payload:   payload,
+		Timestamp: time.Now().Unix(),
+	})
+}
@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/yerkebulanrai/securemesh/backend/pkg/bus"
+)
+
+// busTimeout ограничивает обращения к шине и реестру присутствия при отправке
+const busTimeout = 2 * time.Second
+
+// Start подписывает узел на шину: кадры для юзеров, подключённых сюда,
+// приходят от других узлов через неё. Заодно запускает перепроверку токенов соединений.
+func (h *WebSocketHandler) Start(ctx context.Context) error {
+	err := h.bus.Subscribe(ctx, h.nodeID, func(env bus.Envelope) {
+		h.deliverLocal(env)
+	})
+	if err != nil {
+		return err
+	}
+
+	go h.revalidateLoop(ctx)
+	return nil
+}
+
+// sendToUser отправляет кадр на все онлайн-устройства юзера, кроме excludeDeviceID,
+// включая подключённые к другим узлам.
+// Возвращает true, если кадр ушёл хотя бы в один сокет или на другой узел.
+func (h *WebSocketHandler) sendToUser(recipientID string, data []byte, excludeDeviceID string) bool {
+	env := bus.Envelope{
+		UserID:          recipientID,
+		ExcludeDeviceID: excludeDeviceID,
+		Data:            data,
+	}
+
+	sent := h.deliverLocal(env)
+	if h.publishRemote(env) {
+		sent = true
+	}
+
+	if !sent && excludeDeviceID == "" {
+		log.Printf("💤 Юзер %s офлайн", recipientID)
+	}
+
+	return sent
+}
+
+// sendToDevice отправляет кадр на конкретное устройство юзера, если оно онлайн на этом узле
+func (h *WebSocketHandler) sendToDevice(userID, deviceID string, data []byte) bool {
+	return h.deliverLocal(bus.Envelope{UserID: userID, DeviceID: deviceID, Data: data})
+}
+
+// sendToUserDevice отправляет кадр на одно устройство юзера, на каком бы узле оно ни было подключено
+func (h *WebSocketHandler) sendToUserDevice(userID, deviceID string, data []byte) bool {
+	env := bus.Envelope{UserID: userID, DeviceID: deviceID, Data: data}
+
+	sent := h.deliverLocal(env)
+	if h.publishRemote(env) {
+		sent = true
+	}
+	return sent
+}
+
+// deliverLocal ставит кадр в очереди устройств, подключённых к этому узлу
+// (или закрывает их соединения, если в конверте задан CloseCode).
+// Медленный получатель не блокирует отправителя: при переполнении срабатывает политика из Config.
+func (h *WebSocketHandler) deliverLocal(env bus.Envelope) bool {
+	h.mutex.Lock()
+	targets := make([]*client, 0, len(h.clients[env.UserID]))
+	for deviceID, cl := range h.clients[env.UserID] {
+		if env.DeviceID != "" && deviceID != env.DeviceID {
+			continue
+		}
+		if deviceID == env.ExcludeDeviceID {
+			continue
+		}
+		targets = append(targets, cl)
+	}
+	h.mutex.Unlock()
+
+	if env.CloseCode != 0 {
+		for _, target := range targets {
+			target.closeWith(env.CloseCode, env.CloseReason)
+		}
+		return len(targets) > 0
+	}
+
+	sent := false
+	for _, target := range targets {
+		if !target.enqueue(env.Data) {
+			log.Printf("🐢 Кадр юзеру %s не поставлен в очередь (политика %s)", env.UserID, h.cfg.Overflow)
+			continue
+		}
+		sent = true
+	}
+
+	return sent
+}
+
+// publishRemote пересылает конверт узлам, к которым подключены другие устройства юзера
+func (h *WebSocketHandler) publishRemote(env bus.Envelope) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	nodes, err := h.presence.Nodes(ctx, env.UserID)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		return false
+	}
+
+	sent := false
+	for _, nodeID := range nodes {
+		if nodeID == h.nodeID {
+			continue
+		}
+		if err := h.bus.Publish(ctx, nodeID, env); err != nil {
+			log.Printf("❌ %v", err)
+			continue
+		}
+		sent = true
+	}
+
+	return sent
+}
@@ -0,0 +1,101 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/yerkebulanrai/securemesh/backend/internal/repository"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// maxSenderKeyMessages — сколько устройств можно охватить одной рассылкой ключа
+const maxSenderKeyMessages = 2048
+
+// handleSenderKeys раскладывает рассылку ключа отправителя (SenderKeyBundle) по устройствам участников.
+// Каждое устройство получает кадр SENDER_KEY_DISTRIBUTION только со своим шифротекстом;
+// офлайн-устройства — из очереди. Членство и эпоха уже проверены checkGroupFrame.
+//
+// Рассылка принимается целиком или не принимается: адресатом должно быть активное устройство
+// участника группы. Id кадров для устройств выводятся из id рассылки, поэтому её повтор
+// после потерянного ACK не создаёт дублей.
+func (h *WebSocketHandler) handleSenderKeys(ctx context.Context, userID, deviceID string, msg *pb.WebSocketMessage) {
+	if msg.GroupId == "" {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "sender key distribution requires group_id")
+		return
+	}
+	bundleID, err := uuid.Parse(msg.Id)
+	if err != nil {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, repository.ErrInvalidMessageID.Error())
+		return
+	}
+
+	var bundle pb.SenderKeyBundle
+	if err := proto.Unmarshal(msg.Payload, &bundle); err != nil ||
+		len(bundle.Messages) == 0 || len(bundle.Messages) > maxSenderKeyMessages {
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "invalid sender key bundle")
+		return
+	}
+
+	devices, err := h.groupRepo.MemberDevices(ctx, msg.GroupId)
+	if err != nil {
+		log.Printf("❌ %v", err)
+		h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INTERNAL, "group unavailable")
+		return
+	}
+	// deviceID -> владелец: адресат должен быть активным устройством участника
+	owners := make(map[string]string, len(devices))
+	for _, d := range devices {
+		owners[d.ID] = d.UserID
+	}
+
+	seen := make(map[string]bool, len(bundle.Messages))
+	for _, m := range bundle.Messages {
+		// Пустые device_id и recipient_id не должны совпасть через нулевое значение карты:
+		// кадр без получателя ушёл бы всей группе
+		owner, ok := owners[m.DeviceId]
+		if !ok || owner != m.RecipientId || m.DeviceId == deviceID || seen[m.DeviceId] || len(m.Ciphertext) == 0 {
+			h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_INVALID_MESSAGE, "sender key addressed to a device outside the group")
+			return
+		}
+		seen[m.DeviceId] = true
+	}
+
+	for _, m := range bundle.Messages {
+		frame := &pb.WebSocketMessage{
+			Type:              pb.WebSocketMessage_SENDER_KEY_DISTRIBUTION,
+			Id:                uuid.NewSHA1(bundleID, []byte(m.DeviceId)).String(),
+			Payload:           m.Ciphertext,
+			Timestamp:         msg.Timestamp,
+			SenderId:          userID,
+			SenderDeviceId:    deviceID,
+			RecipientId:       m.RecipientId,
+			RecipientDeviceId: m.DeviceId,
+			GroupId:           msg.GroupId,
+			GroupEpoch:        msg.GroupEpoch,
+		}
+
+		err := h.msgRepo.Save(ctx, frame)
+		if errors.Is(err, repository.ErrDuplicateMessage) {
+			// Уже сохранено при прошлой попытке и доставлено или ждёт в очереди
+			continue
+		}
+		if err != nil {
+			log.Printf("❌ %v", err)
+			h.sendError(userID, deviceID, msg.Id, pb.ErrorPayload_PERSISTENCE_FAILED, "sender key not saved")
+			return
+		}
+
+		data, err := proto.Marshal(frame)
+		if err != nil {
+			continue
+		}
+		h.sendToUserDevice(m.RecipientId, m.DeviceId, data)
+	}
+
+	h.sendServerAck(userID, deviceID, msg.Id)
+	log.Printf("🔑 Ключ отправителя %s разослан в группе %s (эпоха %d, устройств: %d)", userID, msg.GroupId, msg.GroupEpoch, len(bundle.Messages))
+}
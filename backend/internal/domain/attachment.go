@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"time"
+)
+
+// MaxMessageAttachments — сколько вложений может быть в одном сообщении
+const MaxMessageAttachments = 32
+
+// MaxUploadChunks — из скольких кусков может состоять докачиваемая загрузка
+const MaxUploadChunks = 10000
+
+// Attachment — зашифрованный клиентом файл в blob-хранилище (ключ объекта — ID)
+type Attachment struct {
+	ID         string     `json:"id"`
+	OwnerID    string     `json:"owner_id,omitempty"`
+	Size       int64      `json:"size"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UploadedAt *time.Time `json:"uploaded_at,omitempty"` // nil — загрузка не подтверждена
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// Upload — докачиваемая загрузка вложения через API: клиент шлёт файл кусками с указанием смещения
+type Upload struct {
+	ID           string    `json:"id"`
+	AttachmentID string    `json:"attachment_id"`
+	Size         int64     `json:"size"`
+	Offset       int64     `json:"offset"` // Сколько байт уже принято
+	SHA256       []byte    `json:"-"`      // Ожидаемый хэш всего файла
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// UploadChunk — принятый кусок загрузки, лежит в blob-хранилище под BlobKey
+type UploadChunk struct {
+	Offset  int64
+	Size    int64
+	BlobKey string
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+)
+
+// Device — устройство пользователя со своей парой ключей.
+// Первое устройство создаётся при регистрации, остальные привязываются с уже авторизованного.
+type Device struct {
+	ID                string    `json:"id"`
+	UserID            string    `json:"user_id"`
+	Name              string    `json:"name"`
+	PublicIdentityKey []byte    `json:"public_identity_key"` // Curve25519 для ECDH
+	PublicSigningKey  []byte    `json:"public_signing_key"`  // Ed25519 для подписей
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// KeyChange — запись истории ключей устройства.
+// Proof — подпись смены предыдущим ключом подписи (пусто для первых ключей устройства).
+type KeyChange struct {
+	UserID            string    `json:"user_id"`
+	DeviceID          string    `json:"device_id"`
+	PublicIdentityKey []byte    `json:"public_identity_key"`
+	PublicSigningKey  []byte    `json:"public_signing_key"`
+	Proof             []byte    `json:"proof,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
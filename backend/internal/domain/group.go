@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"time"
+)
+
+// MaxGroupMembers — сколько участников может быть в группе (сообщение рассылается каждому устройству)
+const MaxGroupMembers = 256
+
+// MaxGroupMetadataSize — размер зашифрованных метаданных группы (название, аватар-превью)
+const MaxGroupMetadataSize = 4096
+
+// GroupRole — роль участника группы. Владелец один; админы добавляют и исключают участников.
+type GroupRole string
+
+const (
+	GroupRoleOwner  GroupRole = "owner"
+	GroupRoleAdmin  GroupRole = "admin"
+	GroupRoleMember GroupRole = "member"
+)
+
+func (r GroupRole) rank() int {
+	switch r {
+	case GroupRoleOwner:
+		return 3
+	case GroupRoleAdmin:
+		return 2
+	case GroupRoleMember:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Valid — известная ли роль
+func (r GroupRole) Valid() bool {
+	return r.rank() > 0
+}
+
+// CanAddMembers — может ли участник с этой ролью добавлять других и менять метаданные
+func (r GroupRole) CanAddMembers() bool {
+	return r.rank() >= GroupRoleAdmin.rank()
+}
+
+// CanRemove — может ли участник с ролью r исключить участника с ролью target:
+// только админ и выше, и только тех, кто ниже его по роли
+func (r GroupRole) CanRemove(target GroupRole) bool {
+	return r.CanAddMembers() && r.rank() > target.rank()
+}
+
+// Group — групповой чат
+type Group struct {
+	ID        string    `json:"id"`
+	Metadata  []byte    `json:"metadata"` // Шифруют клиенты, сервер не читает
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Epoch     uint64    `json:"epoch"`          // Растёт при каждом изменении состава
+	Role      GroupRole `json:"role,omitempty"` // Роль юзера, запросившего группу
+}
+
+// GroupMember — участник группы
+type GroupMember struct {
+	UserID   string    `json:"user_id"`
+	Role     GroupRole `json:"role"`
+	AddedBy  string    `json:"added_by,omitempty"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// GroupEventKind — что произошло в группе
+type GroupEventKind int
+
+const (
+	GroupCreated GroupEventKind = iota
+	GroupMembersAdded
+	GroupMemberLeft
+	GroupMemberRemoved
+	GroupRoleChanged
+	GroupUpdated
+)
+
+// GroupEvent — системное событие группы, рассылается участникам кадром GROUP_EVENT.
+// Removed — кто перестал быть участником: им событие доставляется отдельно.
+// Epoch — эпоха группы после события.
+type GroupEvent struct {
+	GroupID  string
+	ActorID  string
+	Kind     GroupEventKind
+	UserIDs  []string
+	Role     GroupRole
+	Metadata []byte
+	Removed  []string
+	Epoch    uint64
+}
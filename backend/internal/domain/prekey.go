@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"time"
+)
+
+// SignedPreKey — среднесрочный Curve25519 ключ устройства для X3DH,
+// подписанный его Ed25519 ключом. У устройства один актуальный.
+type SignedPreKey struct {
+	DeviceID  string    `json:"device_id"`
+	KeyID     int32     `json:"key_id"`
+	PublicKey []byte    `json:"public_key"`
+	Signature []byte    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OneTimePreKey — одноразовый Curve25519 ключ. Выдаётся ровно одному собеседнику.
+type OneTimePreKey struct {
+	DeviceID  string `json:"device_id"`
+	KeyID     int32  `json:"key_id"`
+	PublicKey []byte `json:"public_key"`
+}
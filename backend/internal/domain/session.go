@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"time"
+)
+
+// Session — вход устройства: цепочка refresh-токенов, выданных после одного /auth/token.
+// При каждом обновлении токен меняется, а сессия (family) остаётся той же.
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceID   string    `json:"device_id"`
+	DeviceName string    `json:"device_name"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// RefreshGrant — результат обмена refresh-токена: чей он и к какой сессии относится
+type RefreshGrant struct {
+	UserID    string
+	DeviceID  string
+	SessionID string
+}
@@ -0,0 +1,10 @@
+package domain
+
+// LogLeaf — запись журнала прозрачности ключей
+type LogLeaf struct {
+	Index    uint64 `json:"index"`
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+	Epoch    uint64 `json:"epoch"`
+	Data     []byte `json:"data"` // transparency.Entry.MarshalBinary, по ним считается хэш листа
+}
@@ -10,6 +10,54 @@ type User struct {
 	UsernameHash      string    `json:"username_hash"`
 	PublicIdentityKey []byte    `json:"public_identity_key"` // Curve25519 для ECDH
 	PublicSigningKey  []byte    `json:"public_signing_key"`  // Ed25519 для подписей
-	RegistrationLock  string    `json:"-"`
+	RegistrationLock  string    `json:"-"`                   // Argon2id-хэш PIN; пусто — блокировка не включена
 	CreatedAt         time.Time `json:"created_at"`
-}
\ No newline at end of file
+}
+
+// LastSeenVisibility — кому показывать онлайн-статус и время последнего визита
+type LastSeenVisibility string
+
+const (
+	LastSeenEveryone LastSeenVisibility = "everyone"
+	LastSeenContacts LastSeenVisibility = "contacts" // Только тем, кому юзер сам писал или кого добавил в группу
+	LastSeenNobody   LastSeenVisibility = "nobody"
+)
+
+// Valid проверяет, что значение пришло из допустимого набора
+func (v LastSeenVisibility) Valid() bool {
+	switch v {
+	case LastSeenEveryone, LastSeenContacts, LastSeenNobody:
+		return true
+	default:
+		return false
+	}
+}
+
+// Allows решает, виден ли статус собеседнику (isContact — есть ли с ним переписка)
+func (v LastSeenVisibility) Allows(isContact bool) bool {
+	switch v {
+	case LastSeenEveryone:
+		return true
+	case LastSeenContacts:
+		return isContact
+	default:
+		return false
+	}
+}
+
+// RegistrationLockFreeAttempts — сколько неверных PIN подряд допускается без паузы
+const RegistrationLockFreeAttempts = 5
+
+// RegistrationLockout — на сколько блокируются попытки после attempts неверных PIN подряд:
+// минута после пятой ошибки, дальше вдвое больше за каждую следующую, но не дольше суток
+func RegistrationLockout(attempts int) time.Duration {
+	if attempts < RegistrationLockFreeAttempts {
+		return 0
+	}
+
+	lockout := time.Minute
+	for i := RegistrationLockFreeAttempts; i < attempts && lockout < 24*time.Hour; i++ {
+		lockout *= 2
+	}
+	return min(lockout, 24*time.Hour)
+}
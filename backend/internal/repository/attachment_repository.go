@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("вложение не найдено")
+	ErrTooManyAttachments = fmt.Errorf("в сообщении не больше %d вложений", domain.MaxMessageAttachments)
+)
+
+type AttachmentRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAttachmentRepository(db *pgxpool.Pool) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+// Create заводит вложение, которое владелец загрузит по ссылке. Хранится до expiresAt.
+func (r *AttachmentRepository) Create(ctx context.Context, ownerID string, size int64, expiresAt time.Time) (*domain.Attachment, error) {
+	query := `
+		INSERT INTO attachments (owner_id, size, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	a := domain.Attachment{OwnerID: ownerID, Size: size, ExpiresAt: expiresAt}
+	if err := r.db.QueryRow(ctx, query, ownerID, size, expiresAt).Scan(&a.ID, &a.CreatedAt); err != nil {
+		return nil, fmt.Errorf("ошибка создания вложения: %w", err)
+	}
+
+	return &a, nil
+}
+
+// CountPending — сколько у юзера вложений, загрузка которых не подтверждена
+func (r *AttachmentRepository) CountPending(ctx context.Context, ownerID string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM attachments WHERE owner_id = $1 AND uploaded_at IS NULL`
+
+	if err := r.db.QueryRow(ctx, query, ownerID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка чтения вложений: %w", err)
+	}
+	return count, nil
+}
+
+// Get возвращает вложение по id
+func (r *AttachmentRepository) Get(ctx context.Context, id string) (*domain.Attachment, error) {
+	if !validUUIDs(id) {
+		return nil, ErrAttachmentNotFound
+	}
+
+	query := `
+		SELECT id::text, COALESCE(owner_id::text, ''), size, created_at, uploaded_at, expires_at
+		FROM attachments
+		WHERE id = $1
+	`
+	return scanAttachment(r.db.QueryRow(ctx, query, id))
+}
+
+// Readable возвращает загруженное и не истёкшее вложение, если userID может его скачать:
+// он владелец или видит сообщение с этим вложением (собеседник или участник группы с момента отправки)
+func (r *AttachmentRepository) Readable(ctx context.Context, id, userID string) (*domain.Attachment, error) {
+	if !validUUIDs(id) {
+		return nil, ErrAttachmentNotFound
+	}
+
+	query := `
+		SELECT a.id::text, COALESCE(a.owner_id::text, ''), a.size, a.created_at, a.uploaded_at, a.expires_at
+		FROM attachments a
+		WHERE a.id = $1 AND a.uploaded_at IS NOT NULL AND a.expires_at > NOW()
+			AND (a.owner_id = $2 OR EXISTS (
+				SELECT 1 FROM message_attachments ma
+				JOIN messages m ON m.id = ma.message_id
+				WHERE ma.attachment_id = a.id
+					AND (m.sender_id = $2 OR m.recipient_id = $2
+						OR (m.group_id IS NOT NULL AND EXISTS (
+							SELECT 1 FROM group_members gm
+							WHERE gm.group_id = m.group_id AND gm.user_id = $2 AND gm.joined_at <= m.created_at
+						)))
+			))
+	`
+	return scanAttachment(r.db.QueryRow(ctx, query, id, userID))
+}
+
+func scanAttachment(row pgx.Row) (*domain.Attachment, error) {
+	var a domain.Attachment
+	err := row.Scan(&a.ID, &a.OwnerID, &a.Size, &a.CreatedAt, &a.UploadedAt, &a.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения вложения: %w", err)
+	}
+	return &a, nil
+}
+
+// MarkUploaded подтверждает загрузку: теперь вложение можно прикрепить к сообщению
+func (r *AttachmentRepository) MarkUploaded(ctx context.Context, id string) error {
+	if !validUUIDs(id) {
+		return ErrAttachmentNotFound
+	}
+
+	query := `UPDATE attachments SET uploaded_at = NOW() WHERE id = $1 AND uploaded_at IS NULL`
+
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("ошибка подтверждения вложения: %w", err)
+	}
+	return nil
+}
+
+// Garbage возвращает до limit вложений на удаление:
+// истёкшие, не загруженные за uploadWindow и загруженные, но за unreferencedGrace не попавшие ни в одно сообщение.
+// Вложения с незавершённой докачиваемой загрузкой не трогаем: её куски сначала удаляет сборка загрузок.
+func (r *AttachmentRepository) Garbage(ctx context.Context, uploadWindow, unreferencedGrace time.Duration, limit int) ([]string, error) {
+	query := `
+		SELECT id::text FROM attachments a
+		WHERE (a.expires_at <= NOW()
+				OR (a.uploaded_at IS NULL AND a.created_at < $1)
+				OR (a.uploaded_at < $2 AND NOT EXISTS (
+					SELECT 1 FROM message_attachments ma WHERE ma.attachment_id = a.id
+				)))
+			AND NOT EXISTS (SELECT 1 FROM uploads u WHERE u.attachment_id = a.id)
+		ORDER BY a.created_at
+		LIMIT $3
+	`
+
+	now := time.Now()
+	rows, err := r.db.Query(ctx, query, now.Add(-uploadWindow), now.Add(-unreferencedGrace), limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска неиспользуемых вложений: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка поиска неиспользуемых вложений: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Delete удаляет учёт вложения (объект в хранилище удаляется до этого)
+func (r *AttachmentRepository) Delete(ctx context.Context, id string) error {
+	if !validUUIDs(id) {
+		return ErrAttachmentNotFound
+	}
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM attachments WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("ошибка удаления вложения: %w", err)
+	}
+	return nil
+}
+
+// linkAttachments привязывает вложения к сохраняемому сообщению.
+// Прикрепить можно только свои загруженные и не истёкшие вложения, иначе ErrAttachmentNotFound.
+func linkAttachments(ctx context.Context, tx pgx.Tx, messageID, senderID string, attachmentIDs []string) error {
+	if len(attachmentIDs) > domain.MaxMessageAttachments {
+		return ErrTooManyAttachments
+	}
+
+	unique := make(map[string]bool, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return ErrAttachmentNotFound
+		}
+		unique[id] = true
+	}
+
+	query := `
+		INSERT INTO message_attachments (message_id, attachment_id)
+		SELECT $1, a.id FROM attachments a
+		WHERE a.id = ANY($2::uuid[]) AND a.owner_id = $3
+			AND a.uploaded_at IS NOT NULL AND a.expires_at > NOW()
+		ON CONFLICT DO NOTHING
+	`
+	tag, err := tx.Exec(ctx, query, messageID, attachmentIDs, senderID)
+	if err != nil {
+		return fmt.Errorf("ошибка привязки вложений: %w", err)
+	}
+	if tag.RowsAffected() != int64(len(unique)) {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrChallengeNotFound = errors.New("challenge не найден, истёк или уже использован")
+
+type ChallengeRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewChallengeRepository(db *pgxpool.Pool) *ChallengeRepository {
+	return &ChallengeRepository{db: db}
+}
+
+// Create сохраняет nonce, выданный устройству для входа, и заодно чистит истёкшие
+func (r *ChallengeRepository) Create(ctx context.Context, nonce, userID, deviceID string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO auth_challenges (nonce, user_id, device_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := r.db.Exec(ctx, query, nonce, userID, deviceID, expiresAt); err != nil {
+		return fmt.Errorf("ошибка сохранения challenge: %w", err)
+	}
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM auth_challenges WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("ошибка очистки challenge: %w", err)
+	}
+
+	return nil
+}
+
+// Consume забирает nonce: второй раз его не получит никто, даже при параллельных запросах.
+// Возвращает юзера и устройство, которым nonce был выдан.
+func (r *ChallengeRepository) Consume(ctx context.Context, nonce string) (string, string, error) {
+	query := `
+		DELETE FROM auth_challenges
+		WHERE nonce = $1
+		RETURNING user_id, device_id, expires_at > NOW()
+	`
+
+	var (
+		userID, deviceID string
+		live             bool
+	)
+	err := r.db.QueryRow(ctx, query, nonce).Scan(&userID, &deviceID, &live)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !live) {
+		return "", "", ErrChallengeNotFound
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("ошибка чтения challenge: %w", err)
+	}
+
+	return userID, deviceID, nil
+}
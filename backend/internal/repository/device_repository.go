@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+)
+
+var (
+	ErrDeviceNotFound  = errors.New("устройство не найдено")
+	ErrStaleSigningKey = errors.New("ключ подписи устройства уже сменился")
+)
+
+type DeviceRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewDeviceRepository(db *pgxpool.Pool) *DeviceRepository {
+	return &DeviceRepository{db: db}
+}
+
+// Create привязывает новое устройство к пользователю
+func (r *DeviceRepository) Create(ctx context.Context, device *domain.Device) error {
+	query := `
+		INSERT INTO devices (user_id, name, public_identity_key, public_signing_key)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		device.UserID,
+		device.Name,
+		device.PublicIdentityKey,
+		device.PublicSigningKey,
+	).Scan(&device.ID, &device.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при создании устройства: %w", err)
+	}
+
+	return nil
+}
+
+// ListByUser возвращает активные устройства пользователя, начиная с основного
+func (r *DeviceRepository) ListByUser(ctx context.Context, userID string) ([]domain.Device, error) {
+	query := `
+		SELECT id, user_id, name, public_identity_key, public_signing_key, created_at
+		FROM devices
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения устройств: %w", err)
+	}
+	defer rows.Close()
+
+	var devices []domain.Device
+	for rows.Next() {
+		var d domain.Device
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.PublicIdentityKey, &d.PublicSigningKey, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения устройств: %w", err)
+		}
+		devices = append(devices, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения устройств: %w", err)
+	}
+
+	return devices, nil
+}
+
+// GetSigningKey возвращает ключ подписи (Ed25519) активного устройства.
+// Пустой deviceID означает основное (самое первое) устройство пользователя.
+func (r *DeviceRepository) GetSigningKey(ctx context.Context, userID, deviceID string) (string, []byte, error) {
+	if !validUUIDs(userID) || (deviceID != "" && !validUUIDs(deviceID)) {
+		return "", nil, ErrDeviceNotFound
+	}
+
+	query := `
+		SELECT id, public_signing_key
+		FROM devices
+		WHERE user_id = $1 AND ($2::uuid IS NULL OR id = $2::uuid) AND revoked_at IS NULL
+		ORDER BY created_at, id
+		LIMIT 1
+	`
+
+	// Колонка сравнивается с uuid-параметром без приведения к text; NULL — основное устройство
+	var device any
+	if deviceID != "" {
+		device = deviceID
+	}
+
+	var (
+		id         string
+		signingKey []byte
+	)
+	err := r.db.QueryRow(ctx, query, userID, device).Scan(&id, &signingKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, ErrDeviceNotFound
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("ошибка чтения устройства: %w", err)
+	}
+
+	return id, signingKey, nil
+}
+
+// Revoke отвязывает устройство. Ключи остаются в БД, но токен для него больше не выдаётся.
+func (r *DeviceRepository) Revoke(ctx context.Context, userID, deviceID string) error {
+	if !validUUIDs(userID, deviceID) {
+		return ErrDeviceNotFound
+	}
+
+	query := `
+		UPDATE devices SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, deviceID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка отвязки устройства: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// RotateKeys меняет ключи устройства на change и пишет смену в историю.
+// oldSigningKey — ключ, которым проверен change.Proof: если ключи успели смениться
+// параллельным запросом, возвращается ErrStaleSigningKey.
+// Signed prekey был подписан старым ключом, поэтому удаляется — устройство загружает новый.
+func (r *DeviceRepository) RotateKeys(ctx context.Context, change *domain.KeyChange, oldSigningKey []byte) error {
+	if !validUUIDs(change.UserID, change.DeviceID) {
+		return ErrDeviceNotFound
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current []byte
+	query := `
+		SELECT public_signing_key FROM devices
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+		FOR UPDATE
+	`
+	err = tx.QueryRow(ctx, query, change.DeviceID, change.UserID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrDeviceNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+	if !bytes.Equal(current, oldSigningKey) {
+		return ErrStaleSigningKey
+	}
+
+	// Устройство, созданное до появления истории, сначала получает в ней свои исходные ключи
+	historyQuery := `
+		INSERT INTO user_keys (user_id, device_id, public_identity_key, public_signing_key, created_at)
+		SELECT user_id, id, public_identity_key, public_signing_key, created_at
+		FROM devices d
+		WHERE d.id = $1 AND NOT EXISTS (SELECT 1 FROM user_keys k WHERE k.device_id = d.id)
+	`
+	if _, err := tx.Exec(ctx, historyQuery, change.DeviceID); err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+
+	updateQuery := `UPDATE devices SET public_identity_key = $2, public_signing_key = $3 WHERE id = $1`
+	if _, err := tx.Exec(ctx, updateQuery, change.DeviceID, change.PublicIdentityKey, change.PublicSigningKey); err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+
+	// Ключи аккаунта в users — это ключи основного (самого первого активного) устройства
+	userQuery := `
+		UPDATE users SET public_identity_key = $3, public_signing_key = $4
+		WHERE id = $1 AND $2 = (
+			SELECT id FROM devices WHERE user_id = $1 AND revoked_at IS NULL
+			ORDER BY created_at, id LIMIT 1
+		)
+	`
+	if _, err := tx.Exec(ctx, userQuery, change.UserID, change.DeviceID, change.PublicIdentityKey, change.PublicSigningKey); err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO user_keys (user_id, device_id, public_identity_key, public_signing_key, proof)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	err = tx.QueryRow(ctx, insertQuery,
+		change.UserID,
+		change.DeviceID,
+		change.PublicIdentityKey,
+		change.PublicSigningKey,
+		change.Proof,
+	).Scan(&change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM signed_prekeys WHERE device_id = $1`, change.DeviceID); err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка смены ключей: %w", err)
+	}
+
+	return nil
+}
+
+// KeyHistory возвращает историю ключей устройств юзера, от старых к новым.
+// Для устройств без смен ключей в истории есть только их исходные ключи.
+func (r *DeviceRepository) KeyHistory(ctx context.Context, userID string) ([]domain.KeyChange, error) {
+	query := `
+		SELECT user_id, device_id, public_identity_key, public_signing_key, proof, created_at
+		FROM user_keys
+		WHERE user_id = $1
+		UNION ALL
+		SELECT user_id, id, public_identity_key, public_signing_key, NULL, created_at
+		FROM devices d
+		WHERE d.user_id = $1 AND NOT EXISTS (SELECT 1 FROM user_keys k WHERE k.device_id = d.id)
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения истории ключей: %w", err)
+	}
+	defer rows.Close()
+
+	var history []domain.KeyChange
+	for rows.Next() {
+		var k domain.KeyChange
+		if err := rows.Scan(&k.UserID, &k.DeviceID, &k.PublicIdentityKey, &k.PublicSigningKey, &k.Proof, &k.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения истории ключей: %w", err)
+		}
+		history = append(history, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения истории ключей: %w", err)
+	}
+
+	return history, nil
+}
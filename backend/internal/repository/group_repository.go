@@ -0,0 +1,485 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+)
+
+var (
+	ErrGroupNotFound   = errors.New("группа не найдена")
+	ErrNotGroupMember  = errors.New("юзер не состоит в группе")
+	ErrGroupFull       = fmt.Errorf("в группе не больше %d участников", domain.MaxGroupMembers)
+	ErrMemberNotFound  = errors.New("добавляемый юзер не найден")
+	ErrOwnerCannotMove = errors.New("роль владельца не передаётся сменой роли")
+)
+
+type GroupRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewGroupRepository(db *pgxpool.Pool) *GroupRepository {
+	return &GroupRepository{db: db}
+}
+
+// validUUIDs проверяет, что все id — UUID. Колонки сравниваются с параметрами без приведения
+// к text, иначе не работают индексы, поэтому id другого формата отсекаются до запроса.
+func validUUIDs(ids ...string) bool {
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Create создаёт группу: создатель становится владельцем, memberIDs — участниками.
+// Повторы в memberIDs и сам создатель среди них игнорируются.
+func (r *GroupRepository) Create(ctx context.Context, group *domain.Group, memberIDs []string) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания группы: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO groups (metadata, created_by)
+		VALUES ($1, $2)
+		RETURNING id, created_at, epoch
+	`
+	var epoch int64
+	if err := tx.QueryRow(ctx, query, group.Metadata, group.CreatedBy).Scan(&group.ID, &group.CreatedAt, &epoch); err != nil {
+		return nil, fmt.Errorf("ошибка создания группы: %w", err)
+	}
+
+	ownerQuery := `INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, 'owner')`
+	if _, err := tx.Exec(ctx, ownerQuery, group.ID, group.CreatedBy); err != nil {
+		return nil, fmt.Errorf("ошибка создания группы: %w", err)
+	}
+
+	added, err := addMembers(ctx, tx, group.ID, group.CreatedBy, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка создания группы: %w", err)
+	}
+
+	group.Epoch = uint64(epoch)
+	group.Role = domain.GroupRoleOwner
+	return added, nil
+}
+
+// addMembers добавляет участников под блокировкой строки группы, проверяя лимит размера.
+// Возвращает тех, кого действительно добавили (уже состоящие пропускаются).
+func addMembers(ctx context.Context, tx pgx.Tx, groupID, addedBy string, userIDs []string) ([]string, error) {
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM groups WHERE id = $1 FOR UPDATE`, groupID); err != nil {
+		return nil, fmt.Errorf("ошибка добавления участников: %w", err)
+	}
+
+	query := `
+		INSERT INTO group_members (group_id, user_id, added_by)
+		SELECT $1, u, $2 FROM unnest($3::uuid[]) AS u
+		ON CONFLICT DO NOTHING
+		RETURNING user_id::text
+	`
+	rows, err := tx.Query(ctx, query, groupID, addedBy, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка добавления участников: %w", err)
+	}
+
+	added := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка добавления участников: %w", err)
+		}
+		added = append(added, id)
+	}
+	rows.Close()
+
+	var pgErr *pgconn.PgError
+	if err := rows.Err(); errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+		return nil, ErrMemberNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка добавления участников: %w", err)
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM group_members WHERE group_id = $1`, groupID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("ошибка добавления участников: %w", err)
+	}
+	if count > domain.MaxGroupMembers {
+		return nil, ErrGroupFull
+	}
+
+	return added, nil
+}
+
+// bumpEpoch начинает новую эпоху группы (состав изменился) и возвращает её номер
+func bumpEpoch(ctx context.Context, tx pgx.Tx, groupID string) (uint64, error) {
+	var epoch int64
+	err := tx.QueryRow(ctx, `UPDATE groups SET epoch = epoch + 1 WHERE id = $1 RETURNING epoch`, groupID).Scan(&epoch)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrGroupNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка смены эпохи группы: %w", err)
+	}
+	return uint64(epoch), nil
+}
+
+// AddMembers добавляет участников в существующую группу и, если кто-то добавлен,
+// начинает новую эпоху (иначе epoch == 0)
+func (r *GroupRepository) AddMembers(ctx context.Context, groupID, addedBy string, userIDs []string) (added []string, epoch uint64, err error) {
+	if !validUUIDs(groupID) {
+		return nil, 0, ErrGroupNotFound
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка добавления участников: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	added, err = addMembers(ctx, tx, groupID, addedBy, userIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(added) > 0 {
+		if epoch, err = bumpEpoch(ctx, tx, groupID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, 0, fmt.Errorf("ошибка добавления участников: %w", err)
+	}
+	return added, epoch, nil
+}
+
+// Get возвращает группу с ролью в ней юзера userID. Не участнику — ErrNotGroupMember.
+func (r *GroupRepository) Get(ctx context.Context, groupID, userID string) (*domain.Group, error) {
+	if !validUUIDs(groupID, userID) {
+		return nil, ErrNotGroupMember
+	}
+
+	query := `
+		SELECT g.id, g.metadata, COALESCE(g.created_by::text, ''), g.created_at, g.epoch, gm.role
+		FROM groups g
+		JOIN group_members gm ON gm.group_id = g.id AND gm.user_id = $2
+		WHERE g.id = $1
+	`
+
+	var (
+		group domain.Group
+		epoch int64
+	)
+	err := r.db.QueryRow(ctx, query, groupID, userID).Scan(&group.ID, &group.Metadata, &group.CreatedBy, &group.CreatedAt, &epoch, &group.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotGroupMember
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения группы: %w", err)
+	}
+
+	group.Epoch = uint64(epoch)
+	return &group, nil
+}
+
+// ListByUser возвращает группы юзера, начиная с последних созданных
+func (r *GroupRepository) ListByUser(ctx context.Context, userID string) ([]domain.Group, error) {
+	query := `
+		SELECT g.id, g.metadata, COALESCE(g.created_by::text, ''), g.created_at, g.epoch, gm.role
+		FROM group_members gm
+		JOIN groups g ON g.id = gm.group_id
+		WHERE gm.user_id = $1
+		ORDER BY g.created_at DESC, g.id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения групп: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []domain.Group{}
+	for rows.Next() {
+		var (
+			g     domain.Group
+			epoch int64
+		)
+		if err := rows.Scan(&g.ID, &g.Metadata, &g.CreatedBy, &g.CreatedAt, &epoch, &g.Role); err != nil {
+			return nil, fmt.Errorf("ошибка чтения групп: %w", err)
+		}
+		g.Epoch = uint64(epoch)
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+// Members возвращает участников группы: владелец, админы, затем остальные по времени вступления
+func (r *GroupRepository) Members(ctx context.Context, groupID string) ([]domain.GroupMember, error) {
+	if !validUUIDs(groupID) {
+		return []domain.GroupMember{}, nil
+	}
+
+	query := `
+		SELECT user_id::text, role, COALESCE(added_by::text, ''), joined_at
+		FROM group_members
+		WHERE group_id = $1
+		ORDER BY CASE role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, joined_at, user_id
+	`
+
+	rows, err := r.db.Query(ctx, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения участников: %w", err)
+	}
+	defer rows.Close()
+
+	members := []domain.GroupMember{}
+	for rows.Next() {
+		var m domain.GroupMember
+		if err := rows.Scan(&m.UserID, &m.Role, &m.AddedBy, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения участников: %w", err)
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// MemberIDs возвращает id участников группы (для рассылки)
+func (r *GroupRepository) MemberIDs(ctx context.Context, groupID string) ([]string, error) {
+	if !validUUIDs(groupID) {
+		return nil, nil
+	}
+
+	rows, err := r.db.Query(ctx, `SELECT user_id::text FROM group_members WHERE group_id = $1`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения участников: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка чтения участников: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Role возвращает роль юзера в группе или ErrNotGroupMember
+func (r *GroupRepository) Role(ctx context.Context, groupID, userID string) (domain.GroupRole, error) {
+	if !validUUIDs(groupID, userID) {
+		return "", ErrNotGroupMember
+	}
+
+	var role domain.GroupRole
+	query := `SELECT role FROM group_members WHERE group_id = $1 AND user_id = $2`
+
+	err := r.db.QueryRow(ctx, query, groupID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotGroupMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения роли: %w", err)
+	}
+
+	return role, nil
+}
+
+// Epoch возвращает текущую эпоху группы, если userID в ней состоит, иначе ErrNotGroupMember
+func (r *GroupRepository) Epoch(ctx context.Context, groupID, userID string) (uint64, error) {
+	if !validUUIDs(groupID, userID) {
+		return 0, ErrNotGroupMember
+	}
+
+	var epoch int64
+	query := `
+		SELECT g.epoch FROM groups g
+		JOIN group_members gm ON gm.group_id = g.id AND gm.user_id = $2
+		WHERE g.id = $1
+	`
+
+	err := r.db.QueryRow(ctx, query, groupID, userID).Scan(&epoch)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrNotGroupMember
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения эпохи группы: %w", err)
+	}
+
+	return uint64(epoch), nil
+}
+
+// MemberDevices возвращает активные устройства участников группы —
+// ключ отправителя шифруется под каждое из них
+func (r *GroupRepository) MemberDevices(ctx context.Context, groupID string) ([]domain.Device, error) {
+	if !validUUIDs(groupID) {
+		return []domain.Device{}, nil
+	}
+
+	query := `
+		SELECT d.id::text, d.user_id::text, d.name, d.public_identity_key, d.public_signing_key, d.created_at
+		FROM group_members gm
+		JOIN devices d ON d.user_id = gm.user_id AND d.revoked_at IS NULL
+		WHERE gm.group_id = $1
+		ORDER BY d.user_id, d.created_at, d.id
+	`
+
+	rows, err := r.db.Query(ctx, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения устройств участников: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []domain.Device{}
+	for rows.Next() {
+		var d domain.Device
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Name, &d.PublicIdentityKey, &d.PublicSigningKey, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения устройств участников: %w", err)
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, rows.Err()
+}
+
+// UpdateMetadata заменяет зашифрованные метаданные группы
+func (r *GroupRepository) UpdateMetadata(ctx context.Context, groupID string, metadata []byte) error {
+	if !validUUIDs(groupID) {
+		return ErrGroupNotFound
+	}
+
+	tag, err := r.db.Exec(ctx, `UPDATE groups SET metadata = $2 WHERE id = $1`, groupID, metadata)
+	if err != nil {
+		return fmt.Errorf("ошибка изменения группы: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// SetRole назначает участнику роль admin или member. Владелец меняется только через Leave.
+func (r *GroupRepository) SetRole(ctx context.Context, groupID, userID string, role domain.GroupRole) error {
+	if role == domain.GroupRoleOwner {
+		return ErrOwnerCannotMove
+	}
+	if !validUUIDs(groupID, userID) {
+		return ErrNotGroupMember
+	}
+
+	query := `
+		UPDATE group_members SET role = $3
+		WHERE group_id = $1 AND user_id = $2 AND role <> 'owner'
+	`
+	tag, err := r.db.Exec(ctx, query, groupID, userID, role)
+	if err != nil {
+		return fmt.Errorf("ошибка смены роли: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotGroupMember
+	}
+	return nil
+}
+
+// RemoveMember исключает участника (кроме владельца) и возвращает новую эпоху группы
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID, userID string) (uint64, error) {
+	if !validUUIDs(groupID, userID) {
+		return 0, ErrNotGroupMember
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка исключения участника: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `DELETE FROM group_members WHERE group_id = $1 AND user_id = $2 AND role <> 'owner'`
+	tag, err := tx.Exec(ctx, query, groupID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка исключения участника: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return 0, ErrNotGroupMember
+	}
+
+	epoch, err := bumpEpoch(ctx, tx, groupID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("ошибка исключения участника: %w", err)
+	}
+	return epoch, nil
+}
+
+// Leave — юзер выходит из группы сам. Если выходит владелец, владельцем становится
+// самый давний админ, а если админов нет — самый давний участник.
+// Возвращает нового владельца (пусто, если владелец не менялся или группа опустела) и новую эпоху группы.
+func (r *GroupRepository) Leave(ctx context.Context, groupID, userID string) (newOwner string, epoch uint64, err error) {
+	if !validUUIDs(groupID, userID) {
+		return "", 0, ErrNotGroupMember
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", 0, fmt.Errorf("ошибка выхода из группы: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var role domain.GroupRole
+	query := `
+		DELETE FROM group_members WHERE group_id = $1 AND user_id = $2
+		RETURNING role
+	`
+	err = tx.QueryRow(ctx, query, groupID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, ErrNotGroupMember
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("ошибка выхода из группы: %w", err)
+	}
+
+	if role == domain.GroupRoleOwner {
+		promoteQuery := `
+			UPDATE group_members SET role = 'owner'
+			WHERE (group_id, user_id) = (
+				SELECT group_id, user_id FROM group_members
+				WHERE group_id = $1
+				ORDER BY CASE role WHEN 'admin' THEN 0 ELSE 1 END, joined_at, user_id
+				LIMIT 1
+			)
+			RETURNING user_id::text
+		`
+		err := tx.QueryRow(ctx, promoteQuery, groupID).Scan(&newOwner)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return "", 0, fmt.Errorf("ошибка выхода из группы: %w", err)
+		}
+	}
+
+	if epoch, err = bumpEpoch(ctx, tx, groupID); err != nil {
+		return "", 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", 0, fmt.Errorf("ошибка выхода из группы: %w", err)
+	}
+	return newOwner, epoch, nil
+}
@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/transparency"
+)
+
+var ErrTreeHeadNotFound = errors.New("корень журнала не найден")
+
+// ktLockID — ключ advisory lock: дописывает журнал только один узел за раз
+const ktLockID = 0x6b74_6c6f67 // "ktlog"
+
+// ktBatchSize — сколько новых записей добавляется за один проход
+const ktBatchSize = 1000
+
+// KTRepository — журнал прозрачности ключей.
+// Листья и корни хранятся в БД, дерево для доказательств держится в памяти
+// и догружается из БД перед каждым использованием (журнал могут дописывать другие узлы).
+type KTRepository struct {
+	db     *pgxpool.Pool
+	tree   *transparency.Tree
+	syncMu sync.Mutex
+}
+
+func NewKTRepository(db *pgxpool.Pool) *KTRepository {
+	return &KTRepository{db: db, tree: transparency.NewTree()}
+}
+
+type ktQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Tree догружает новые листья и возвращает дерево журнала
+func (r *KTRepository) Tree(ctx context.Context) (*transparency.Tree, error) {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	if err := r.sync(ctx, r.db); err != nil {
+		return nil, err
+	}
+	return r.tree, nil
+}
+
+// sync дописывает в дерево листья из БД, которых в нём ещё нет. Вызывается под syncMu.
+func (r *KTRepository) sync(ctx context.Context, q ktQuerier) error {
+	rows, err := q.Query(ctx, `SELECT idx, leaf_hash FROM kt_leaves WHERE idx >= $1 ORDER BY idx`, int64(r.tree.Size()))
+	if err != nil {
+		return fmt.Errorf("ошибка чтения журнала ключей: %w", err)
+	}
+	defer rows.Close()
+
+	next := r.tree.Size()
+	for rows.Next() {
+		var idx int64
+		var hash []byte
+		if err := rows.Scan(&idx, &hash); err != nil {
+			return fmt.Errorf("ошибка чтения журнала ключей: %w", err)
+		}
+		if uint64(idx) != next {
+			return fmt.Errorf("журнал ключей повреждён: пропущен лист %d", next)
+		}
+		r.tree.Append(hash)
+		next++
+	}
+	return rows.Err()
+}
+
+type pendingKeys struct {
+	userID, deviceID     string
+	identityKey, signKey []byte
+	lastEpoch            int64
+}
+
+// Sequence публикует в журнале текущие ключи устройств, которых там ещё нет,
+// и подписывает новый корень. Пока ничего не изменилось, возвращает последний корень.
+func (r *KTRepository) Sequence(ctx context.Context, key ed25519.PrivateKey) (*transparency.TreeHead, error) {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка записи в журнал ключей: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, ktLockID); err != nil {
+		return nil, fmt.Errorf("ошибка записи в журнал ключей: %w", err)
+	}
+	if err := r.sync(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	pending, err := r.pending(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	base := r.tree.Size()
+	head, err := r.latestTreeHead(ctx, tx)
+	if err != nil && !errors.Is(err, ErrTreeHeadNotFound) {
+		return nil, err
+	}
+	if len(pending) == 0 && head != nil && head.TreeSize == base {
+		return head, nil
+	}
+
+	epochs := make(map[string]int64)
+	hashes := make([][]byte, 0, len(pending))
+	for i, p := range pending {
+		epoch, ok := epochs[p.userID]
+		if !ok {
+			epoch = p.lastEpoch
+		}
+		epoch++
+		epochs[p.userID] = epoch
+
+		entry, err := transparency.Entry{
+			UserID:      p.userID,
+			DeviceID:    p.deviceID,
+			Epoch:       uint64(epoch),
+			IdentityKey: p.identityKey,
+			SigningKey:  p.signKey,
+		}.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		hash := transparency.LeafHash(entry)
+
+		query := `
+			INSERT INTO kt_leaves (idx, user_id, device_id, epoch, identity_key, signing_key, entry, leaf_hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`
+		_, err = tx.Exec(ctx, query, int64(base)+int64(i), p.userID, p.deviceID, epoch, p.identityKey, p.signKey, entry, hash)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка записи в журнал ключей: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	// Дерево в памяти откатывается, если транзакция не дойдёт до коммита
+	r.tree.Append(hashes...)
+	committed := false
+	defer func() {
+		if !committed {
+			r.tree.Truncate(base)
+		}
+	}()
+
+	size := r.tree.Size()
+	root, err := r.tree.Root(size)
+	if err != nil {
+		return nil, err
+	}
+	head = &transparency.TreeHead{
+		TreeSize:  size,
+		RootHash:  root,
+		Timestamp: time.UnixMilli(time.Now().UnixMilli()),
+	}
+	head.Sign(key)
+
+	query := `
+		INSERT INTO kt_tree_heads (tree_size, root_hash, timestamp_ms, signature)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := tx.Exec(ctx, query, int64(size), head.RootHash, head.Timestamp.UnixMilli(), head.Signature); err != nil {
+		return nil, fmt.Errorf("ошибка записи корня журнала: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка записи в журнал ключей: %w", err)
+	}
+	committed = true
+
+	return head, nil
+}
+
+// pending — активные устройства, чьи текущие ключи не совпадают с их последней записью в журнале
+func (r *KTRepository) pending(ctx context.Context, tx pgx.Tx) ([]pendingKeys, error) {
+	query := `
+		SELECT d.user_id, d.id, d.public_identity_key, d.public_signing_key,
+			COALESCE((SELECT MAX(epoch) FROM kt_leaves l WHERE l.user_id = d.user_id), 0)
+		FROM devices d
+		LEFT JOIN LATERAL (
+			SELECT identity_key, signing_key FROM kt_leaves l
+			WHERE l.device_id = d.id
+			ORDER BY idx DESC
+			LIMIT 1
+		) last ON TRUE
+		WHERE d.revoked_at IS NULL
+			AND (last.identity_key IS DISTINCT FROM d.public_identity_key
+				OR last.signing_key IS DISTINCT FROM d.public_signing_key)
+		ORDER BY d.created_at, d.id
+		LIMIT $1
+	`
+
+	rows, err := tx.Query(ctx, query, ktBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска неопубликованных ключей: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []pendingKeys
+	for rows.Next() {
+		var p pendingKeys
+		if err := rows.Scan(&p.userID, &p.deviceID, &p.identityKey, &p.signKey, &p.lastEpoch); err != nil {
+			return nil, fmt.Errorf("ошибка поиска неопубликованных ключей: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// LatestTreeHead возвращает последний подписанный корень
+func (r *KTRepository) LatestTreeHead(ctx context.Context) (*transparency.TreeHead, error) {
+	return r.latestTreeHead(ctx, r.db)
+}
+
+type ktRowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (r *KTRepository) latestTreeHead(ctx context.Context, q ktRowQuerier) (*transparency.TreeHead, error) {
+	query := `
+		SELECT tree_size, root_hash, timestamp_ms, signature
+		FROM kt_tree_heads
+		ORDER BY tree_size DESC
+		LIMIT 1
+	`
+	return scanTreeHead(q.QueryRow(ctx, query))
+}
+
+// TreeHead возвращает подписанный корень дерева заданного размера
+func (r *KTRepository) TreeHead(ctx context.Context, size uint64) (*transparency.TreeHead, error) {
+	query := `SELECT tree_size, root_hash, timestamp_ms, signature FROM kt_tree_heads WHERE tree_size = $1`
+	return scanTreeHead(r.db.QueryRow(ctx, query, int64(size)))
+}
+
+func scanTreeHead(row pgx.Row) (*transparency.TreeHead, error) {
+	var size, timestamp int64
+	var head transparency.TreeHead
+	if err := row.Scan(&size, &head.RootHash, &timestamp, &head.Signature); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTreeHeadNotFound
+		}
+		return nil, fmt.Errorf("ошибка чтения корня журнала: %w", err)
+	}
+	head.TreeSize = uint64(size)
+	head.Timestamp = time.UnixMilli(timestamp)
+	return &head, nil
+}
+
+// DeviceLeaves возвращает для активных устройств юзера записи журнала с их текущими ключами.
+// Устройства, чьи ключи ещё не опубликованы, в ответ не попадают.
+func (r *KTRepository) DeviceLeaves(ctx context.Context, userID string) ([]domain.LogLeaf, error) {
+	query := `
+		SELECT last.idx, last.epoch, last.entry, d.id
+		FROM devices d
+		JOIN LATERAL (
+			SELECT idx, epoch, entry, identity_key, signing_key FROM kt_leaves l
+			WHERE l.device_id = d.id
+			ORDER BY idx DESC
+			LIMIT 1
+		) last ON last.identity_key = d.public_identity_key AND last.signing_key = d.public_signing_key
+		WHERE d.user_id = $1 AND d.revoked_at IS NULL
+		ORDER BY d.created_at, d.id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения журнала ключей: %w", err)
+	}
+	defer rows.Close()
+
+	var leaves []domain.LogLeaf
+	for rows.Next() {
+		var idx, epoch int64
+		leaf := domain.LogLeaf{UserID: userID}
+		if err := rows.Scan(&idx, &epoch, &leaf.Data, &leaf.DeviceID); err != nil {
+			return nil, fmt.Errorf("ошибка чтения журнала ключей: %w", err)
+		}
+		leaf.Index, leaf.Epoch = uint64(idx), uint64(epoch)
+		leaves = append(leaves, leaf)
+	}
+	return leaves, rows.Err()
+}
+
+// Leaves возвращает записи журнала [start, end) — для аудиторов, которые пересчитывают дерево сами
+func (r *KTRepository) Leaves(ctx context.Context, start, end uint64) ([]domain.LogLeaf, error) {
+	query := `
+		SELECT idx, user_id, device_id, epoch, entry
+		FROM kt_leaves
+		WHERE idx >= $1 AND idx < $2
+		ORDER BY idx
+	`
+
+	rows, err := r.db.Query(ctx, query, int64(start), int64(end))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения журнала ключей: %w", err)
+	}
+	defer rows.Close()
+
+	leaves := []domain.LogLeaf{}
+	for rows.Next() {
+		var idx, epoch int64
+		var leaf domain.LogLeaf
+		if err := rows.Scan(&idx, &leaf.UserID, &leaf.DeviceID, &epoch, &leaf.Data); err != nil {
+			return nil, fmt.Errorf("ошибка чтения журнала ключей: %w", err)
+		}
+		leaf.Index, leaf.Epoch = uint64(idx), uint64(epoch)
+		leaves = append(leaves, leaf)
+	}
+	return leaves, rows.Err()
+}
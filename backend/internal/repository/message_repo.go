@@ -2,13 +2,31 @@ package repository
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
 )
 
+// pgForeignKeyViolation — SQLSTATE нарушения внешнего ключа
+const pgForeignKeyViolation = "23503"
+
+var (
+	ErrInvalidCursor     = errors.New("неверный курсор")
+	ErrInvalidMessageID  = errors.New("id сообщения должен быть UUID")
+	ErrDuplicateMessage  = errors.New("сообщение уже сохранено")
+	ErrMessageIDTaken    = errors.New("id сообщения уже занят")
+	ErrRecipientNotFound = errors.New("получатель не найден")
+)
+
 type MessageRepository struct {
 	db *pgxpool.Pool
 }
@@ -17,20 +35,504 @@ func NewMessageRepository(db *pgxpool.Pool) *MessageRepository {
 	return &MessageRepository{db: db}
 }
 
-// Save сохраняет сообщение из Protobuf в Postgres
+// Save сохраняет сообщение из Protobuf в Postgres.
+// Пока устройство не подтвердило доставку (ACK), сообщение лежит в его офлайн-очереди.
+//
+// Клиенты повторяют отправку, если не получили ACK, поэтому повтор того же id от того же
+// отправителя не считается ошибкой сохранения: Save возвращает ErrDuplicateMessage.
+// Если получателя нет в БД — ErrRecipientNotFound, если группы — ErrGroupNotFound.
+// Сообщение группы (group_id) сохраняется одной строкой без получателя;
+// с recipient_device_id — только для одного устройства получателя.
+// Вложения (attachment_ids) привязываются в той же транзакции; чужие или не загруженные — ErrAttachmentNotFound.
+// created_at ставит БД: timestamp клиента сохраняется только как метаданные (sent_at).
 func (r *MessageRepository) Save(ctx context.Context, msg *pb.WebSocketMessage) error {
+	if _, err := uuid.Parse(msg.Id); err != nil {
+		return ErrInvalidMessageID
+	}
+	if msg.RecipientId != "" {
+		if _, err := uuid.Parse(msg.RecipientId); err != nil {
+			return ErrRecipientNotFound
+		}
+	}
+	if msg.RecipientDeviceId != "" {
+		if _, err := uuid.Parse(msg.RecipientDeviceId); err != nil {
+			return ErrRecipientNotFound
+		}
+	}
+	if msg.GroupId != "" {
+		if _, err := uuid.Parse(msg.GroupId); err != nil {
+			return ErrGroupNotFound
+		}
+	}
+
 	query := `
-		INSERT INTO messages (id, type, payload, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO messages (id, type, payload, sender_id, recipient_id, sender_device_id, created_at, sent_at,
+			group_id, group_epoch, recipient_device_id)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, NULLIF($6, '')::uuid, NOW(), NULLIF($7::bigint, 0),
+			NULLIF($8, '')::uuid, NULLIF($9::bigint, 0), NULLIF($10, '')::uuid)
+		ON CONFLICT (id) DO NOTHING
 	`
-	
-	// Конвертируем Unix timestamp (int64) в time.Time
-	createdAt := time.Unix(msg.Timestamp, 0)
 
-	_, err := r.db.Exec(ctx, query, msg.Id, msg.Type, msg.Payload, createdAt)
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("ошибка сохранения сообщения: %w", err)
 	}
-	
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, query,
+		msg.Id,
+		msg.Type,
+		msg.Payload,
+		msg.SenderId,
+		msg.RecipientId,
+		msg.SenderDeviceId,
+		msg.Timestamp,
+		msg.GroupId,
+		int64(msg.GroupEpoch),
+		msg.RecipientDeviceId,
+	)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+		if pgErr.ConstraintName == "messages_group_id_fkey" {
+			return ErrGroupNotFound
+		}
+		return ErrRecipientNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения сообщения: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return r.checkDuplicate(ctx, msg.Id, msg.SenderId)
+	}
+
+	if len(msg.AttachmentIds) > 0 {
+		if err := linkAttachments(ctx, tx, msg.Id, msg.SenderId, msg.AttachmentIds); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка сохранения сообщения: %w", err)
+	}
+	return nil
+}
+
+// checkDuplicate разбирает конфликт по id: повтор от того же отправителя — ErrDuplicateMessage,
+// чужой id — ErrMessageIDTaken (второе сообщение с тем же id сохранять нельзя).
+// У событий группы отправителя нет: их id занят для любого отправителя.
+func (r *MessageRepository) checkDuplicate(ctx context.Context, messageID, senderID string) error {
+	var sameSender bool
+	query := `SELECT COALESCE(sender_id = NULLIF($2, '')::uuid, false) FROM messages WHERE id = $1`
+
+	err := r.db.QueryRow(ctx, query, messageID, senderID).Scan(&sameSender)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения сообщения: %w", err)
+	}
+
+	if !sameSender {
+		return ErrMessageIDTaken
+	}
+	return ErrDuplicateMessage
+}
+
+// GetPending возвращает недоставленные на устройство сообщения в порядке отправки:
+// входящие юзеру (адресованные конкретному устройству — только ему), исходящие с его других
+// устройств (синхронизация отправленного) и сообщения его групп, отправленные после его вступления в группу.
+// Устройство получает только то, что пришло после его привязки.
+func (r *MessageRepository) GetPending(ctx context.Context, userID, deviceID string) ([]*pb.WebSocketMessage, error) {
+	query := `
+		SELECT m.id::text, m.type, m.payload, COALESCE(m.sender_id::text, ''),
+			COALESCE(m.recipient_id::text, ''), COALESCE(m.sender_device_id::text, ''), m.created_at, m.sent_at,
+			COALESCE(m.group_id::text, ''), COALESCE(m.group_epoch, 0), COALESCE(m.recipient_device_id::text, '')
+		FROM messages m
+		JOIN devices d ON d.id = $2
+		WHERE ((m.recipient_id = $1 AND (m.recipient_device_id IS NULL OR m.recipient_device_id = d.id))
+				OR (m.sender_id = $1 AND m.recipient_id IS NOT NULL AND m.recipient_device_id IS NULL
+					AND m.sender_device_id IS DISTINCT FROM d.id)
+				OR (m.recipient_id IS NULL AND m.group_id IS NOT NULL AND m.sender_device_id IS DISTINCT FROM d.id
+					AND EXISTS (
+						SELECT 1 FROM group_members gm
+						WHERE gm.group_id = m.group_id AND gm.user_id = $1 AND gm.joined_at <= m.created_at
+					)))
+			AND m.created_at >= d.created_at
+			AND NOT EXISTS (
+				SELECT 1 FROM message_deliveries md
+				WHERE md.message_id = m.id AND md.device_id = d.id
+			)
+		ORDER BY m.created_at, m.id
+	`
+
+	rows, err := r.db.Query(ctx, query, userID, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения офлайн-очереди: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения офлайн-очереди: %w", err)
+	}
+
+	return messages, nil
+}
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 200
+)
+
+// HistoryLimit приводит запрошенный размер страницы к допустимому
+func HistoryLimit(n int) int {
+	if n <= 0 {
+		return DefaultHistoryLimit
+	}
+	if n > MaxHistoryLimit {
+		return MaxHistoryLimit
+	}
+	return n
+}
+
+// MessageCursor — позиция в истории: последнее отданное сообщение страницы
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// EncodeCursor упаковывает курсор в непрозрачную строку для клиента
+func EncodeCursor(cur MessageCursor) string {
+	raw := fmt.Sprintf("%d:%s", cur.CreatedAt.UnixNano(), cur.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor разбирает курсор, полученный от клиента
+func DecodeCursor(s string) (MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return MessageCursor{}, ErrInvalidCursor
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return MessageCursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return MessageCursor{}, ErrInvalidCursor
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return MessageCursor{}, ErrInvalidCursor
+	}
+
+	// uuid.Parse принимает и {…}, и urn:uuid:…, а в запрос id уходит в каноническом виде
+	return MessageCursor{CreatedAt: time.Unix(0, n), ID: parsed.String()}, nil
+}
+
+// History возвращает страницу переписки юзера от новых к старым (keyset по created_at, id)
+// и курсор следующей страницы (пустой, если сообщений больше нет).
+// peerID ограничивает историю диалогом с одним собеседником, before — курсор предыдущей страницы.
+// Без groupID отдаются только личные сообщения; с groupID — сообщения группы,
+// отправленные после вступления юзера в неё (не участнику — пустая страница).
+func (r *MessageRepository) History(ctx context.Context, userID, peerID, groupID string, before *MessageCursor, limit int) ([]*pb.WebSocketMessage, string, error) {
+	// Колонки сравниваются с uuid-параметром без приведения к text, иначе не работают индексы
+	if (peerID != "" && !validUUIDs(peerID)) || (groupID != "" && !validUUIDs(groupID)) {
+		return nil, "", nil
+	}
+
+	// Несколько вариантов фильтра, чтобы планировщик мог использовать индексы по sender_id/recipient_id/group_id.
+	// Собеседник или группа передаются пятым параметром, только если фильтр на них ссылается.
+	filter := `(m.sender_id = $1 OR m.recipient_id = $1) AND m.group_id IS NULL`
+	target := peerID
+	switch {
+	case groupID != "":
+		filter = `m.group_id = $5::uuid AND m.recipient_id IS NULL
+			AND EXISTS (
+				SELECT 1 FROM group_members gm
+				WHERE gm.group_id = m.group_id AND gm.user_id = $1 AND gm.joined_at <= m.created_at
+			)`
+		target = groupID
+	case peerID != "":
+		filter = `((m.sender_id = $1 AND m.recipient_id = $5::uuid) OR (m.recipient_id = $1 AND m.sender_id = $5::uuid))
+			AND m.group_id IS NULL`
+	}
+
+	query := `
+		SELECT m.id::text, m.type, m.payload, COALESCE(m.sender_id::text, ''),
+			COALESCE(m.recipient_id::text, ''), COALESCE(m.sender_device_id::text, ''), m.created_at, m.sent_at,
+			COALESCE(m.group_id::text, ''), COALESCE(m.group_epoch, 0), COALESCE(m.recipient_device_id::text, '')
+		FROM messages m
+		WHERE ` + filter + `
+			AND ($2::timestamptz IS NULL OR (m.created_at, m.id) < ($2, $3::uuid))
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $4
+	`
+
+	var (
+		cursorTime *time.Time
+		cursorID   *string
+	)
+	if before != nil {
+		cursorTime, cursorID = &before.CreatedAt, &before.ID
+	}
+
+	args := []any{userID, cursorTime, cursorID, limit}
+	if target != "" {
+		args = append(args, target)
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("ошибка чтения истории: %w", err)
+	}
+	defer rows.Close()
+
+	messages, createdAt, err := scanMessagesAt(rows)
+	if err != nil {
+		return nil, "", fmt.Errorf("ошибка чтения истории: %w", err)
+	}
+
+	// Неполная страница — дальше ничего нет
+	if len(messages) < limit {
+		return messages, "", nil
+	}
+
+	last := len(messages) - 1
+	next := EncodeCursor(MessageCursor{CreatedAt: createdAt[last], ID: messages[last].Id})
+
+	return messages, next, nil
+}
+
+// AreContacts проверяет, считает ли userID юзера otherID своим контактом (настройка приватности
+// "только контакты"): userID сам писал ему лично или сам добавил его в группу.
+// Входящие сообщения и добавление в группу чужими руками не в счёт — иначе контактом
+// становился бы любой, кто написал первым. Служебные кадры (KEY_CHANGED и т. п.) тоже не в счёт.
+func (r *MessageRepository) AreContacts(ctx context.Context, userID, otherID string) (bool, error) {
+	if !validUUIDs(userID, otherID) {
+		return false, nil
+	}
+
+	var ok bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM messages
+			WHERE sender_id = $1 AND recipient_id = $2 AND group_id IS NULL AND type = ANY($3)
+		) OR EXISTS (
+			SELECT 1 FROM group_members
+			WHERE user_id = $2 AND added_by = $1
+		)
+	`
+
+	contentTypes := []int32{int32(pb.WebSocketMessage_TEXT_MESSAGE), int32(pb.WebSocketMessage_ATTACHMENT)}
+	if err := r.db.QueryRow(ctx, query, userID, otherID, contentTypes).Scan(&ok); err != nil {
+		return false, fmt.Errorf("ошибка проверки контакта: %w", err)
+	}
+
+	return ok, nil
+}
+
+// Contacts возвращает всех, с кем у юзера есть переписка или общая группа
+func (r *MessageRepository) Contacts(ctx context.Context, userID string) ([]string, error) {
+	query := `
+		SELECT recipient_id::text FROM messages WHERE sender_id = $1 AND recipient_id IS NOT NULL
+		UNION
+		SELECT sender_id::text FROM messages WHERE recipient_id = $1 AND sender_id IS NOT NULL
+		UNION
+		SELECT b.user_id::text FROM group_members a
+		JOIN group_members b ON b.group_id = a.group_id
+		WHERE a.user_id = $1
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения контактов: %w", err)
+	}
+	defer rows.Close()
+
+	var contacts []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка чтения контактов: %w", err)
+		}
+		if id != userID {
+			contacts = append(contacts, id)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения контактов: %w", err)
+	}
+
+	return contacts, nil
+}
+
+// scanMessages читает строки вида
+// (id, type, payload, sender_id, recipient_id, sender_device_id, created_at, sent_at, group_id, group_epoch, recipient_device_id).
+// Timestamp сообщения — время отправки по часам клиента, а если его нет — created_at.
+func scanMessages(rows pgx.Rows) ([]*pb.WebSocketMessage, error) {
+	messages, _, err := scanMessagesAt(rows)
+	return messages, err
+}
+
+// scanMessagesAt — scanMessages, который возвращает ещё и серверный created_at каждого сообщения (для курсора)
+func scanMessagesAt(rows pgx.Rows) ([]*pb.WebSocketMessage, []time.Time, error) {
+	var (
+		messages []*pb.WebSocketMessage
+		created  []time.Time
+	)
+	for rows.Next() {
+		var (
+			msg       pb.WebSocketMessage
+			msgType   int32
+			createdAt time.Time
+			sentAt    *int64
+			epoch     int64
+		)
+		if err := rows.Scan(&msg.Id, &msgType, &msg.Payload, &msg.SenderId, &msg.RecipientId, &msg.SenderDeviceId, &createdAt, &sentAt,
+			&msg.GroupId, &epoch, &msg.RecipientDeviceId); err != nil {
+			return nil, nil, err
+		}
+		msg.Type = pb.WebSocketMessage_Type(msgType)
+		msg.GroupEpoch = uint64(epoch)
+		msg.Timestamp = createdAt.Unix()
+		if sentAt != nil {
+			msg.Timestamp = *sentAt
+		}
+		messages = append(messages, &msg)
+		created = append(created, createdAt)
+	}
+
+	return messages, created, rows.Err()
+}
+
+// MarkDelivered фиксирует доставку сообщения на устройство (пришёл ACK).
+// Возвращает отправителя, которому нужно переслать квитанцию,
+// или пустую строку, если статус сообщения не изменился.
+// Квитанция уходит, когда сообщение впервые дошло хотя бы до одного устройства получателя.
+// Для сообщений групп фиксируется только доставка на устройство: квитанции отправителю не пересылаются.
+func (r *MessageRepository) MarkDelivered(ctx context.Context, messageID, userID, deviceID string) (string, error) {
+	query := `
+		WITH delivery AS (
+			INSERT INTO message_deliveries (message_id, device_id)
+			SELECT id, $3 FROM messages m
+			WHERE id = $1 AND (recipient_id = $2 OR sender_id = $2
+				OR (recipient_id IS NULL AND EXISTS (
+					SELECT 1 FROM group_members gm WHERE gm.group_id = m.group_id AND gm.user_id = $2
+				)))
+			ON CONFLICT DO NOTHING
+		)
+		UPDATE messages SET delivered_at = NOW(), receipt_pending = TRUE
+		WHERE id = $1 AND recipient_id = $2 AND group_id IS NULL AND delivered_at IS NULL
+		RETURNING COALESCE(sender_id::text, '')
+	`
+
+	return r.updateStatus(ctx, query, messageID, userID, deviceID)
+}
+
+// MarkRead помечает сообщение прочитанным (прочитанное считается и доставленным)
+func (r *MessageRepository) MarkRead(ctx context.Context, messageID, userID, deviceID string) (string, error) {
+	query := `
+		WITH delivery AS (
+			INSERT INTO message_deliveries (message_id, device_id)
+			SELECT id, $3 FROM messages m
+			WHERE id = $1 AND (recipient_id = $2 OR sender_id = $2
+				OR (recipient_id IS NULL AND EXISTS (
+					SELECT 1 FROM group_members gm WHERE gm.group_id = m.group_id AND gm.user_id = $2
+				)))
+			ON CONFLICT DO NOTHING
+		)
+		UPDATE messages
+		SET read_at = NOW(), delivered_at = COALESCE(delivered_at, NOW()), receipt_pending = TRUE
+		WHERE id = $1 AND recipient_id = $2 AND group_id IS NULL AND read_at IS NULL
+		RETURNING COALESCE(sender_id::text, '')
+	`
+
+	return r.updateStatus(ctx, query, messageID, userID, deviceID)
+}
+
+func (r *MessageRepository) updateStatus(ctx context.Context, query, messageID, userID, deviceID string) (string, error) {
+	var senderID string
+	err := r.db.QueryRow(ctx, query, messageID, userID, deviceID).Scan(&senderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка обновления статуса сообщения: %w", err)
+	}
+
+	return senderID, nil
+}
+
+// GetPendingReceipts возвращает квитанции, которые устройство отправителя deviceID ещё не получило
+// (оно было офлайн, когда получатель подтвердил доставку или прочтение)
+func (r *MessageRepository) GetPendingReceipts(ctx context.Context, senderID, deviceID string) ([]*pb.AckPayload, error) {
+	query := `
+		SELECT m.id::text, m.recipient_id::text, m.read_at IS NOT NULL
+		FROM messages m
+		WHERE m.sender_id = $1 AND m.receipt_pending
+			AND NOT EXISTS (
+				SELECT 1 FROM receipt_deliveries rd
+				WHERE rd.message_id = m.id AND rd.device_id = $2 AND (rd.read OR m.read_at IS NULL)
+			)
+		ORDER BY m.created_at, m.id
+	`
+
+	rows, err := r.db.Query(ctx, query, senderID, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения квитанций: %w", err)
+	}
+	defer rows.Close()
+
+	var receipts []*pb.AckPayload
+	for rows.Next() {
+		var (
+			ack  pb.AckPayload
+			read bool
+		)
+		if err := rows.Scan(&ack.MessageId, &ack.SenderId, &read); err != nil {
+			return nil, fmt.Errorf("ошибка чтения квитанций: %w", err)
+		}
+		if read {
+			ack.Status = pb.AckPayload_READ
+		}
+		receipts = append(receipts, &ack)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения квитанций: %w", err)
+	}
+
+	return receipts, nil
+}
+
+// ClearReceipt отмечает, что устройство отправителя deviceID получило квитанцию со статусом status.
+// Квитанция перестаёт ждать, когда её получили все активные устройства отправителя;
+// если за это время сообщение успели прочитать, квитанция READ остаётся в ожидании.
+func (r *MessageRepository) ClearReceipt(ctx context.Context, messageID, deviceID string, status pb.AckPayload_Status) error {
+	query := `
+		WITH receipt AS (
+			INSERT INTO receipt_deliveries (message_id, device_id, read)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (message_id, device_id) DO UPDATE SET read = receipt_deliveries.read OR EXCLUDED.read
+		)
+		UPDATE messages m SET receipt_pending = FALSE
+		WHERE m.id = $1 AND ($3 OR m.read_at IS NULL)
+			AND NOT EXISTS (
+				SELECT 1 FROM devices d
+				WHERE d.user_id = m.sender_id AND d.revoked_at IS NULL AND d.id <> $2
+					AND NOT EXISTS (
+						SELECT 1 FROM receipt_deliveries rd
+						WHERE rd.message_id = m.id AND rd.device_id = d.id AND (rd.read OR m.read_at IS NULL)
+					)
+			)
+	`
+
+	_, err := r.db.Exec(ctx, query, messageID, deviceID, status == pb.AckPayload_READ)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления квитанции: %w", err)
+	}
+
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/yerkebulanrai/securemesh/backend/pkg/database"
+	pb "github.com/yerkebulanrai/securemesh/backend/pkg/proto"
+)
+
+// testDB подключается к TEST_DATABASE_URL и применяет миграции. Без переменной тест пропускается:
+// база должна быть отдельной, тесты пишут в неё данные.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrator, err := database.NewMigrator(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// Событие группы сохранено без отправителя: чужое сообщение с его id — ErrMessageIDTaken,
+// а не ошибка чтения NULL
+func TestSaveIDTakenBySenderlessEvent(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	var userID, groupID string
+	err := db.QueryRow(ctx, `
+		INSERT INTO users (username_hash, public_identity_key) VALUES ($1, '\x00')
+		RETURNING id::text
+	`, "test-"+uuid.NewString()).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(ctx, `INSERT INTO groups DEFAULT VALUES RETURNING id::text`).Scan(&groupID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Exec(context.Background(), `DELETE FROM groups WHERE id = $1`, groupID)
+		db.Exec(context.Background(), `DELETE FROM messages WHERE sender_id = $1`, userID)
+		db.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, userID)
+	})
+
+	repo := NewMessageRepository(db)
+	event := &pb.WebSocketMessage{
+		Type:      pb.WebSocketMessage_GROUP_EVENT,
+		Id:        uuid.NewString(),
+		Payload:   []byte("event"),
+		Timestamp: time.Now().Unix(),
+		GroupId:   groupID,
+	}
+	if err := repo.Save(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		senderID string
+		want     error
+	}{
+		{"another sender", userID, ErrMessageIDTaken},
+		{"no sender", "", ErrMessageIDTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &pb.WebSocketMessage{
+				Type:     pb.WebSocketMessage_TEXT_MESSAGE,
+				Id:       event.Id,
+				Payload:  []byte("text"),
+				SenderId: tt.senderID,
+				GroupId:  groupID,
+			}
+			if err := repo.Save(ctx, msg); !errors.Is(err, tt.want) {
+				t.Errorf("Save() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Повтор сообщения тем же отправителем по-прежнему ErrDuplicateMessage
+	own := &pb.WebSocketMessage{
+		Type:     pb.WebSocketMessage_TEXT_MESSAGE,
+		Id:       uuid.NewString(),
+		Payload:  []byte("text"),
+		SenderId: userID,
+		GroupId:  groupID,
+	}
+	if err := repo.Save(ctx, own); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Save(ctx, own); !errors.Is(err, ErrDuplicateMessage) {
+		t.Errorf("Save() of a retry error = %v, want ErrDuplicateMessage", err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []MessageCursor{
+		{CreatedAt: time.Date(2024, 5, 1, 12, 30, 45, 123456000, time.UTC), ID: "7d444840-9dc0-11d1-b245-5ffdce74fad2"},
+		{CreatedAt: time.Unix(0, 0), ID: "00000000-0000-0000-0000-000000000000"},
+		{CreatedAt: time.Unix(-1, 0), ID: "ffffffff-ffff-ffff-ffff-ffffffffffff"},
+	}
+	for _, cur := range tests {
+		encoded := EncodeCursor(cur)
+		got, err := DecodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("DecodeCursor(EncodeCursor(%v)): %v", cur, err)
+		}
+		if !got.CreatedAt.Equal(cur.CreatedAt) || got.ID != cur.ID {
+			t.Errorf("DecodeCursor(EncodeCursor(%v)) = %v", cur, got)
+		}
+	}
+}
+
+// Курсор приводит id к каноническому виду: в запрос не уходят {…} и urn:uuid:…
+func TestDecodeCursorCanonicalizesID(t *testing.T) {
+	const want = "7d444840-9dc0-11d1-b245-5ffdce74fad2"
+	for _, id := range []string{
+		"7D444840-9DC0-11D1-B245-5FFDCE74FAD2",
+		"{7d444840-9dc0-11d1-b245-5ffdce74fad2}",
+		"urn:uuid:7d444840-9dc0-11d1-b245-5ffdce74fad2",
+		"7d4448409dc011d1b2455ffdce74fad2",
+	} {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte("1714566645000000000:" + id))
+		got, err := DecodeCursor(cursor)
+		if err != nil {
+			t.Fatalf("DecodeCursor(%q): %v", id, err)
+		}
+		if got.ID != want {
+			t.Errorf("DecodeCursor(%q).ID = %q, want %q", id, got.ID, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsMalformed(t *testing.T) {
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	valid := EncodeCursor(MessageCursor{CreatedAt: time.Unix(1714566645, 0), ID: "7d444840-9dc0-11d1-b245-5ffdce74fad2"})
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"padded", base64.URLEncoding.EncodeToString([]byte("1714566645000000000:7d444840-9dc0-11d1-b245-5ffdce74fad2"))},
+		{"std alphabet", valid + "+/"},
+		{"no separator", raw("1714566645000000000")},
+		{"no time", raw(":7d444840-9dc0-11d1-b245-5ffdce74fad2")},
+		{"time not a number", raw("yesterday:7d444840-9dc0-11d1-b245-5ffdce74fad2")},
+		{"time overflow", raw("99999999999999999999:7d444840-9dc0-11d1-b245-5ffdce74fad2")},
+		{"no id", raw("1714566645000000000:")},
+		{"id not a uuid", raw("1714566645000000000:'; DROP TABLE messages; --")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur, err := DecodeCursor(tt.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) = %v, %v; want ErrInvalidCursor", tt.cursor, cur, err)
+			}
+		})
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	tests := []struct{ in, want int }{
+		{-1, DefaultHistoryLimit},
+		{0, DefaultHistoryLimit},
+		{1, 1},
+		{MaxHistoryLimit, MaxHistoryLimit},
+		{MaxHistoryLimit + 1, MaxHistoryLimit},
+	}
+	for _, tt := range tests {
+		if got := HistoryLimit(tt.in); got != tt.want {
+			t.Errorf("HistoryLimit(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+)
+
+var ErrPreKeyNotFound = errors.New("signed prekey не загружен")
+
+type PreKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPreKeyRepository(db *pgxpool.Pool) *PreKeyRepository {
+	return &PreKeyRepository{db: db}
+}
+
+// SetSignedPreKey сохраняет signed prekey устройства, заменяя предыдущий
+func (r *PreKeyRepository) SetSignedPreKey(ctx context.Context, key *domain.SignedPreKey) error {
+	query := `
+		INSERT INTO signed_prekeys (device_id, key_id, public_key, signature)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (device_id) DO UPDATE
+		SET key_id = EXCLUDED.key_id,
+			public_key = EXCLUDED.public_key,
+			signature = EXCLUDED.signature,
+			created_at = NOW()
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRow(ctx, query,
+		key.DeviceID,
+		key.KeyID,
+		key.PublicKey,
+		key.Signature,
+	).Scan(&key.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения signed prekey: %w", err)
+	}
+
+	return nil
+}
+
+// AddOneTimePreKeys добавляет пачку одноразовых ключей.
+// Ключи с уже загруженным key_id пропускаются. Возвращает число добавленных.
+func (r *PreKeyRepository) AddOneTimePreKeys(ctx context.Context, keys []domain.OneTimePreKey) (int64, error) {
+	query := `
+		INSERT INTO one_time_prekeys (device_id, key_id, public_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (device_id, key_id) DO NOTHING
+	`
+
+	batch := &pgx.Batch{}
+	for _, key := range keys {
+		batch.Queue(query, key.DeviceID, key.KeyID, key.PublicKey)
+	}
+
+	results := r.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	var added int64
+	for range keys {
+		tag, err := results.Exec()
+		if err != nil {
+			return added, fmt.Errorf("ошибка сохранения one-time prekeys: %w", err)
+		}
+		added += tag.RowsAffected()
+	}
+
+	return added, nil
+}
+
+// CountOneTimePreKeys возвращает, сколько одноразовых ключей у устройства осталось
+func (r *PreKeyRepository) CountOneTimePreKeys(ctx context.Context, deviceID string) (int64, error) {
+	var count int64
+	query := `SELECT COUNT(*) FROM one_time_prekeys WHERE device_id = $1`
+
+	if err := r.db.QueryRow(ctx, query, deviceID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка подсчёта one-time prekeys: %w", err)
+	}
+
+	return count, nil
+}
+
+// TakeBundle возвращает signed prekey устройства и атомарно забирает один одноразовый ключ.
+// Если одноразовые ключи закончились, второй результат — nil (X3DH работает и без него).
+func (r *PreKeyRepository) TakeBundle(ctx context.Context, deviceID string) (*domain.SignedPreKey, *domain.OneTimePreKey, error) {
+	signed := domain.SignedPreKey{DeviceID: deviceID}
+	query := `
+		SELECT key_id, public_key, signature, created_at
+		FROM signed_prekeys
+		WHERE device_id = $1
+	`
+
+	err := r.db.QueryRow(ctx, query, deviceID).Scan(
+		&signed.KeyID,
+		&signed.PublicKey,
+		&signed.Signature,
+		&signed.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrPreKeyNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения signed prekey: %w", err)
+	}
+
+	// SKIP LOCKED: параллельные запросы бандла не получат один и тот же ключ
+	takeQuery := `
+		DELETE FROM one_time_prekeys
+		WHERE (device_id, key_id) = (
+			SELECT device_id, key_id FROM one_time_prekeys
+			WHERE device_id = $1
+			ORDER BY key_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING key_id, public_key
+	`
+
+	oneTime := domain.OneTimePreKey{DeviceID: deviceID}
+	err = r.db.QueryRow(ctx, takeQuery, deviceID).Scan(&oneTime.KeyID, &oneTime.PublicKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &signed, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка выдачи one-time prekey: %w", err)
+	}
+
+	return &signed, &oneTime, nil
+}
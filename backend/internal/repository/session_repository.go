@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh-токен недействителен")
+	ErrRefreshTokenReused  = errors.New("refresh-токен использован повторно, сессия отозвана")
+	ErrSessionNotFound     = errors.New("сессия не найдена")
+)
+
+type SessionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepository(db *pgxpool.Pool) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create начинает новую сессию устройства с первым refresh-токеном. Возвращает id сессии.
+func (r *SessionRepository) Create(ctx context.Context, userID, deviceID string, tokenHash []byte, expiresAt time.Time) (string, error) {
+	query := `
+		INSERT INTO refresh_tokens (family_id, user_id, device_id, token_hash, expires_at)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4)
+		RETURNING family_id
+	`
+
+	var sessionID string
+	err := r.db.QueryRow(ctx, query, userID, deviceID, tokenHash, expiresAt).Scan(&sessionID)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания сессии: %w", err)
+	}
+
+	return sessionID, nil
+}
+
+// Rotate обменивает refresh-токен на новый в той же сессии.
+// Повторное предъявление уже обменянного токена означает утечку:
+// вся сессия отзывается, возвращается ErrRefreshTokenReused.
+func (r *SessionRepository) Rotate(ctx context.Context, oldHash, newHash []byte, expiresAt time.Time) (*domain.RefreshGrant, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления сессии: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT rt.id, rt.family_id, rt.user_id, rt.device_id,
+			rt.used_at IS NOT NULL, rt.revoked_at IS NOT NULL OR rt.expires_at <= NOW() OR d.revoked_at IS NOT NULL
+		FROM refresh_tokens rt
+		JOIN devices d ON d.id = rt.device_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt
+	`
+
+	var (
+		tokenID      string
+		grant        domain.RefreshGrant
+		used, closed bool
+	)
+	err = tx.QueryRow(ctx, query, oldHash).Scan(&tokenID, &grant.SessionID, &grant.UserID, &grant.DeviceID, &used, &closed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления сессии: %w", err)
+	}
+
+	if closed {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if used {
+		revokeQuery := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+		if _, err := tx.Exec(ctx, revokeQuery, grant.SessionID); err != nil {
+			return nil, fmt.Errorf("ошибка отзыва сессии: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("ошибка отзыва сессии: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, tokenID); err != nil {
+		return nil, fmt.Errorf("ошибка обновления сессии: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO refresh_tokens (family_id, user_id, device_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.Exec(ctx, insertQuery, grant.SessionID, grant.UserID, grant.DeviceID, newHash, expiresAt); err != nil {
+		return nil, fmt.Errorf("ошибка обновления сессии: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка обновления сессии: %w", err)
+	}
+
+	return &grant, nil
+}
+
+// ListActive возвращает действующие сессии юзера: у каждой есть неиспользованный и не истёкший токен
+func (r *SessionRepository) ListActive(ctx context.Context, userID string) ([]domain.Session, error) {
+	query := `
+		SELECT rt.family_id, rt.device_id, d.name,
+			(SELECT MIN(created_at) FROM refresh_tokens f WHERE f.family_id = rt.family_id),
+			rt.created_at, rt.expires_at
+		FROM refresh_tokens rt
+		JOIN devices d ON d.id = rt.device_id
+		WHERE rt.user_id = $1
+			AND rt.used_at IS NULL AND rt.revoked_at IS NULL AND rt.expires_at > NOW()
+			AND d.revoked_at IS NULL
+		ORDER BY rt.created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения сессий: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		var s domain.Session
+		if err := rows.Scan(&s.ID, &s.DeviceID, &s.DeviceName, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения сессий: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка чтения сессий: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// Revoke отзывает сессию целиком: ни один её refresh-токен больше не обменяется.
+// Возвращает устройство сессии, чтобы закрыть его соединения.
+func (r *SessionRepository) Revoke(ctx context.Context, userID, sessionID string) (string, error) {
+	if !validUUIDs(sessionID) {
+		return "", ErrSessionNotFound
+	}
+
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL
+		RETURNING device_id::text
+	`
+
+	rows, err := r.db.Query(ctx, query, sessionID, userID)
+	if err != nil {
+		return "", fmt.Errorf("ошибка отзыва сессии: %w", err)
+	}
+	defer rows.Close()
+
+	var deviceID string
+	for rows.Next() {
+		if err := rows.Scan(&deviceID); err != nil {
+			return "", fmt.Errorf("ошибка отзыва сессии: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("ошибка отзыва сессии: %w", err)
+	}
+	if deviceID == "" {
+		return "", ErrSessionNotFound
+	}
+
+	return deviceID, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/pkg/auth"
+)
+
+// TokenRepository — список отзыва JWT.
+// Подпись и срок токена проверяет pkg/auth, здесь — то, что могло измениться после выдачи.
+type TokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTokenRepository(db *pgxpool.Pool) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+// Revoke отзывает один токен по jti. Запись живёт, пока токен не истёк бы сам.
+func (r *TokenRepository) Revoke(ctx context.Context, claims *auth.Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	if _, err := r.db.Exec(ctx, query, claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		return fmt.Errorf("ошибка отзыва токена: %w", err)
+	}
+
+	// Истёкшие токены отклоняются и без списка
+	if _, err := r.db.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("ошибка очистки отозванных токенов: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAll — "выйти везде": все JWT юзера, выданные до этого момента, и все его сессии.
+// iat в токене с точностью до секунды, поэтому граница округляется вверх:
+// токен, выданный в ту же секунду сразу после выхода, тоже будет отклонён.
+func (r *TokenRepository) RevokeAll(ctx context.Context, userID string) error {
+	if !validUUIDs(userID) {
+		return ErrUserNotFound
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка выхода со всех устройств: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users SET tokens_valid_after = date_trunc('second', NOW()) + INTERVAL '1 second'
+		WHERE id = $1
+	`
+	tag, err := tx.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка выхода со всех устройств: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	sessionsQuery := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, sessionsQuery, userID); err != nil {
+		return fmt.Errorf("ошибка выхода со всех устройств: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка выхода со всех устройств: %w", err)
+	}
+
+	return nil
+}
+
+// IsRevoked проверяет, не отозван ли токен: по jti, через "выйти везде",
+// вместе с сессией, выдавшей его, или вместе с устройством.
+func (r *TokenRepository) IsRevoked(ctx context.Context, claims *auth.Claims) (bool, error) {
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+
+	// Проверка идёт на каждый запрос: сравниваем колонки с uuid-параметрами, чтобы работали индексы.
+	// Наш сервер выдаёт только UUID, поэтому токен с другими id считаем отозванным.
+	for _, id := range []string{claims.ID, claims.UserID, claims.DeviceID, claims.SessionID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return true, nil
+		}
+	}
+
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = NULLIF($1, '')::uuid)
+			OR EXISTS (SELECT 1 FROM users WHERE id = NULLIF($2, '')::uuid AND tokens_valid_after > $3)
+			OR EXISTS (SELECT 1 FROM devices WHERE id = NULLIF($4, '')::uuid AND revoked_at IS NOT NULL)
+			OR EXISTS (SELECT 1 FROM refresh_tokens WHERE family_id = NULLIF($5, '')::uuid AND revoked_at IS NOT NULL)
+	`
+
+	var revoked bool
+	err := r.db.QueryRow(ctx, query, claims.ID, claims.UserID, issuedAt, claims.DeviceID, claims.SessionID).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки отзыва токена: %w", err)
+	}
+
+	return revoked, nil
+}
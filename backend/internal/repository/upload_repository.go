@@ -0,0 +1,220 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("загрузка не найдена")
+	ErrUploadOffsetConflict = errors.New("смещение не совпадает с принятым")
+	ErrTooManyUploadChunks  = fmt.Errorf("загрузка не может состоять больше чем из %d кусков", domain.MaxUploadChunks)
+)
+
+type UploadRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewUploadRepository(db *pgxpool.Pool) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+// Create заводит вложение и докачиваемую загрузку к нему одной транзакцией.
+// Вложение хранится до attachmentExpiresAt, незавершённая загрузка — до uploadExpiresAt.
+func (r *UploadRepository) Create(ctx context.Context, ownerID string, size int64, digest []byte, attachmentExpiresAt, uploadExpiresAt time.Time) (*domain.Upload, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания загрузки: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	u := domain.Upload{Size: size, SHA256: digest, ExpiresAt: uploadExpiresAt}
+
+	attachmentQuery := `
+		INSERT INTO attachments (owner_id, size, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id::text
+	`
+	if err := tx.QueryRow(ctx, attachmentQuery, ownerID, size, attachmentExpiresAt).Scan(&u.AttachmentID); err != nil {
+		return nil, fmt.Errorf("ошибка создания загрузки: %w", err)
+	}
+
+	uploadQuery := `
+		INSERT INTO uploads (attachment_id, size, sha256, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id::text, created_at
+	`
+	if err := tx.QueryRow(ctx, uploadQuery, u.AttachmentID, size, digest, uploadExpiresAt).Scan(&u.ID, &u.CreatedAt); err != nil {
+		return nil, fmt.Errorf("ошибка создания загрузки: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка создания загрузки: %w", err)
+	}
+	return &u, nil
+}
+
+// Get возвращает незавершённую и не истёкшую загрузку, если её вложение принадлежит ownerID
+func (r *UploadRepository) Get(ctx context.Context, id, ownerID string) (*domain.Upload, error) {
+	if !validUUIDs(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	query := `
+		SELECT u.id::text, u.attachment_id::text, u.size, u.received, u.sha256, u.created_at, u.expires_at
+		FROM uploads u
+		JOIN attachments a ON a.id = u.attachment_id
+		WHERE u.id = $1 AND a.owner_id = $2 AND u.expires_at > NOW()
+	`
+
+	var u domain.Upload
+	err := r.db.QueryRow(ctx, query, id, ownerID).Scan(&u.ID, &u.AttachmentID, &u.Size, &u.Offset, &u.SHA256, &u.CreatedAt, &u.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUploadNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения загрузки: %w", err)
+	}
+	return &u, nil
+}
+
+// AddChunk учитывает принятый кусок и продлевает загрузку до expiresAt.
+// Кусок принимается, только если он начинается ровно с уже принятого смещения:
+// иначе (параллельный запрос успел раньше) — ErrUploadOffsetConflict.
+// Число кусков ограничено domain.MaxUploadChunks.
+func (r *UploadRepository) AddChunk(ctx context.Context, id string, chunk domain.UploadChunk, expiresAt time.Time) error {
+	if !validUUIDs(id) {
+		return ErrUploadNotFound
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка записи куска: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var count int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM upload_chunks WHERE upload_id = $1`, id).Scan(&count); err != nil {
+		return fmt.Errorf("ошибка записи куска: %w", err)
+	}
+	if count >= domain.MaxUploadChunks {
+		return ErrTooManyUploadChunks
+	}
+
+	query := `
+		UPDATE uploads SET received = received + $3, expires_at = $4
+		WHERE id = $1 AND received = $2 AND received + $3 <= size AND expires_at > NOW()
+	`
+	tag, err := tx.Exec(ctx, query, id, chunk.Offset, chunk.Size, expiresAt)
+	if err != nil {
+		return fmt.Errorf("ошибка записи куска: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUploadOffsetConflict
+	}
+
+	chunkQuery := `INSERT INTO upload_chunks (upload_id, start_offset, size, blob_key) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, chunkQuery, id, chunk.Offset, chunk.Size, chunk.BlobKey); err != nil {
+		return fmt.Errorf("ошибка записи куска: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка записи куска: %w", err)
+	}
+	return nil
+}
+
+// Chunks возвращает принятые куски по порядку смещений
+func (r *UploadRepository) Chunks(ctx context.Context, id string) ([]domain.UploadChunk, error) {
+	if !validUUIDs(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	query := `
+		SELECT start_offset, size, blob_key
+		FROM upload_chunks
+		WHERE upload_id = $1
+		ORDER BY start_offset
+	`
+
+	rows, err := r.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения кусков загрузки: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []domain.UploadChunk
+	for rows.Next() {
+		var c domain.UploadChunk
+		if err := rows.Scan(&c.Offset, &c.Size, &c.BlobKey); err != nil {
+			return nil, fmt.Errorf("ошибка чтения кусков загрузки: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// Complete подтверждает вложение собранной загрузки и удаляет её учёт вместе с кусками
+func (r *UploadRepository) Complete(ctx context.Context, upload *domain.Upload) error {
+	if !validUUIDs(upload.ID, upload.AttachmentID) {
+		return ErrUploadNotFound
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка завершения загрузки: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `UPDATE attachments SET uploaded_at = NOW() WHERE id = $1 AND uploaded_at IS NULL`, upload.AttachmentID); err != nil {
+		return fmt.Errorf("ошибка завершения загрузки: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM uploads WHERE id = $1`, upload.ID); err != nil {
+		return fmt.Errorf("ошибка завершения загрузки: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка завершения загрузки: %w", err)
+	}
+	return nil
+}
+
+// Expired возвращает до limit истёкших загрузок (брошенных клиентами)
+func (r *UploadRepository) Expired(ctx context.Context, limit int) ([]string, error) {
+	query := `SELECT id::text FROM uploads WHERE expires_at <= NOW() ORDER BY expires_at LIMIT $1`
+
+	rows, err := r.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска брошенных загрузок: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка поиска брошенных загрузок: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Delete удаляет учёт загрузки и её кусков (объекты кусков удаляются до этого).
+// Вложение остаётся неподтверждённым и уходит в обычную сборку вложений.
+func (r *UploadRepository) Delete(ctx context.Context, id string) error {
+	if !validUUIDs(id) {
+		return ErrUploadNotFound
+	}
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM uploads WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("ошибка удаления загрузки: %w", err)
+	}
+	return nil
+}
@@ -2,12 +2,27 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/yerkebulanrai/securemesh/backend/internal/domain"
 )
 
+// pgUniqueViolation — SQLSTATE нарушения уникальности
+const pgUniqueViolation = "23505"
+
+var (
+	ErrUserNotFound            = errors.New("пользователь не найден")
+	ErrUsernameTaken           = errors.New("имя пользователя занято")
+	ErrRegistrationLockNotSet  = errors.New("регистрационная блокировка не включена")
+	ErrRegistrationLockInvalid = errors.New("неверный PIN регистрационной блокировки")
+	ErrRegistrationLocked      = errors.New("слишком много неверных PIN, попытки временно заблокированы")
+)
+
 type UserRepository struct {
 	db *pgxpool.Pool
 }
@@ -16,49 +31,325 @@ func NewUserRepository(db *pgxpool.Pool) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// CreateUser сохраняет пользователя в БД
-func (r *UserRepository) CreateUser(ctx context.Context, user *domain.User) error {
+// CreateUser сохраняет пользователя в БД вместе с его основным устройством
+func (r *UserRepository) CreateUser(ctx context.Context, user *domain.User, device *domain.Device) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании пользователя: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 		INSERT INTO users (username_hash, public_identity_key, public_signing_key)
 		VALUES ($1, $2, $3)
 		RETURNING id, created_at
 	`
 
-	err := r.db.QueryRow(ctx, query, 
+	err = tx.QueryRow(ctx, query, 
 		user.UsernameHash, 
 		user.PublicIdentityKey,
 		user.PublicSigningKey,
 	).Scan(&user.ID, &user.CreatedAt)
 
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrUsernameTaken
+	}
 	if err != nil {
 		return fmt.Errorf("ошибка при создании пользователя: %w", err)
 	}
 
+	deviceQuery := `
+		INSERT INTO devices (user_id, name, public_identity_key, public_signing_key)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	device.UserID = user.ID
+	err = tx.QueryRow(ctx, deviceQuery,
+		device.UserID,
+		device.Name,
+		device.PublicIdentityKey,
+		device.PublicSigningKey,
+	).Scan(&device.ID, &device.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("ошибка при создании устройства: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("ошибка при создании пользователя: %w", err)
+	}
+
 	return nil
 }
 
 // GetPublicKey возвращает публичный ключ шифрования (Curve25519)
-func (r *UserRepository) GetPublicKey(ctx context.Context, userID string) (string, error) {
+func (r *UserRepository) GetPublicKey(ctx context.Context, userID string) ([]byte, error) {
 	var publicKey []byte
 	query := `SELECT public_identity_key FROM users WHERE id = $1`
 
 	err := r.db.QueryRow(ctx, query, userID).Scan(&publicKey)
 	if err != nil {
-		return "", fmt.Errorf("пользователь не найден: %w", err)
+		return nil, fmt.Errorf("пользователь не найден: %w", err)
 	}
 
-	return string(publicKey), nil
+	return publicKey, nil
 }
 
 // GetSigningKey возвращает публичный ключ подписи (Ed25519)
-func (r *UserRepository) GetSigningKey(ctx context.Context, userID string) (string, error) {
+func (r *UserRepository) GetSigningKey(ctx context.Context, userID string) ([]byte, error) {
 	var signingKey []byte
 	query := `SELECT public_signing_key FROM users WHERE id = $1`
 
 	err := r.db.QueryRow(ctx, query, userID).Scan(&signingKey)
 	if err != nil {
-		return "", fmt.Errorf("пользователь не найден: %w", err)
+		return nil, fmt.Errorf("пользователь не найден: %w", err)
+	}
+
+	return signingKey, nil
+}
+
+// GetLastSeen возвращает настройку приватности и время последнего визита (nil, если не заходил)
+func (r *UserRepository) GetLastSeen(ctx context.Context, userID string) (domain.LastSeenVisibility, *time.Time, error) {
+	var (
+		visibility string
+		lastSeen   *time.Time
+	)
+	query := `SELECT last_seen_visibility, last_seen_at FROM users WHERE id = $1`
+
+	err := r.db.QueryRow(ctx, query, userID).Scan(&visibility, &lastSeen)
+	if err != nil {
+		return "", nil, fmt.Errorf("пользователь не найден: %w", err)
+	}
+
+	return domain.LastSeenVisibility(visibility), lastSeen, nil
+}
+
+// SetLastSeenVisibility меняет, кому виден онлайн-статус
+func (r *UserRepository) SetLastSeenVisibility(ctx context.Context, userID string, visibility domain.LastSeenVisibility) error {
+	query := `UPDATE users SET last_seen_visibility = $2 WHERE id = $1`
+
+	if _, err := r.db.Exec(ctx, query, userID, string(visibility)); err != nil {
+		return fmt.Errorf("ошибка сохранения настроек приватности: %w", err)
+	}
+
+	return nil
+}
+
+// TouchLastSeen запоминает момент, когда юзер ушёл из сети
+func (r *UserRepository) TouchLastSeen(ctx context.Context, userID string) error {
+	query := `UPDATE users SET last_seen_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("ошибка обновления last seen: %w", err)
+	}
+
+	return nil
+}
+
+// SetRegistrationLock включает (или меняет) регистрационную блокировку; пустой хэш выключает её
+func (r *UserRepository) SetRegistrationLock(ctx context.Context, userID, pinHash string) error {
+	query := `
+		UPDATE users
+		SET registration_lock_hash = NULLIF($2, ''), registration_lock_attempts = 0, registration_lock_until = NULL
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Exec(ctx, query, userID, pinHash); err != nil {
+		return fmt.Errorf("ошибка сохранения регистрационной блокировки: %w", err)
+	}
+
+	return nil
+}
+
+// HasRegistrationLock сообщает, защищено ли имя пользователя PIN-ом
+func (r *UserRepository) HasRegistrationLock(ctx context.Context, usernameHash string) (bool, error) {
+	var locked bool
+	query := `SELECT registration_lock_hash IS NOT NULL FROM users WHERE username_hash = $1`
+
+	err := r.db.QueryRow(ctx, query, usernameHash).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrUserNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения регистрационной блокировки: %w", err)
+	}
+
+	return locked, nil
+}
+
+// ReRegister перерегистрирует занятое имя (переустановка, потеря устройства), если checkPIN
+// подтвердит PIN регистрационной блокировки. Новые ключи становятся ключами аккаунта
+// и нового основного устройства, все старые устройства и их сессии отзываются.
+// При неверном PIN растёт счётчик попыток (см. domain.RegistrationLockout);
+// пока попытки заблокированы, возвращается ErrRegistrationLocked и время разблокировки.
+func (r *UserRepository) ReRegister(ctx context.Context, user *domain.User, device *domain.Device, checkPIN func(pinHash string) (bool, error)) (time.Time, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка перерегистрации: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// FOR UPDATE: параллельные попытки подбора PIN проверяются строго по очереди
+	query := `
+		SELECT id, registration_lock_hash, registration_lock_attempts, registration_lock_until
+		FROM users
+		WHERE username_hash = $1
+		FOR UPDATE
+	`
+
+	var (
+		pinHash     *string
+		attempts    int
+		lockedUntil *time.Time
+	)
+	err = tx.QueryRow(ctx, query, user.UsernameHash).Scan(&user.ID, &pinHash, &attempts, &lockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, ErrUserNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка перерегистрации: %w", err)
+	}
+
+	if pinHash == nil {
+		return time.Time{}, ErrRegistrationLockNotSet
+	}
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		return *lockedUntil, ErrRegistrationLocked
+	}
+
+	ok, err := checkPIN(*pinHash)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка проверки PIN: %w", err)
+	}
+
+	if !ok {
+		attempts++
+		var until *time.Time
+		if lockout := domain.RegistrationLockout(attempts); lockout > 0 {
+			t := time.Now().Add(lockout)
+			until = &t
+		}
+
+		failQuery := `UPDATE users SET registration_lock_attempts = $2, registration_lock_until = $3 WHERE id = $1`
+		if _, err := tx.Exec(ctx, failQuery, user.ID, attempts, until); err != nil {
+			return time.Time{}, fmt.Errorf("ошибка перерегистрации: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return time.Time{}, fmt.Errorf("ошибка перерегистрации: %w", err)
+		}
+		return time.Time{}, ErrRegistrationLockInvalid
+	}
+
+	updateQuery := `
+		UPDATE users
+		SET public_identity_key = $2, public_signing_key = $3,
+			registration_lock_attempts = 0, registration_lock_until = NULL
+		WHERE id = $1
+		RETURNING created_at
+	`
+	err = tx.QueryRow(ctx, updateQuery, user.ID, user.PublicIdentityKey, user.PublicSigningKey).Scan(&user.CreatedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка перерегистрации: %w", err)
+	}
+
+	// Старые устройства больше не принадлежат владельцу: их токены перестают приниматься,
+	// а WebSocket закроется при ближайшей перепроверке
+	revokeQueries := []string{
+		`UPDATE devices SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+	}
+	for _, q := range revokeQueries {
+		if _, err := tx.Exec(ctx, q, user.ID); err != nil {
+			return time.Time{}, fmt.Errorf("ошибка перерегистрации: %w", err)
+		}
+	}
+
+	deviceQuery := `
+		INSERT INTO devices (user_id, name, public_identity_key, public_signing_key)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	device.UserID = user.ID
+	err = tx.QueryRow(ctx, deviceQuery,
+		device.UserID,
+		device.Name,
+		device.PublicIdentityKey,
+		device.PublicSigningKey,
+	).Scan(&device.ID, &device.CreatedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("ошибка при создании устройства: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("ошибка перерегистрации: %w", err)
+	}
+
+	return time.Time{}, nil
+}
+
+// GetIDByUsernameHash находит юзера по хэшу имени
+func (r *UserRepository) GetIDByUsernameHash(ctx context.Context, usernameHash string) (string, error) {
+	var userID string
+	query := `SELECT id FROM users WHERE username_hash = $1 AND deleted_at IS NULL`
+
+	err := r.db.QueryRow(ctx, query, usernameHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка поиска пользователя: %w", err)
+	}
+
+	return userID, nil
+}
+
+// RehashLegacyUsernames заменяет открытые имена (username_hash_version = 0) их хэшами.
+// hashes возвращает варианты хэша по порядку предпочтения: если первый уже занят
+// (два старых имени совпали после нормализации), берётся следующий.
+// Возвращает число перехэшированных строк.
+func (r *UserRepository) RehashLegacyUsernames(ctx context.Context, hashes func(username string) []string) (int, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, username_hash FROM users WHERE username_hash_version = 0`)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения старых имён: %w", err)
+	}
+
+	type legacyUser struct{ id, username string }
+	var legacy []legacyUser
+	for rows.Next() {
+		var u legacyUser
+		if err := rows.Scan(&u.id, &u.username); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка чтения старых имён: %w", err)
+		}
+		legacy = append(legacy, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка чтения старых имён: %w", err)
+	}
+
+	query := `
+		UPDATE users SET username_hash = $2, username_hash_version = 1
+		WHERE id = $1 AND username_hash_version = 0
+	`
+
+	rehashed := 0
+	for _, u := range legacy {
+		var pgErr *pgconn.PgError
+		for _, hash := range hashes(u.username) {
+			_, err = r.db.Exec(ctx, query, u.id, hash)
+			if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+				continue
+			}
+			break
+		}
+		if err != nil {
+			return rehashed, fmt.Errorf("ошибка перехэширования имени юзера %s: %w", u.id, err)
+		}
+		rehashed++
 	}
 
-	return string(signingKey), nil
+	return rehashed, nil
 }
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+// ChallengeTTL — сколько действует nonce для /auth/token
+const ChallengeTTL = time.Minute
+
+// NewChallengeNonce генерирует случайный одноразовый nonce (256 бит, Base64URL)
+func NewChallengeNonce() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// ChallengeMessage — строка, которую устройство подписывает ключом Ed25519 для входа.
+// audience привязывает подпись к серверу: перехваченную для другого хоста подпись здесь не примут.
+func ChallengeMessage(audience, userID, deviceID, nonce string) string {
+	return fmt.Sprintf("securemesh:auth:v2:%s:%s:%s:%s", audience, userID, deviceID, nonce)
+}
@@ -3,61 +3,80 @@ package auth
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var (
 	ErrInvalidToken = errors.New("invalid or expired token")
-	jwtSecret       []byte
+	keyRing         *KeyRing
 )
 
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "CHANGE_ME_IN_PRODUCTION" // fallback для dev
-	}
-	jwtSecret = []byte(secret)
+// SetKeyRing задаёт ключи, которыми подписываются и проверяются JWT.
+// Вызывается один раз при старте, до обработки запросов.
+func SetKeyRing(ring *KeyRing) {
+	keyRing = ring
 }
 
+// AccessTokenTTL — время жизни JWT; дальше клиент обновляет его refresh-токеном
+const AccessTokenTTL = 15 * time.Minute
+
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	DeviceID  string `json:"device_id"`
+	SessionID string `json:"sid"` // Сессия (семейство refresh-токенов), выдавшая токен
 	jwt.RegisteredClaims
 }
 
-// GenerateToken создаёт JWT на 15 минут
-func GenerateToken(userID string) (string, error) {
+// GenerateToken создаёт JWT на 15 минут для устройства в рамках сессии.
+// У каждого токена свой jti, по нему токен можно отозвать досрочно.
+func GenerateToken(userID, deviceID, sessionID string) (string, error) {
+	if keyRing == nil {
+		return "", ErrNoSigningKey
+	}
+
 	claims := Claims{
-		UserID: userID,
+		UserID:    userID,
+		DeviceID:  deviceID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "securemesh",
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = keyRing.signingKID
+	return token.SignedString(keyRing.signingKey)
 }
 
-// ValidateToken проверяет токен и возвращает user_id
-func ValidateToken(tokenString string) (string, error) {
+// ValidateToken проверяет токен и возвращает его claims (user_id, device_id).
+// Ключ проверки выбирается по kid из заголовка среди действующих ключей кольца.
+func ValidateToken(tokenString string) (*Claims, error) {
+	if keyRing == nil {
+		return nil, ErrInvalidToken
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := keyRing.verifyKeys[kid]
+		if !ok {
 			return nil, ErrInvalidToken
 		}
-		return jwtSecret, nil
-	})
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}))
 
 	if err != nil {
-		return "", ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims.UserID, nil
+		return claims, nil
 	}
 
-	return "", ErrInvalidToken
-}
\ No newline at end of file
+	return nil, ErrInvalidToken
+}
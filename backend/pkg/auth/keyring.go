@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var ErrNoSigningKey = errors.New("JWT_SIGNING_KEY не задан (ключ можно не задавать только при APP_ENV=dev)")
+
+// KeyRing — ключи подписи JWT (Ed25519).
+// Подписываем одним текущим ключом, а проверяем любым из действующих:
+// при ротации старый публичный ключ остаётся в JWT_VERIFY_KEYS, пока не истекут выданные им токены.
+type KeyRing struct {
+	signingKey ed25519.PrivateKey
+	signingKID string
+	verifyKeys map[string]ed25519.PublicKey // kid -> ключ
+	order      []string                     // kid в порядке добавления, текущий первым
+}
+
+// NewKeyRing собирает кольцо из текущего ключа подписи и публичных ключей прошлых поколений
+func NewKeyRing(signingKey ed25519.PrivateKey, previous ...ed25519.PublicKey) *KeyRing {
+	ring := &KeyRing{
+		signingKey: signingKey,
+		verifyKeys: make(map[string]ed25519.PublicKey),
+	}
+
+	ring.signingKID = ring.addVerifyKey(signingKey.Public().(ed25519.PublicKey))
+	for _, key := range previous {
+		ring.addVerifyKey(key)
+	}
+
+	return ring
+}
+
+func (r *KeyRing) addVerifyKey(key ed25519.PublicKey) string {
+	kid := KeyID(key)
+	if _, ok := r.verifyKeys[kid]; !ok {
+		r.verifyKeys[kid] = key
+		r.order = append(r.order, kid)
+	}
+	return kid
+}
+
+// KeyID — kid ключа: JWK thumbprint по RFC 7638, одинаковый на всех узлах без отдельной настройки
+func KeyID(key ed25519.PublicKey) string {
+	jwk := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(key))
+	sum := sha256.Sum256([]byte(jwk))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// LoadKeyRing читает ключи из окружения:
+// JWT_SIGNING_KEY — Base64 seed (32 байта) или приватный ключ Ed25519 (64 байта),
+// JWT_VERIFY_KEYS — через запятую Base64 публичные ключи, которыми подписывали раньше.
+// Без JWT_SIGNING_KEY запускаемся только при APP_ENV=dev — со случайным ключом на время процесса.
+func LoadKeyRing() (*KeyRing, error) {
+	var previous []ed25519.PublicKey
+	for _, v := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("JWT_VERIFY_KEYS: неверный публичный ключ Ed25519 %q", v)
+		}
+		previous = append(previous, ed25519.PublicKey(raw))
+	}
+
+	encoded := os.Getenv("JWT_SIGNING_KEY")
+	if encoded == "" {
+		if os.Getenv("APP_ENV") != "dev" {
+			return nil, ErrNoSigningKey
+		}
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeyRing(key, previous...), nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("JWT_SIGNING_KEY: неверный Base64: %w", err)
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return NewKeyRing(ed25519.NewKeyFromSeed(raw), previous...), nil
+	case ed25519.PrivateKeySize:
+		return NewKeyRing(ed25519.PrivateKey(raw), previous...), nil
+	default:
+		return nil, fmt.Errorf("JWT_SIGNING_KEY: ожидается 32 или 64 байта, получено %d", len(raw))
+	}
+}
+
+// SigningKeyID — kid, с которым подписываются новые токены
+func (r *KeyRing) SigningKeyID() string {
+	return r.signingKID
+}
+
+// JWK — публичный ключ в формате RFC 8037 (OKP / Ed25519)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKSet — содержимое /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает все действующие ключи проверки, текущий — первым
+func (r *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(r.order))}
+	for _, kid := range r.order {
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(r.verifyKeys[kid]),
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: "EdDSA",
+		})
+	}
+	return set
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+)
+
+// RefreshTokenTTL — сколько живёт refresh-токен без использования
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// NewRefreshToken генерирует случайный refresh-токен.
+// Клиенту отдаётся сам токен, в БД хранится только его хэш.
+func NewRefreshToken() (token string, hash []byte, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken — SHA-256 токена. Токен случайный (256 бит), поэтому соль не нужна.
+func HashRefreshToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,42 @@
+// pkg/blob/blob.go
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("объект не найден")
+	ErrInvalidKey   = errors.New("неверный ключ объекта")
+	ErrInvalidURL   = errors.New("подпись ссылки неверна или истекла")
+	ErrSizeMismatch = errors.New("размер объекта не совпадает с заявленным")
+)
+
+// Store хранит зашифрованные клиентами объекты (вложения).
+// Обычно данные идут мимо API: клиенты загружают и скачивают их по подписанным ссылкам.
+// Через API проходят только докачиваемые загрузки (Put, Get).
+type Store interface {
+	// UploadURL — ссылка для загрузки объекта key ровно из size байт методом PUT, действует ttl
+	UploadURL(ctx context.Context, key string, size int64, ttl time.Duration) (string, error)
+	// DownloadURL — ссылка для скачивания объекта методом GET, действует ttl
+	DownloadURL(ctx context.Context, key string, ttl time.Duration) (string, error)
+	// Put сохраняет объект ровно из size байт, читая его из r (загрузка через сам API)
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get открывает объект для чтения или возвращает ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Size возвращает размер загруженного объекта или ErrNotFound
+	Size(ctx context.Context, key string) (int64, error)
+	// Delete удаляет объект; отсутствующий объект — не ошибка
+	Delete(ctx context.Context, key string) error
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// ValidKey — ключ безопасен как имя файла и как путь в бакете: без "/" и не начинается с точки
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
@@ -0,0 +1,167 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// FileStore — объекты в каталоге на диске, для локальной разработки и одиночного узла.
+// Ссылки ведут на сам API (/blobs/:key) и подписаны HMAC: в подпись входят метод,
+// ключ, размер (для загрузки) и срок действия.
+type FileStore struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewFileStore создаёт хранилище в dir. baseURL — внешний адрес API, например http://localhost:8080
+func NewFileStore(dir, baseURL string, secret []byte) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога вложений: %w", err)
+	}
+	return &FileStore{dir: dir, baseURL: baseURL, secret: secret}, nil
+}
+
+func (s *FileStore) sign(method, key string, size, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d", method, key, size, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *FileStore) signedURL(method, key string, size int64, ttl time.Duration) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	if method == "PUT" {
+		q.Set("size", strconv.FormatInt(size, 10))
+	}
+	q.Set("sig", s.sign(method, key, size, expires))
+
+	return s.baseURL + "/blobs/" + key + "?" + q.Encode(), nil
+}
+
+func (s *FileStore) UploadURL(ctx context.Context, key string, size int64, ttl time.Duration) (string, error) {
+	return s.signedURL("PUT", key, size, ttl)
+}
+
+func (s *FileStore) DownloadURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return s.signedURL("GET", key, 0, ttl)
+}
+
+// Verify проверяет подписанную ссылку и возвращает размер, разрешённый для загрузки (для GET — 0)
+func (s *FileStore) Verify(method, key string, query url.Values) (int64, error) {
+	if !ValidKey(key) {
+		return 0, ErrInvalidKey
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, ErrInvalidURL
+	}
+
+	var size int64
+	if method == "PUT" {
+		size, err = strconv.ParseInt(query.Get("size"), 10, 64)
+		if err != nil || size < 0 {
+			return 0, ErrInvalidURL
+		}
+	}
+
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(s.sign(method, key, size, expires))) {
+		return 0, ErrInvalidURL
+	}
+	return size, nil
+}
+
+// Write сохраняет объект ровно из size байт. Файл появляется под ключом только целиком.
+func (s *FileStore) Write(key string, r io.Reader, size int64) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("ошибка записи вложения: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	// Читаем на байт больше, чтобы заметить лишнее
+	n, err := io.Copy(tmp, io.LimitReader(r, size+1))
+	if err != nil {
+		return fmt.Errorf("ошибка записи вложения: %w", err)
+	}
+	if n != size {
+		return ErrSizeMismatch
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("ошибка записи вложения: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, key)); err != nil {
+		return fmt.Errorf("ошибка записи вложения: %w", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	return s.Write(key, r, size)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.Open(key)
+}
+
+// Open открывает объект для чтения
+func (s *FileStore) Open(key string) (*os.File, error) {
+	if !ValidKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *FileStore) Size(ctx context.Context, key string) (int64, error) {
+	if !ValidKey(key) {
+		return 0, ErrInvalidKey
+	}
+
+	info, err := os.Stat(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка чтения вложения: %w", err)
+	}
+	return info.Size(), nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	if !ValidKey(key) {
+		return ErrInvalidKey
+	}
+
+	err := os.Remove(filepath.Join(s.dir, key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("ошибка удаления вложения: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// pkg/bus/bus.go
+package bus
+
+import (
+	"context"
+	"time"
+)
+
+// Envelope — кадр WebSocket, который нужно доставить юзеру, подключённому к другому узлу
+type Envelope struct {
+	UserID          string `json:"user_id"`
+	DeviceID        string `json:"device_id,omitempty"`         // Только это устройство (пусто — все)
+	ExcludeDeviceID string `json:"exclude_device_id,omitempty"` // Все, кроме этого устройства
+	Data            []byte `json:"data"`
+
+	// Если задан CloseCode, соединения адресатов закрываются с этим кодом вместо доставки Data
+	CloseCode   int    `json:"close_code,omitempty"`
+	CloseReason string `json:"close_reason,omitempty"`
+}
+
+// Bus пересылает конверты между узлами API.
+// У каждого узла свой канал, узел-получатель определяется через Presence.
+type Bus interface {
+	// Publish отправляет конверт узлу nodeID
+	Publish(ctx context.Context, nodeID string, env Envelope) error
+	// Subscribe начинает принимать конверты, адресованные узлу nodeID.
+	// Обработчик вызывается до отмены ctx.
+	Subscribe(ctx context.Context, nodeID string, handler func(Envelope)) error
+	Close() error
+}
+
+// Presence знает, к каким узлам подключены устройства юзера
+type Presence interface {
+	SetOnline(ctx context.Context, userID, deviceID, nodeID string) error
+	// SetOffline снимает отметку, только если устройство всё ещё числится за nodeID
+	// (оно могло уже переподключиться к другому узлу)
+	SetOffline(ctx context.Context, userID, deviceID, nodeID string) error
+	// Nodes возвращает узлы, к которым подключено хотя бы одно устройство юзера
+	Nodes(ctx context.Context, userID string) ([]string, error)
+
+	// Watch подписывает watcherID на изменения присутствия targetIDs на время ttl
+	// (клиент продлевает подписку, подписываясь заново)
+	Watch(ctx context.Context, watcherID string, targetIDs []string, ttl time.Duration) error
+	// Watchers возвращает юзеров с действующей подпиской на targetID
+	Watchers(ctx context.Context, targetID string) ([]string, error)
+}
@@ -0,0 +1,296 @@
+package bus
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// Одни и те же сценарии прогоняются на реализациях в памяти и на Redis (miniredis)
+
+const waitTimeout = time.Second
+
+func newMiniredis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestMemoryBus(t *testing.T) {
+	testBus(t, NewMemoryBus())
+}
+
+func TestRedisBus(t *testing.T) {
+	_, client := newMiniredis(t)
+	testBus(t, NewRedisBus(client))
+}
+
+func TestMemoryPresence(t *testing.T) {
+	p := NewMemoryPresence()
+	testPresence(t, p, presenceHooks{
+		expire: func(targetID, watcherID string) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.watchers[targetID][watcherID] = time.Now().Add(-time.Second)
+		},
+		stored: func(targetID string) []string {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			var ids []string
+			for watcherID := range p.watchers[targetID] {
+				ids = append(ids, watcherID)
+			}
+			return ids
+		},
+	})
+}
+
+func TestRedisPresence(t *testing.T) {
+	mr, client := newMiniredis(t)
+	// Узлы из сценария живы: без heartbeat их записи игнорируются (см. TestRedisPresenceHeartbeat)
+	for _, nodeID := range []string{"node-a", "node-b"} {
+		mr.Set(nodeAlivePrefix+nodeID, "1")
+	}
+
+	testPresence(t, NewRedisPresence(client), presenceHooks{
+		expire: func(targetID, watcherID string) {
+			score := float64(time.Now().Add(-time.Minute).Unix())
+			if _, err := mr.ZAdd(watchersPrefix+targetID, score, watcherID); err != nil {
+				t.Fatal(err)
+			}
+		},
+		stored: func(targetID string) []string {
+			ids, _ := mr.ZMembers(watchersPrefix + targetID)
+			return ids
+		},
+	})
+}
+
+// Записи узла, переставшего слать heartbeat, не учитываются; остановленный узел снимает отметку сразу
+func TestRedisPresenceHeartbeat(t *testing.T) {
+	mr, client := newMiniredis(t)
+	p := NewRedisPresence(client)
+	ctx := context.Background()
+
+	hbCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		p.Heartbeat(hbCtx, "node-a")
+		close(done)
+	}()
+	waitFor(t, func() bool { return mr.Exists(nodeAlivePrefix + "node-a") })
+
+	if err := p.SetOnline(ctx, "alice", "phone", "node-a"); err != nil {
+		t.Fatal(err)
+	}
+	assertNodes(t, p, "alice", "node-a")
+
+	// Узел завис: heartbeat не продлевается, ключ истекает
+	mr.FastForward(3*heartbeatInterval + time.Second)
+	assertNodes(t, p, "alice")
+
+	stop()
+	<-done
+
+	// Остановленный узел удаляет свой ключ, не дожидаясь истечения
+	hbCtx, stop = context.WithCancel(ctx)
+	done = make(chan struct{})
+	go func() {
+		p.Heartbeat(hbCtx, "node-b")
+		close(done)
+	}()
+	waitFor(t, func() bool { return mr.Exists(nodeAlivePrefix + "node-b") })
+	stop()
+	<-done
+	if mr.Exists(nodeAlivePrefix + "node-b") {
+		t.Error("Heartbeat() left the node key after ctx was cancelled")
+	}
+}
+
+func testBus(t *testing.T, b Bus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	toA := make(chan Envelope, 10)
+	toB := make(chan Envelope, 10)
+	if err := b.Subscribe(ctx, "node-a", func(env Envelope) { toA <- env }); err != nil {
+		t.Fatal(err)
+	}
+	subB, cancelB := context.WithCancel(ctx)
+	if err := b.Subscribe(subB, "node-b", func(env Envelope) { toB <- env }); err != nil {
+		t.Fatal(err)
+	}
+
+	env := Envelope{
+		UserID:          "alice",
+		ExcludeDeviceID: "phone",
+		Data:            []byte{0, 1, 2, 0xff},
+	}
+	if err := b.Publish(ctx, "node-a", env); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-toA:
+		if !reflect.DeepEqual(got, env) {
+			t.Errorf("node-a received %+v, want %+v", got, env)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("node-a did not receive the envelope")
+	}
+	select {
+	case got := <-toB:
+		t.Errorf("node-b received an envelope for node-a: %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	closeEnv := Envelope{UserID: "alice", DeviceID: "laptop", CloseCode: 4001, CloseReason: "revoked"}
+	if err := b.Publish(ctx, "node-b", closeEnv); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-toB:
+		if !reflect.DeepEqual(got, closeEnv) {
+			t.Errorf("node-b received %+v, want %+v", got, closeEnv)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("node-b did not receive the envelope")
+	}
+
+	// После отмены ctx подписка больше не получает конверты
+	cancelB()
+	time.Sleep(100 * time.Millisecond)
+	if err := b.Publish(ctx, "node-b", env); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-toB:
+		t.Errorf("node-b received an envelope after unsubscribing: %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// presenceHooks дают тесту доступ к хранилищу подписок конкретной реализации
+type presenceHooks struct {
+	expire func(targetID, watcherID string) // делает подписку просроченной
+	stored func(targetID string) []string   // подписки, которые ещё лежат в хранилище
+}
+
+func testPresence(t *testing.T, p Presence, hooks presenceHooks) {
+	ctx := context.Background()
+
+	t.Run("nodes", func(t *testing.T) {
+		assertNodes(t, p, "alice")
+
+		connections := []struct{ device, node string }{
+			{"phone", "node-a"},
+			{"laptop", "node-b"},
+			{"tablet", "node-a"},
+		}
+		for _, conn := range connections {
+			if err := p.SetOnline(ctx, "alice", conn.device, conn.node); err != nil {
+				t.Fatal(err)
+			}
+		}
+		assertNodes(t, p, "alice", "node-a", "node-b")
+		assertNodes(t, p, "bob")
+
+		for _, conn := range connections {
+			if err := p.SetOffline(ctx, "alice", conn.device, conn.node); err != nil {
+				t.Fatal(err)
+			}
+		}
+		assertNodes(t, p, "alice")
+	})
+
+	// Устройство переподключилось к другому узлу раньше, чем старый узел снял отметку:
+	// запоздавший SetOffline старого узла не должен стереть новую запись
+	t.Run("stale offline", func(t *testing.T) {
+		if err := p.SetOnline(ctx, "carol", "phone", "node-a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SetOnline(ctx, "carol", "phone", "node-b"); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.SetOffline(ctx, "carol", "phone", "node-a"); err != nil {
+			t.Fatal(err)
+		}
+		assertNodes(t, p, "carol", "node-b")
+
+		if err := p.SetOffline(ctx, "carol", "phone", "node-b"); err != nil {
+			t.Fatal(err)
+		}
+		assertNodes(t, p, "carol")
+	})
+
+	t.Run("watchers", func(t *testing.T) {
+		if err := p.Watch(ctx, "w1", []string{"t1", "t2"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Watch(ctx, "w2", []string{"t1"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		assertWatchers(t, p, "t1", "w1", "w2")
+		assertWatchers(t, p, "t2", "w1")
+		assertWatchers(t, p, "t3")
+
+		// Просроченная подписка не возвращается и удаляется из хранилища
+		hooks.expire("t1", "w2")
+		assertWatchers(t, p, "t1", "w1")
+		if got := sorted(hooks.stored("t1")); !reflect.DeepEqual(got, []string{"w1"}) {
+			t.Errorf("stored watchers of t1 = %v, want [w1]: expired watcher was not pruned", got)
+		}
+
+		// Повторная подписка продлевает просроченную
+		if err := p.Watch(ctx, "w2", []string{"t1"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		assertWatchers(t, p, "t1", "w1", "w2")
+	})
+}
+
+func assertNodes(t *testing.T, p Presence, userID string, want ...string) {
+	t.Helper()
+	nodes, err := p.Nodes(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sorted(nodes); !reflect.DeepEqual(got, sorted(want)) {
+		t.Errorf("Nodes(%q) = %v, want %v", userID, got, sorted(want))
+	}
+}
+
+func assertWatchers(t *testing.T, p Presence, targetID string, want ...string) {
+	t.Helper()
+	watchers, err := p.Watchers(context.Background(), targetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sorted(watchers); !reflect.DeepEqual(got, sorted(want)) {
+		t.Errorf("Watchers(%q) = %v, want %v", targetID, got, sorted(want))
+	}
+}
+
+// sorted возвращает отсортированную копию; пустой срез и nil считаются одинаковыми
+func sorted(ids []string) []string {
+	out := append([]string{}, ids...)
+	sort.Strings(out)
+	return out
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
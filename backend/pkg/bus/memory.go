@@ -0,0 +1,159 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryBus — шина внутри одного процесса. Подходит для одиночного узла и тестов.
+type MemoryBus struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[string]map[int]func(Envelope) // nodeID -> id подписки -> обработчик
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{handlers: make(map[string]map[int]func(Envelope))}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, nodeID string, env Envelope) error {
+	b.mu.RLock()
+	handlers := make([]func(Envelope), 0, len(b.handlers[nodeID]))
+	for _, handler := range b.handlers[nodeID] {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(env)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, nodeID string, handler func(Envelope)) error {
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	if b.handlers[nodeID] == nil {
+		b.handlers[nodeID] = make(map[int]func(Envelope))
+	}
+	b.handlers[nodeID][id] = handler
+	b.mu.Unlock()
+
+	// Как и у RedisBus, подписка действует до отмены ctx
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			b.mu.Lock()
+			delete(b.handlers[nodeID], id)
+			if len(b.handlers[nodeID]) == 0 {
+				delete(b.handlers, nodeID)
+			}
+			b.mu.Unlock()
+		}()
+	}
+	return nil
+}
+
+func (b *MemoryBus) Close() error {
+	return nil
+}
+
+// MemoryPresence — реестр присутствия в памяти процесса
+type MemoryPresence struct {
+	mu       sync.Mutex
+	nodes    map[string]map[string]string    // userID -> deviceID -> nodeID
+	watchers map[string]map[string]time.Time // targetID -> watcherID -> срок подписки
+}
+
+func NewMemoryPresence() *MemoryPresence {
+	return &MemoryPresence{
+		nodes:    make(map[string]map[string]string),
+		watchers: make(map[string]map[string]time.Time),
+	}
+}
+
+func (p *MemoryPresence) SetOnline(ctx context.Context, userID, deviceID, nodeID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	devices, ok := p.nodes[userID]
+	if !ok {
+		devices = make(map[string]string)
+		p.nodes[userID] = devices
+	}
+	devices[deviceID] = nodeID
+	return nil
+}
+
+func (p *MemoryPresence) SetOffline(ctx context.Context, userID, deviceID, nodeID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	devices := p.nodes[userID]
+	if devices[deviceID] != nodeID {
+		return nil
+	}
+	delete(devices, deviceID)
+	if len(devices) == 0 {
+		delete(p.nodes, userID)
+	}
+	return nil
+}
+
+func (p *MemoryPresence) Nodes(ctx context.Context, userID string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return uniqueNodes(p.nodes[userID]), nil
+}
+
+func (p *MemoryPresence) Watch(ctx context.Context, watcherID string, targetIDs []string, ttl time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+	for _, targetID := range targetIDs {
+		watchers, ok := p.watchers[targetID]
+		if !ok {
+			watchers = make(map[string]time.Time)
+			p.watchers[targetID] = watchers
+		}
+		watchers[watcherID] = expires
+	}
+	return nil
+}
+
+func (p *MemoryPresence) Watchers(ctx context.Context, targetID string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	watchers := p.watchers[targetID]
+	result := make([]string, 0, len(watchers))
+	for watcherID, expires := range watchers {
+		if now.After(expires) {
+			delete(watchers, watcherID)
+			continue
+		}
+		result = append(result, watcherID)
+	}
+	if len(watchers) == 0 {
+		delete(p.watchers, targetID)
+	}
+	return result, nil
+}
+
+// uniqueNodes собирает узлы устройств без повторов
+func uniqueNodes(devices map[string]string) []string {
+	seen := make(map[string]bool, len(devices))
+	nodes := make([]string, 0, len(devices))
+	for _, nodeID := range devices {
+		if !seen[nodeID] {
+			seen[nodeID] = true
+			nodes = append(nodes, nodeID)
+		}
+	}
+	return nodes
+}
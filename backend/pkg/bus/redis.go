@@ -0,0 +1,205 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	channelPrefix   = "securemesh:node:"
+	presencePrefix  = "securemesh:presence:"
+	nodeAlivePrefix = "securemesh:node-alive:"
+	watchersPrefix  = "securemesh:watchers:"
+
+	// Сколько живёт запись присутствия без переподключений
+	presenceTTL = 24 * time.Hour
+	// Как часто узел подтверждает, что жив; ключ живёт втрое дольше
+	heartbeatInterval = 10 * time.Second
+)
+
+// RedisBus — шина между узлами на Redis pub/sub: у каждого узла свой канал
+type RedisBus struct {
+	client *redis.Client
+}
+
+func NewRedisBus(client *redis.Client) *RedisBus {
+	return &RedisBus{client: client}
+}
+
+func (b *RedisBus) Publish(ctx context.Context, nodeID string, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации конверта: %w", err)
+	}
+
+	if err := b.client.Publish(ctx, channelPrefix+nodeID, data).Err(); err != nil {
+		return fmt.Errorf("ошибка публикации в Redis: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisBus) Subscribe(ctx context.Context, nodeID string, handler func(Envelope)) error {
+	sub := b.client.Subscribe(ctx, channelPrefix+nodeID)
+
+	// Дожидаемся подтверждения подписки, чтобы не потерять первые сообщения
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return fmt.Errorf("ошибка подписки на Redis: %w", err)
+	}
+
+	go func() {
+		defer sub.Close()
+		ch := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var env Envelope
+				if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+					log.Printf("❌ Битый конверт из Redis: %v", err)
+					continue
+				}
+				handler(env)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close ничего не закрывает: клиентом Redis владеет вызывающий код
+func (b *RedisBus) Close() error {
+	return nil
+}
+
+// RedisPresence хранит присутствие в хэше presence:{user_id} (device_id -> node_id).
+// Узлы отмечаются heartbeat-ключом, поэтому записи упавшего узла игнорируются.
+type RedisPresence struct {
+	client *redis.Client
+}
+
+func NewRedisPresence(client *redis.Client) *RedisPresence {
+	return &RedisPresence{client: client}
+}
+
+// setOfflineScript удаляет устройство, только если оно числится за этим узлом
+var setOfflineScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+func (p *RedisPresence) SetOnline(ctx context.Context, userID, deviceID, nodeID string) error {
+	key := presencePrefix + userID
+
+	_, err := p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, deviceID, nodeID)
+		pipe.Expire(ctx, key, presenceTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка записи присутствия: %w", err)
+	}
+	return nil
+}
+
+func (p *RedisPresence) SetOffline(ctx context.Context, userID, deviceID, nodeID string) error {
+	err := setOfflineScript.Run(ctx, p.client, []string{presencePrefix + userID}, deviceID, nodeID).Err()
+	if err != nil {
+		return fmt.Errorf("ошибка записи присутствия: %w", err)
+	}
+	return nil
+}
+
+func (p *RedisPresence) Nodes(ctx context.Context, userID string) ([]string, error) {
+	devices, err := p.client.HGetAll(ctx, presencePrefix+userID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения присутствия: %w", err)
+	}
+
+	nodes := uniqueNodes(devices)
+	if len(nodes) == 0 {
+		return nodes, nil
+	}
+
+	// Отбрасываем узлы, которые перестали слать heartbeat
+	pipe := p.client.Pipeline()
+	checks := make([]*redis.IntCmd, len(nodes))
+	for i, nodeID := range nodes {
+		checks[i] = pipe.Exists(ctx, nodeAlivePrefix+nodeID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка чтения присутствия: %w", err)
+	}
+
+	alive := nodes[:0]
+	for i, nodeID := range nodes {
+		if checks[i].Val() > 0 {
+			alive = append(alive, nodeID)
+		}
+	}
+	return alive, nil
+}
+
+// Watch хранит подписки в sorted set watchers:{target_id}: score — срок подписки (unix)
+func (p *RedisPresence) Watch(ctx context.Context, watcherID string, targetIDs []string, ttl time.Duration) error {
+	expires := time.Now().Add(ttl)
+
+	_, err := p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, targetID := range targetIDs {
+			key := watchersPrefix + targetID
+			pipe.ZAdd(ctx, key, redis.Z{Score: float64(expires.Unix()), Member: watcherID})
+			pipe.ExpireAt(ctx, key, expires)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка записи подписки на присутствие: %w", err)
+	}
+	return nil
+}
+
+func (p *RedisPresence) Watchers(ctx context.Context, targetID string) ([]string, error) {
+	key := watchersPrefix + targetID
+	now := fmt.Sprintf("%d", time.Now().Unix())
+
+	var watchers *redis.StringSliceCmd
+	_, err := p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+now)
+		watchers = pipe.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: now, Max: "+inf"})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения подписок на присутствие: %w", err)
+	}
+	return watchers.Val(), nil
+}
+
+// Heartbeat периодически отмечает узел живым. Блокирует до отмены ctx.
+func (p *RedisPresence) Heartbeat(ctx context.Context, nodeID string) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.client.Set(ctx, nodeAlivePrefix+nodeID, 1, 3*heartbeatInterval).Err(); err != nil && ctx.Err() == nil {
+			log.Printf("❌ Redis heartbeat: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			p.client.Del(context.Background(), nodeAlivePrefix+nodeID)
+			return
+		case <-ticker.C:
+		}
+	}
+}
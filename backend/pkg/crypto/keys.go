@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"filippo.io/edwards25519"
+	"filippo.io/edwards25519/field"
+	"golang.org/x/crypto/curve25519"
+)
+
+// PublicKeySize — размер публичных ключей Curve25519 и Ed25519
+const PublicKeySize = 32
+
+var (
+	ErrKeyEncoding     = errors.New("key is not valid base64")
+	ErrKeySize         = fmt.Errorf("key must be %d bytes", PublicKeySize)
+	ErrKeyNotCanonical = errors.New("key is not a canonical point encoding")
+	ErrKeyNotOnCurve   = errors.New("key is not a point on the curve")
+	ErrKeyLowOrder     = errors.New("key is a low-order point")
+)
+
+// decodeKey декодирует Base64 (строго: без лишних бит в паддинге) и проверяет размер
+func decodeKey(publicKeyB64 string) ([]byte, error) {
+	key, err := base64.StdEncoding.Strict().DecodeString(publicKeyB64)
+	if err != nil {
+		return nil, ErrKeyEncoding
+	}
+	if len(key) != PublicKeySize {
+		return nil, ErrKeySize
+	}
+	return key, nil
+}
+
+// DecodeX25519PublicKey декодирует и проверяет публичный ключ Curve25519 (identity key, prekey).
+// Отклоняются неканонические координаты (u >= 2^255-19 или старший бит) и точки малого порядка:
+// с ними общий секрет ECDH предсказуем.
+func DecodeX25519PublicKey(publicKeyB64 string) ([]byte, error) {
+	key, err := decodeKey(publicKeyB64)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := new(field.Element).SetBytes(key)
+	if err != nil || !bytes.Equal(u.Bytes(), key) {
+		return nil, ErrKeyNotCanonical
+	}
+
+	// X25519 возвращает ошибку, если результат — нулевая точка, что бывает ровно на точках малого порядка
+	if _, err := curve25519.X25519(curve25519.Basepoint, key); err != nil {
+		return nil, ErrKeyLowOrder
+	}
+
+	return key, nil
+}
+
+// DecodeEd25519PublicKey декодирует и проверяет публичный ключ Ed25519 (signing key):
+// точка должна лежать на кривой, быть закодирована канонически и не иметь малый порядок.
+func DecodeEd25519PublicKey(publicKeyB64 string) ([]byte, error) {
+	key, err := decodeKey(publicKeyB64)
+	if err != nil {
+		return nil, err
+	}
+
+	point, err := new(edwards25519.Point).SetBytes(key)
+	if err != nil {
+		return nil, ErrKeyNotOnCurve
+	}
+	if !bytes.Equal(point.Bytes(), key) {
+		return nil, ErrKeyNotCanonical
+	}
+	if new(edwards25519.Point).MultByCofactor(point).Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, ErrKeyLowOrder
+	}
+
+	return key, nil
+}
+
+// KeyChangeMessage — строка, которую устройство подписывает старым ключом подписи при смене ключей.
+// Новые ключи передаются в Base64 ровно так, как они указаны в запросе.
+func KeyChangeMessage(userID, deviceID, identityKeyB64, signingKeyB64 string) string {
+	return fmt.Sprintf("securemesh:key-change:v1:%s:%s:%s:%s", userID, deviceID, identityKeyB64, signingKeyB64)
+}
+
+// RegistrationMessage — строка, которую клиент подписывает новым ключом подписи при регистрации
+// (proof-of-possession): без приватного ключа чужой ключ под своим именем не зарегистрировать.
+// Имя — нормализованное, ключи — в Base64 ровно так, как они указаны в запросе.
+func RegistrationMessage(username, identityKeyB64, signingKeyB64 string) string {
+	return fmt.Sprintf("securemesh:register:v1:%s:%s:%s", username, identityKeyB64, signingKeyB64)
+}
+
+// LinkMessage — строка, которую новое устройство подписывает своим ключом подписи при привязке
+// к аккаунту userID (proof-of-possession, как RegistrationMessage). Ключи — в Base64 ровно так,
+// как они указаны в запросе.
+func LinkMessage(userID, identityKeyB64, signingKeyB64 string) string {
+	return fmt.Sprintf("securemesh:link:v1:%s:%s:%s", userID, identityKeyB64, signingKeyB64)
+}
@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+func b64Hex(t *testing.T, s string) string {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("hex %q: %v", s, err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// nonStrict портит неиспользуемые биты перед паддингом: нестрогий декодер их игнорирует,
+// и у одного ключа появилось бы несколько кодировок
+func nonStrict(b64 string) string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	last := strings.IndexByte(alphabet, b64[len(b64)-2])
+	return b64[:len(b64)-2] + string(alphabet[last|1]) + "="
+}
+
+func TestDecodeX25519PublicKey(t *testing.T) {
+	scalar := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(scalar); err != nil {
+		t.Fatal(err)
+	}
+	public, err := curve25519.X25519(scalar, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := base64.StdEncoding.EncodeToString(public)
+
+	key, err := DecodeX25519PublicKey(valid)
+	if err != nil {
+		t.Fatalf("DecodeX25519PublicKey(valid): %v", err)
+	}
+	if string(key) != string(public) {
+		t.Errorf("DecodeX25519PublicKey(valid) = %x, want %x", key, public)
+	}
+
+	// Точки малого порядка и неканонические кодировки — из списка, который отклоняет libsodium
+	tests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"not base64", "not a key!", ErrKeyEncoding},
+		{"non-strict padding", nonStrict(valid), ErrKeyEncoding},
+		{"too short", base64.StdEncoding.EncodeToString(public[:31]), ErrKeySize},
+		{"too long", base64.StdEncoding.EncodeToString(append(public, 0)), ErrKeySize},
+		{"zero", b64Hex(t, "0000000000000000000000000000000000000000000000000000000000000000"), ErrKeyLowOrder},
+		{"one", b64Hex(t, "0100000000000000000000000000000000000000000000000000000000000000"), ErrKeyLowOrder},
+		{"order 8", b64Hex(t, "e0eb7a7c3b41b8ae1656e3faf19fc46ada098deb9c32b1fd866205165f49b800"), ErrKeyLowOrder},
+		{"order 8 (second)", b64Hex(t, "5f9c95bca3508c24b1d0b1559c83ef5b04445cc4581c8e86d8224eddd09f1157"), ErrKeyLowOrder},
+		{"p-1", b64Hex(t, "ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"), ErrKeyLowOrder},
+		{"p", b64Hex(t, "edffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"), ErrKeyNotCanonical},
+		{"p+1", b64Hex(t, "eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"), ErrKeyNotCanonical},
+		{"high bit", b64Hex(t, "0900000000000000000000000000000000000000000000000000000000000080"), ErrKeyNotCanonical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := DecodeX25519PublicKey(tt.key)
+			if !errors.Is(err, tt.want) || key != nil {
+				t.Errorf("DecodeX25519PublicKey() = %x, %v; want nil, %v", key, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeEd25519PublicKey(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := base64.StdEncoding.EncodeToString(public)
+
+	key, err := DecodeEd25519PublicKey(valid)
+	if err != nil {
+		t.Fatalf("DecodeEd25519PublicKey(valid): %v", err)
+	}
+	if string(key) != string(public) {
+		t.Errorf("DecodeEd25519PublicKey(valid) = %x, want %x", key, public)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"not base64", "not a key!", ErrKeyEncoding},
+		{"non-strict padding", nonStrict(valid), ErrKeyEncoding},
+		{"too short", base64.StdEncoding.EncodeToString(public[:31]), ErrKeySize},
+		{"not on curve", b64Hex(t, "0200000000000000000000000000000000000000000000000000000000000000"), ErrKeyNotOnCurve},
+		{"y = p+1", b64Hex(t, "eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"), ErrKeyNotCanonical},
+		{"negative zero x", b64Hex(t, "0100000000000000000000000000000000000000000000000000000000000080"), ErrKeyNotCanonical},
+		{"identity", b64Hex(t, "0100000000000000000000000000000000000000000000000000000000000000"), ErrKeyLowOrder},
+		{"order 2", b64Hex(t, "ecffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"), ErrKeyLowOrder},
+		{"order 4", b64Hex(t, "0000000000000000000000000000000000000000000000000000000000000000"), ErrKeyLowOrder},
+		{"order 8", b64Hex(t, "c7176a703d4dd84fba3c0b760d10670f2a2053fa2c39ccc64ec7fd7792ac037a"), ErrKeyLowOrder},
+		{"order 8 (second)", b64Hex(t, "26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05"), ErrKeyLowOrder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := DecodeEd25519PublicKey(tt.key)
+			if !errors.Is(err, tt.want) || key != nil {
+				t.Errorf("DecodeEd25519PublicKey() = %x, %v; want nil, %v", key, err, tt.want)
+			}
+		})
+	}
+}
+
+// Подпись сообщения о регистрации проверяется только тем ключом, которым сделана,
+// и только для тех же имени и ключей
+func TestRegistrationMessageSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey := base64.StdEncoding.EncodeToString(public)
+	message := RegistrationMessage("alice", "identity", signingKey)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(message)))
+
+	if err := VerifySignature(public, []byte(message), signature); err != nil {
+		t.Fatalf("VerifySignature(): %v", err)
+	}
+	if err := VerifySignature(public, []byte(RegistrationMessage("mallory", "identity", signingKey)), signature); err == nil {
+		t.Error("VerifySignature() accepted a signature over another username")
+	}
+	if err := VerifySignature(public, []byte(LinkMessage("alice", "identity", signingKey)), signature); err == nil {
+		t.Error("VerifySignature() accepted a registration signature as a link signature")
+	}
+
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySignature(other, []byte(message), signature); err == nil {
+		t.Error("VerifySignature() accepted a signature under another key")
+	}
+}
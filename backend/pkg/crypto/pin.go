@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры Argon2id для PIN регистрационной блокировки (рекомендация OWASP: 19 МиБ, 2 прохода)
+const (
+	pinMemory  = 19 * 1024
+	pinTime    = 2
+	pinThreads = 1
+	pinKeyLen  = 32
+	pinSaltLen = 16
+)
+
+var ErrInvalidPINHash = errors.New("неверный формат хэша PIN")
+
+// HashPIN возвращает Argon2id-хэш PIN в формате PHC:
+// $argon2id$v=19$m=19456,t=2,p=1$<соль>$<хэш>
+func HashPIN(pin string) (string, error) {
+	salt := make([]byte, pinSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(pin), salt, pinTime, pinMemory, pinThreads, pinKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, pinMemory, pinTime, pinThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// VerifyPIN сверяет PIN с хэшем из HashPIN. Параметры берутся из самого хэша,
+// поэтому старые хэши проверяются и после смены констант.
+func VerifyPIN(pin, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrInvalidPINHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidPINHash
+	}
+
+	var (
+		memory  uint32
+		time    uint32
+		threads uint8
+	)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil ||
+		memory == 0 || time == 0 || threads == 0 {
+		return false, ErrInvalidPINHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidPINHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	// Пустой хэш совпал бы с любым PIN
+	if err != nil || len(want) == 0 {
+		return false, ErrInvalidPINHash
+	}
+
+	got := argon2.IDKey([]byte(pin), salt, time, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestHashPINRoundTrip(t *testing.T) {
+	encoded, err := HashPIN("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("HashPIN() = %q, want PHC string with default parameters", encoded)
+	}
+
+	tests := []struct {
+		pin  string
+		want bool
+	}{
+		{"1234", true},
+		{"1235", false},
+		{"", false},
+		{"12345", false},
+	}
+	for _, tt := range tests {
+		ok, err := VerifyPIN(tt.pin, encoded)
+		if err != nil {
+			t.Fatalf("VerifyPIN(%q): %v", tt.pin, err)
+		}
+		if ok != tt.want {
+			t.Errorf("VerifyPIN(%q) = %v, want %v", tt.pin, ok, tt.want)
+		}
+	}
+}
+
+func TestHashPINUsesRandomSalt(t *testing.T) {
+	a, err := HashPIN("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := HashPIN("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("HashPIN() returned the same hash twice: salt is not random")
+	}
+}
+
+// Параметры читаются из хэша: хэш с другими m, t, p проверяется так же
+func TestVerifyPINUsesEncodedParameters(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	hash := argon2.IDKey([]byte("0000"), salt, 1, 8*1024, 2, 16)
+	encoded := fmt.Sprintf("$argon2id$v=19$m=8192,t=1,p=2$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	)
+
+	ok, err := VerifyPIN("0000", encoded)
+	if err != nil || !ok {
+		t.Errorf("VerifyPIN() = %v, %v; want true, nil", ok, err)
+	}
+	ok, err = VerifyPIN("0001", encoded)
+	if err != nil || ok {
+		t.Errorf("VerifyPIN() with a wrong PIN = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestVerifyPINRejectsMalformedHashes(t *testing.T) {
+	const (
+		salt = "MDEyMzQ1Njc4OWFiY2RlZg"
+		hash = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+	)
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"bcrypt", "$2a$10$abcdefghijklmnopqrstuuABCDEFGHIJKLMNOPQRSTUVWXYZ01234"},
+		{"argon2i", "$argon2i$v=19$m=19456,t=2,p=1$" + salt + "$" + hash},
+		{"old version", "$argon2id$v=16$m=19456,t=2,p=1$" + salt + "$" + hash},
+		{"no version", "$argon2id$m=19456,t=2,p=1$" + salt + "$" + hash},
+		{"bad params", "$argon2id$v=19$m=x,t=2,p=1$" + salt + "$" + hash},
+		{"zero memory", "$argon2id$v=19$m=0,t=2,p=1$" + salt + "$" + hash},
+		{"zero time", "$argon2id$v=19$m=19456,t=0,p=1$" + salt + "$" + hash},
+		{"zero threads", "$argon2id$v=19$m=19456,t=2,p=0$" + salt + "$" + hash},
+		{"bad salt", "$argon2id$v=19$m=19456,t=2,p=1$!!!$" + hash},
+		{"padded hash", "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$" + hash + "=="},
+		{"empty hash", "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$"},
+		{"extra field", "$argon2id$v=19$m=19456,t=2,p=1$" + salt + "$" + hash + "$x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := VerifyPIN("1234", tt.encoded)
+			if ok || !errors.Is(err, ErrInvalidPINHash) {
+				t.Errorf("VerifyPIN() = %v, %v; want false, ErrInvalidPINHash", ok, err)
+			}
+		})
+	}
+}
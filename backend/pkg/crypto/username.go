@@ -0,0 +1,43 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidUsername = errors.New("username: от 3 до 32 символов, латиница, цифры, '_' и '.', начинается с буквы")
+
+	usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.]{2,31}$`)
+)
+
+// NormalizeUsername приводит имя к каноническому виду: без пробелов по краям и в нижнем регистре.
+// "Alice" и " alice" — одно и то же имя.
+func NormalizeUsername(username string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(normalized) {
+		return "", ErrInvalidUsername
+	}
+	return normalized, nil
+}
+
+// UsernameHasher хэширует имена HMAC-SHA256 с секретом сервера (pepper):
+// по утёкшей БД имена не восстановить перебором словаря без pepper.
+type UsernameHasher struct {
+	pepper []byte
+}
+
+func NewUsernameHasher(pepper []byte) *UsernameHasher {
+	return &UsernameHasher{pepper: pepper}
+}
+
+// Hash возвращает hex HMAC-SHA256 уже нормализованного имени
+func (h *UsernameHasher) Hash(normalized string) string {
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -7,18 +7,13 @@ import (
 )
 
 // VerifySignature проверяет Ed25519 подпись
-// publicKeyB64 — Base64 публичный ключ (32 байта)
+// publicKey — публичный ключ (32 байта, как хранится в БД)
 // message — то, что подписывали
 // signatureB64 — Base64 подпись (64 байта)
-func VerifySignature(publicKeyB64 string, message []byte, signatureB64 string) error {
-	// 1. Декодируем публичный ключ
-	publicKeyBytes, err := base64.StdEncoding.DecodeString(publicKeyB64)
-	if err != nil {
-		return fmt.Errorf("invalid public key encoding: %w", err)
-	}
-
-	if len(publicKeyBytes) != ed25519.PublicKeySize {
-		return fmt.Errorf("invalid public key size: got %d, want %d", len(publicKeyBytes), ed25519.PublicKeySize)
+func VerifySignature(publicKey []byte, message []byte, signatureB64 string) error {
+	// 1. Проверяем публичный ключ
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key size: got %d, want %d", len(publicKey), ed25519.PublicKeySize)
 	}
 
 	// 2. Декодируем подпись
@@ -32,7 +27,7 @@ func VerifySignature(publicKeyB64 string, message []byte, signatureB64 string) e
 	}
 
 	// 3. Проверяем подпись
-	if !ed25519.Verify(publicKeyBytes, message, signatureBytes) {
+	if !ed25519.Verify(publicKey, message, signatureBytes) {
 		return fmt.Errorf("signature verification failed")
 	}
 
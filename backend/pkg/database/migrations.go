@@ -2,51 +2,335 @@ package database
 
 import (
 	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func RunMigrations(pool *pgxpool.Pool) error {
-	const createTables = `
-	CREATE TABLE IF NOT EXISTS users (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		username_hash TEXT NOT NULL UNIQUE,
-		public_identity_key BYTEA NOT NULL,
-		public_signing_key BYTEA,
-		registration_lock_hash TEXT,
-		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		deleted_at TIMESTAMPTZ
-	);
-	CREATE INDEX IF NOT EXISTS idx_users_username_hash ON users(username_hash);
-
-	DO $$ 
-	BEGIN 
-		IF NOT EXISTS (
-			SELECT 1 FROM information_schema.columns 
-			WHERE table_name = 'users' AND column_name = 'public_signing_key'
-		) THEN 
-			ALTER TABLE users ADD COLUMN public_signing_key BYTEA;
-		END IF;
-	END $$;
-
-	CREATE TABLE IF NOT EXISTS messages (
-		id UUID PRIMARY KEY,
-		type INT NOT NULL,
-		payload BYTEA NOT NULL,
-		sender_id UUID REFERENCES users(id),
-		recipient_id UUID REFERENCES users(id),
-		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	);
-	CREATE INDEX IF NOT EXISTS idx_messages_recipient ON messages(recipient_id);
-	CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at);
+// Миграции лежат в migrations/ парами NNNN_name.up.sql / NNNN_name.down.sql и вшиваются в бинарник.
+// Применённая миграция не редактируется: изменения схемы — только новым номером.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID — ключ advisory lock: миграции применяет одна реплика, остальные ждут
+const migrationLockID = 0x6d69_6772_6174_65 // "migrate"
+
+var (
+	ErrChecksumMismatch = errors.New("применённая миграция изменена после применения")
+	ErrNoDownMigration  = errors.New("у миграции нет down-скрипта")
+	ErrUnknownMigration = errors.New("в БД есть миграции новее этой версии сервера")
+)
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration — одна версия схемы
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 up-скрипта, сверяется с записанным при применении
+}
+
+// MigrationStatus — миграция и её состояние в БД
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil — не применена
+	Modified  bool       // up-скрипт отличается от применённого
+	Unknown   bool       // есть в БД, но не в этом бинарнике (БД мигрировала более новая версия)
+}
+
+// LoadMigrations читает миграции из fsys (файлы *.sql в корне), отсортированные по версии
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения миграций: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения миграции %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("миграция %d: разные имена %q и %q", version, m.Name, match[2])
+		}
+
+		// 0001_x и 1_x — одна версия: второй файл молча заменил бы первый
+		if (match[3] == "up" && m.Up != "") || (match[3] == "down" && m.Down != "") {
+			return nil, fmt.Errorf("миграция %d: несколько %s-скриптов", version, match[3])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(body)
+			sum := sha256.Sum256(body)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("миграция %04d_%s: нет up-скрипта", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Migrator применяет и откатывает миграции. Все операции идут под advisory lock,
+// поэтому реплики, стартующие одновременно, не применяют одну миграцию дважды.
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator создаёт мигратор со встроенными миграциями
+func NewMigrator(pool *pgxpool.Pool) (*Migrator, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(sub)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// withLock выполняет fn на отдельном соединении под advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения для миграций: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("ошибка блокировки миграций: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
 	`
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("ошибка создания schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("ошибка чтения schema_migrations: %w", err)
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// verify сверяет контрольные суммы применённых миграций с вшитыми
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	known := make(map[int]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		if a, ok := applied[mig.Version]; ok && a.checksum != mig.Checksum {
+			return fmt.Errorf("%04d_%s: %w", mig.Version, mig.Name, ErrChecksumMismatch)
+		}
+	}
+
+	// Более новая версия сервера уже мигрировала БД — работаем, но предупреждаем
+	for version, a := range applied {
+		if !known[version] {
+			log.Printf("⚠️ Миграция %04d_%s есть в БД, но не в этой версии сервера", version, a.name)
+		}
+	}
+	return nil
+}
+
+// Up применяет все неприменённые миграции по порядку, каждую в своей транзакции.
+// Возвращает число применённых.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				query := `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`
+				_, err := tx.Exec(ctx, query, mig.Version, mig.Name, mig.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка миграции %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			log.Printf("📦 Миграция %04d_%s применена", mig.Version, mig.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down откатывает steps последних применённых миграций в обратном порядке.
+// Возвращает число откаченных.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+		// Откатывать можно только с конца: миграции новой версии сервера откатывает она сама
+		latest := 0
+		if len(m.migrations) > 0 {
+			latest = m.migrations[len(m.migrations)-1].Version
+		}
+		for version := range applied {
+			if version > latest {
+				return fmt.Errorf("%04d: %w", version, ErrUnknownMigration)
+			}
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%04d_%s: %w", mig.Version, mig.Name, ErrNoDownMigration)
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("ошибка отката %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			log.Printf("↩️ Миграция %04d_%s откачена", mig.Version, mig.Name)
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status возвращает состояние всех миграций: вшитых и найденных только в БД
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if a, ok := applied[mig.Version]; ok {
+				appliedAt := a.appliedAt
+				status.AppliedAt = &appliedAt
+				status.Modified = a.checksum != mig.Checksum
+				delete(applied, mig.Version)
+			}
+			statuses = append(statuses, status)
+		}
+
+		for version, a := range applied {
+			appliedAt := a.appliedAt
+			statuses = append(statuses, MigrationStatus{Version: version, Name: a.name, AppliedAt: &appliedAt, Unknown: true})
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+// RunMigrations применяет все новые миграции (вызывается при старте сервера)
+func RunMigrations(pool *pgxpool.Pool) error {
+	migrator, err := NewMigrator(pool)
+	if err != nil {
+		return err
+	}
 
-	_, err := pool.Exec(context.Background(), createTables)
+	applied, err := migrator.Up(context.Background())
 	if err != nil {
 		return err
 	}
 
-	log.Println("📦 Миграции БД применены успешно")
+	log.Printf("📦 Миграции БД применены успешно (новых: %d)", applied)
 	return nil
 }
@@ -0,0 +1,94 @@
+-- Схема до появления версионных миграций. Все операторы идемпотентны:
+-- базы, созданные старым RunMigrations, принимают эту миграцию без изменений.
+
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	username_hash TEXT NOT NULL UNIQUE,
+	public_identity_key BYTEA NOT NULL,
+	public_signing_key BYTEA,
+	registration_lock_hash TEXT,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	deleted_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_users_username_hash ON users(username_hash);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS public_signing_key BYTEA;
+
+-- Присутствие: время последнего визита и кому его показывать
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_seen_visibility TEXT NOT NULL DEFAULT 'everyone';
+
+-- username_hash — HMAC имени с pepper сервера. Версия 0 — открытое имя из старых версий,
+-- такие строки перехэшируются при старте; новые строки сразу получают версию 1
+ALTER TABLE users ADD COLUMN IF NOT EXISTS username_hash_version SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE users ALTER COLUMN username_hash_version SET DEFAULT 1;
+
+-- Регистрационная блокировка: счётчик неверных PIN подряд и блокировка попыток до registration_lock_until
+ALTER TABLE users ADD COLUMN IF NOT EXISTS registration_lock_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS registration_lock_until TIMESTAMPTZ;
+
+-- Устройства: у каждого своя пара ключей, основное создаётся при регистрации
+CREATE TABLE IF NOT EXISTS devices (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL DEFAULT '',
+	public_identity_key BYTEA NOT NULL,
+	public_signing_key BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_devices_user ON devices(user_id);
+
+-- Юзерам, зарегистрированным до появления устройств, заводим основное
+INSERT INTO devices (user_id, name, public_identity_key, public_signing_key, created_at)
+SELECT u.id, '', u.public_identity_key, u.public_signing_key, u.created_at
+FROM users u
+WHERE u.public_signing_key IS NOT NULL
+	AND NOT EXISTS (SELECT 1 FROM devices d WHERE d.user_id = u.id);
+
+-- Prekeys для X3DH: один signed prekey и пул одноразовых на устройство
+CREATE TABLE IF NOT EXISTS signed_prekeys (
+	device_id UUID PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+	key_id INT NOT NULL,
+	public_key BYTEA NOT NULL,
+	signature BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS one_time_prekeys (
+	device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	key_id INT NOT NULL,
+	public_key BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (device_id, key_id)
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id UUID PRIMARY KEY,
+	type INT NOT NULL,
+	payload BYTEA NOT NULL,
+	sender_id UUID REFERENCES users(id),
+	recipient_id UUID REFERENCES users(id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_messages_recipient ON messages(recipient_id);
+-- Keyset-пагинация истории по (created_at, id) с обеих сторон диалога
+CREATE INDEX IF NOT EXISTS idx_messages_sender_history ON messages(sender_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_messages_recipient_history ON messages(recipient_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at);
+
+-- Офлайн-очередь: сообщение ждёт, пока получатель не пришлёт ACK
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_messages_pending ON messages(recipient_id, created_at) WHERE delivered_at IS NULL;
+
+-- Статусы доставки: receipt_pending — отправитель ещё не получил квитанцию
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS read_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS receipt_pending BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_messages_receipts ON messages(sender_id) WHERE receipt_pending;
+
+-- Мультидевайс: доставка отслеживается по каждому устройству
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS sender_device_id UUID REFERENCES devices(id);
+CREATE TABLE IF NOT EXISTS message_deliveries (
+	message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	delivered_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (message_id, device_id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS auth_challenges;
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,32 @@
+-- Refresh-токены: в БД только SHA-256; family_id — сессия, в которой токены сменяют друг друга
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	family_id UUID NOT NULL,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	token_hash BYTEA NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(user_id) WHERE used_at IS NULL AND revoked_at IS NULL;
+
+-- Отзыв JWT: отдельные токены по jti и "выйти везде" (все токены, выданные раньше tokens_valid_after)
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens(expires_at);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_valid_after TIMESTAMPTZ;
+
+-- Одноразовые challenge для /auth/token: nonce живёт минуту и сгорает при первом использовании
+CREATE TABLE IF NOT EXISTS auth_challenges (
+	nonce TEXT PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_auth_challenges_expires ON auth_challenges(expires_at);
@@ -0,0 +1,11 @@
+-- История ключей устройств: каждая смена подписана предыдущим ключом (proof)
+CREATE TABLE IF NOT EXISTS user_keys (
+	id BIGSERIAL PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	public_identity_key BYTEA NOT NULL,
+	public_signing_key BYTEA NOT NULL,
+	proof BYTEA,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_user_keys_user ON user_keys(user_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS kt_tree_heads;
+DROP TABLE IF EXISTS kt_leaves;
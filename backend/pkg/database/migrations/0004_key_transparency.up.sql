@@ -0,0 +1,23 @@
+-- Журнал прозрачности ключей (Merkle-лог, только дописывается).
+-- identity_key/signing_key — как в devices, для поиска неопубликованных ключей; entry — данные листа.
+CREATE TABLE IF NOT EXISTS kt_leaves (
+	idx BIGINT PRIMARY KEY,
+	user_id UUID NOT NULL,
+	device_id UUID NOT NULL,
+	epoch BIGINT NOT NULL,
+	identity_key BYTEA NOT NULL,
+	signing_key BYTEA NOT NULL,
+	entry BYTEA NOT NULL,
+	leaf_hash BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_kt_leaves_device ON kt_leaves(device_id, idx);
+CREATE INDEX IF NOT EXISTS idx_kt_leaves_user ON kt_leaves(user_id, epoch);
+
+-- Подписанные корни журнала (STH), по одному на каждый размер дерева
+CREATE TABLE IF NOT EXISTS kt_tree_heads (
+	tree_size BIGINT PRIMARY KEY,
+	root_hash BYTEA NOT NULL,
+	timestamp_ms BIGINT NOT NULL,
+	signature BYTEA NOT NULL
+);
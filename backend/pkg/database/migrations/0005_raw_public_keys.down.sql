@@ -0,0 +1,17 @@
+-- Обратно в байты Base64-строки: так ключи хранились до 0005
+UPDATE users SET
+	public_identity_key = convert_to(encode(public_identity_key, 'base64'), 'UTF8'),
+	public_signing_key = convert_to(encode(public_signing_key, 'base64'), 'UTF8')
+WHERE length(public_identity_key) = 32;
+UPDATE devices SET
+	public_identity_key = convert_to(encode(public_identity_key, 'base64'), 'UTF8'),
+	public_signing_key = convert_to(encode(public_signing_key, 'base64'), 'UTF8')
+WHERE length(public_identity_key) = 32;
+UPDATE user_keys SET
+	public_identity_key = convert_to(encode(public_identity_key, 'base64'), 'UTF8'),
+	public_signing_key = convert_to(encode(public_signing_key, 'base64'), 'UTF8')
+WHERE length(public_identity_key) = 32;
+UPDATE kt_leaves SET
+	identity_key = convert_to(encode(identity_key, 'base64'), 'UTF8'),
+	signing_key = convert_to(encode(signing_key, 'base64'), 'UTF8')
+WHERE length(identity_key) = 32;
@@ -0,0 +1,26 @@
+-- Ключи раньше хранились как байты Base64-строки (44 символа), теперь — декодированные 32 байта.
+-- Повторный запуск ничего не меняет: сырые ключи короче 44 байт.
+CREATE OR REPLACE FUNCTION pg_temp.decode_legacy_key(k BYTEA) RETURNS BYTEA AS $$
+	SELECT CASE
+		WHEN length(k) = 44 AND convert_from(k, 'UTF8') ~ '^[A-Za-z0-9+/]{43}=$'
+		THEN decode(convert_from(k, 'UTF8'), 'base64')
+		ELSE k
+	END
+$$ LANGUAGE SQL IMMUTABLE;
+
+UPDATE users SET
+	public_identity_key = pg_temp.decode_legacy_key(public_identity_key),
+	public_signing_key = pg_temp.decode_legacy_key(public_signing_key)
+WHERE length(public_identity_key) = 44 OR length(public_signing_key) = 44;
+UPDATE devices SET
+	public_identity_key = pg_temp.decode_legacy_key(public_identity_key),
+	public_signing_key = pg_temp.decode_legacy_key(public_signing_key)
+WHERE length(public_identity_key) = 44 OR length(public_signing_key) = 44;
+UPDATE user_keys SET
+	public_identity_key = pg_temp.decode_legacy_key(public_identity_key),
+	public_signing_key = pg_temp.decode_legacy_key(public_signing_key)
+WHERE length(public_identity_key) = 44 OR length(public_signing_key) = 44;
+UPDATE kt_leaves SET
+	identity_key = pg_temp.decode_legacy_key(identity_key),
+	signing_key = pg_temp.decode_legacy_key(signing_key)
+WHERE length(identity_key) = 44 OR length(signing_key) = 44;
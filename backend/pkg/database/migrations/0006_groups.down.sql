@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_messages_group;
+ALTER TABLE messages DROP COLUMN IF EXISTS group_id;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
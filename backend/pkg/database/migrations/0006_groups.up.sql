@@ -0,0 +1,22 @@
+-- Групповые чаты. Название и аватар шифруют клиенты, сервер хранит их как непрозрачные metadata.
+CREATE TABLE groups (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	metadata BYTEA NOT NULL DEFAULT '',
+	created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Участники: role — owner (один на группу), admin или member.
+CREATE TABLE group_members (
+	group_id UUID NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+	added_by UUID REFERENCES users(id) ON DELETE SET NULL,
+	joined_at TIMESTAMPTZ NOT NULL DEFAULT date_trunc('second', NOW()),
+	PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX idx_group_members_user ON group_members(user_id);
+
+-- Сообщение группы хранится один раз (recipient_id пуст), доставка — по устройствам в message_deliveries
+ALTER TABLE messages ADD COLUMN group_id UUID REFERENCES groups(id) ON DELETE CASCADE;
+CREATE INDEX idx_messages_group ON messages(group_id, created_at, id) WHERE group_id IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS recipient_device_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS group_epoch;
+ALTER TABLE groups DROP COLUMN IF EXISTS epoch;
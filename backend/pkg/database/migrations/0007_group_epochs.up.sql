@@ -0,0 +1,8 @@
+-- Эпоха группы растёт при каждом изменении состава: клиенты меняют ключи отправителя,
+-- а сообщения под ключами прошлой эпохи сервер не принимает.
+ALTER TABLE groups ADD COLUMN epoch BIGINT NOT NULL DEFAULT 1;
+
+-- group_epoch — под какой эпохой зашифровано сообщение группы.
+-- recipient_device_id — сообщение для одного устройства получателя (ключ отправителя шифруется под каждое).
+ALTER TABLE messages ADD COLUMN group_epoch BIGINT;
+ALTER TABLE messages ADD COLUMN recipient_device_id UUID REFERENCES devices(id) ON DELETE CASCADE;
@@ -0,0 +1,20 @@
+-- Вложения: файлы шифруют клиенты, сервер хранит объект в blob-хранилище (ключ = id) и учёт здесь.
+-- uploaded_at пуст, пока клиент не подтвердил загрузку; после expires_at вложение удаляется.
+CREATE TABLE attachments (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	owner_id UUID REFERENCES users(id) ON DELETE SET NULL,
+	size BIGINT NOT NULL CHECK (size > 0),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	uploaded_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_attachments_owner ON attachments(owner_id) WHERE uploaded_at IS NULL;
+CREATE INDEX idx_attachments_expires ON attachments(expires_at);
+
+-- Какие сообщения ссылаются на вложение: по ним проверяется доступ и ищутся неиспользуемые
+CREATE TABLE message_attachments (
+	message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	attachment_id UUID NOT NULL REFERENCES attachments(id) ON DELETE CASCADE,
+	PRIMARY KEY (message_id, attachment_id)
+);
+CREATE INDEX idx_message_attachments_attachment ON message_attachments(attachment_id);
@@ -0,0 +1,22 @@
+-- Докачиваемые загрузки больших вложений через API (tus-подобный протокол).
+-- Каждый принятый кусок лежит отдельным объектом в blob-хранилище; при получении последнего
+-- куски склеиваются в объект вложения, сверяется sha256 всего файла, записи удаляются.
+-- Незавершённые загрузки удаляются после expires_at (продлевается каждым куском).
+CREATE TABLE uploads (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	attachment_id UUID NOT NULL UNIQUE REFERENCES attachments(id) ON DELETE CASCADE,
+	size BIGINT NOT NULL CHECK (size > 0),
+	received BIGINT NOT NULL DEFAULT 0 CHECK (received >= 0 AND received <= size),
+	sha256 BYTEA NOT NULL CHECK (octet_length(sha256) = 32),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX idx_uploads_expires ON uploads(expires_at);
+
+CREATE TABLE upload_chunks (
+	upload_id UUID NOT NULL REFERENCES uploads(id) ON DELETE CASCADE,
+	start_offset BIGINT NOT NULL,
+	size BIGINT NOT NULL CHECK (size > 0),
+	blob_key TEXT NOT NULL,
+	PRIMARY KEY (upload_id, start_offset)
+);
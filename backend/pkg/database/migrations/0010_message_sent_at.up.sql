@@ -0,0 +1,4 @@
+-- created_at ставит сервер: по нему строятся очереди, история и доступ к вложениям.
+-- Время отправки по часам клиента хранится отдельно и только отдаётся клиентам как метаданные.
+ALTER TABLE messages ADD COLUMN sent_at BIGINT;
+UPDATE messages SET sent_at = EXTRACT(EPOCH FROM created_at)::bigint;
@@ -0,0 +1,9 @@
+-- Квитанции отправителю отслеживаются по каждому его устройству: receipt_pending снимается,
+-- только когда квитанцию получили все активные устройства отправителя.
+-- read — устройство получило квитанцию READ (иначе только DELIVERED).
+CREATE TABLE receipt_deliveries (
+	message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+	read BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (message_id, device_id)
+);
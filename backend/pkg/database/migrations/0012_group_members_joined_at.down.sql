@@ -0,0 +1 @@
+ALTER TABLE group_members ALTER COLUMN joined_at SET DEFAULT date_trunc('second', NOW());
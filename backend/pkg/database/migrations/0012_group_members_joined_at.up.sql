@@ -0,0 +1,3 @@
+-- created_at сообщений ставит БД с точностью до микросекунд, поэтому и joined_at не округляется:
+-- иначе новый участник видел бы сообщения и вложения, отправленные за секунду до вступления.
+ALTER TABLE group_members ALTER COLUMN joined_at SET DEFAULT NOW();
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func file(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func TestLoadMigrationsOrderAndChecksums(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0010_tenth.up.sql":   file("CREATE TABLE tenth ();"),
+		"0010_tenth.down.sql": file("DROP TABLE tenth;"),
+		"0002_second.up.sql":  file("CREATE TABLE second ();"),
+		"0001_first.up.sql":   file("CREATE TABLE first ();"),
+		"0001_first.down.sql": file("DROP TABLE first;"),
+		"README.md":           file("не миграция"),
+		"0003_draft.sql":      file("нет направления"),
+		"0004_dir.up.sql/x":   file("каталог, а не файл"),
+	}
+
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		version  int
+		name     string
+		up, down string
+	}{
+		{1, "first", "CREATE TABLE first ();", "DROP TABLE first;"},
+		{2, "second", "CREATE TABLE second ();", ""},
+		{10, "tenth", "CREATE TABLE tenth ();", "DROP TABLE tenth;"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("LoadMigrations() returned %d migrations, want %d", len(migrations), len(want))
+	}
+	for i, w := range want {
+		m := migrations[i]
+		if m.Version != w.version || m.Name != w.name || m.Up != w.up || m.Down != w.down {
+			t.Errorf("migrations[%d] = %d %q up=%q down=%q, want %d %q up=%q down=%q",
+				i, m.Version, m.Name, m.Up, m.Down, w.version, w.name, w.up, w.down)
+		}
+		sum := sha256.Sum256([]byte(w.up))
+		if m.Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("migrations[%d].Checksum = %s, want SHA-256 of the up script", i, m.Checksum)
+		}
+	}
+}
+
+// Контрольная сумма считается только по up-скрипту: правка down не делает миграцию изменённой
+func TestLoadMigrationsChecksumIgnoresDown(t *testing.T) {
+	load := func(down string) string {
+		t.Helper()
+		migrations, err := LoadMigrations(fstest.MapFS{
+			"0001_first.up.sql":   file("CREATE TABLE first ();"),
+			"0001_first.down.sql": file(down),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return migrations[0].Checksum
+	}
+
+	if load("DROP TABLE first;") != load("DROP TABLE IF EXISTS first;") {
+		t.Error("Checksum changed when only the down script changed")
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{"0001_first.down.sql": file("DROP TABLE first;")},
+			want: "нет up-скрипта",
+		},
+		{
+			name: "names differ",
+			fsys: fstest.MapFS{
+				"0001_first.up.sql":   file("CREATE TABLE first ();"),
+				"0001_other.down.sql": file("DROP TABLE first;"),
+			},
+			want: "разные имена",
+		},
+		{
+			name: "same version twice",
+			fsys: fstest.MapFS{
+				"0001_first.up.sql": file("CREATE TABLE first ();"),
+				"1_first.up.sql":    file("CREATE TABLE other ();"),
+			},
+			want: "несколько up-скриптов",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadMigrations(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadMigrations() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// Вшитые миграции идут подряд с 0001 и у каждой есть down-скрипт
+func TestEmbeddedMigrations(t *testing.T) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := LoadMigrations(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %04d_%s: want version %d, versions must be contiguous", m.Version, m.Name, i+1)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
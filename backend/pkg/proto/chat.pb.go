@@ -24,31 +24,55 @@ const (
 type WebSocketMessage_Type int32
 
 const (
-	WebSocketMessage_UNKNOWN      WebSocketMessage_Type = 0
-	WebSocketMessage_AUTH         WebSocketMessage_Type = 1
-	WebSocketMessage_TEXT_MESSAGE WebSocketMessage_Type = 2
-	WebSocketMessage_ACK          WebSocketMessage_Type = 3
-	WebSocketMessage_TYPING       WebSocketMessage_Type = 4
-	WebSocketMessage_ERROR        WebSocketMessage_Type = 5
+	WebSocketMessage_UNKNOWN                 WebSocketMessage_Type = 0
+	WebSocketMessage_AUTH                    WebSocketMessage_Type = 1
+	WebSocketMessage_TEXT_MESSAGE            WebSocketMessage_Type = 2
+	WebSocketMessage_ACK                     WebSocketMessage_Type = 3
+	WebSocketMessage_TYPING                  WebSocketMessage_Type = 4
+	WebSocketMessage_ERROR                   WebSocketMessage_Type = 5
+	WebSocketMessage_HISTORY_REQUEST         WebSocketMessage_Type = 6  // Запрос истории (payload: HistoryRequest)
+	WebSocketMessage_HISTORY_RESPONSE        WebSocketMessage_Type = 7  // Ответ сервера (payload: HistoryResponse, id как у запроса)
+	WebSocketMessage_PRESENCE                WebSocketMessage_Type = 8  // Онлайн-статус контакта (payload: PresencePayload)
+	WebSocketMessage_PRESENCE_SUBSCRIBE      WebSocketMessage_Type = 9  // Подписка на статусы (payload: PresenceSubscribe)
+	WebSocketMessage_KEY_CHANGED             WebSocketMessage_Type = 10 // Контакт сменил ключи (payload: KeyChangedPayload, шлёт только сервер)
+	WebSocketMessage_GROUP_EVENT             WebSocketMessage_Type = 11 // Событие группы (payload: GroupEvent, шлёт только сервер)
+	WebSocketMessage_SENDER_KEY_DISTRIBUTION WebSocketMessage_Type = 12 // Ключ отправителя в группе (от клиента — SenderKeyBundle, устройству — шифротекст)
+	WebSocketMessage_ATTACHMENT              WebSocketMessage_Type = 13 // Сообщение с вложениями (в шифротексте — AttachmentPointer, id — в attachment_ids)
 )
 
 // Enum value maps for WebSocketMessage_Type.
 var (
 	WebSocketMessage_Type_name = map[int32]string{
-		0: "UNKNOWN",
-		1: "AUTH",
-		2: "TEXT_MESSAGE",
-		3: "ACK",
-		4: "TYPING",
-		5: "ERROR",
+		0:  "UNKNOWN",
+		1:  "AUTH",
+		2:  "TEXT_MESSAGE",
+		3:  "ACK",
+		4:  "TYPING",
+		5:  "ERROR",
+		6:  "HISTORY_REQUEST",
+		7:  "HISTORY_RESPONSE",
+		8:  "PRESENCE",
+		9:  "PRESENCE_SUBSCRIBE",
+		10: "KEY_CHANGED",
+		11: "GROUP_EVENT",
+		12: "SENDER_KEY_DISTRIBUTION",
+		13: "ATTACHMENT",
 	}
 	WebSocketMessage_Type_value = map[string]int32{
-		"UNKNOWN":      0,
-		"AUTH":         1,
-		"TEXT_MESSAGE": 2,
-		"ACK":          3,
-		"TYPING":       4,
-		"ERROR":        5,
+		"UNKNOWN":                 0,
+		"AUTH":                    1,
+		"TEXT_MESSAGE":            2,
+		"ACK":                     3,
+		"TYPING":                  4,
+		"ERROR":                   5,
+		"HISTORY_REQUEST":         6,
+		"HISTORY_RESPONSE":        7,
+		"PRESENCE":                8,
+		"PRESENCE_SUBSCRIBE":      9,
+		"KEY_CHANGED":             10,
+		"GROUP_EVENT":             11,
+		"SENDER_KEY_DISTRIBUTION": 12,
+		"ATTACHMENT":              13,
 	}
 )
 
@@ -79,6 +103,226 @@ func (WebSocketMessage_Type) EnumDescriptor() ([]byte, []int) {
 	return file_chat_proto_rawDescGZIP(), []int{0, 0}
 }
 
+type AckPayload_Status int32
+
+const (
+	AckPayload_DELIVERED AckPayload_Status = 0 // Доставлено на устройство получателя
+	AckPayload_READ      AckPayload_Status = 1 // Прочитано получателем
+	AckPayload_SERVER    AckPayload_Status = 2 // Сервер сохранил сообщение
+)
+
+// Enum value maps for AckPayload_Status.
+var (
+	AckPayload_Status_name = map[int32]string{
+		0: "DELIVERED",
+		1: "READ",
+		2: "SERVER",
+	}
+	AckPayload_Status_value = map[string]int32{
+		"DELIVERED": 0,
+		"READ":      1,
+		"SERVER":    2,
+	}
+)
+
+func (x AckPayload_Status) Enum() *AckPayload_Status {
+	p := new(AckPayload_Status)
+	*p = x
+	return p
+}
+
+func (x AckPayload_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AckPayload_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_chat_proto_enumTypes[1].Descriptor()
+}
+
+func (AckPayload_Status) Type() protoreflect.EnumType {
+	return &file_chat_proto_enumTypes[1]
+}
+
+func (x AckPayload_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AckPayload_Status.Descriptor instead.
+func (AckPayload_Status) EnumDescriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{1, 0}
+}
+
+type TypingPayload_State int32
+
+const (
+	TypingPayload_STARTED TypingPayload_State = 0
+	TypingPayload_STOPPED TypingPayload_State = 1
+)
+
+// Enum value maps for TypingPayload_State.
+var (
+	TypingPayload_State_name = map[int32]string{
+		0: "STARTED",
+		1: "STOPPED",
+	}
+	TypingPayload_State_value = map[string]int32{
+		"STARTED": 0,
+		"STOPPED": 1,
+	}
+)
+
+func (x TypingPayload_State) Enum() *TypingPayload_State {
+	p := new(TypingPayload_State)
+	*p = x
+	return p
+}
+
+func (x TypingPayload_State) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TypingPayload_State) Descriptor() protoreflect.EnumDescriptor {
+	return file_chat_proto_enumTypes[2].Descriptor()
+}
+
+func (TypingPayload_State) Type() protoreflect.EnumType {
+	return &file_chat_proto_enumTypes[2]
+}
+
+func (x TypingPayload_State) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TypingPayload_State.Descriptor instead.
+func (TypingPayload_State) EnumDescriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{2, 0}
+}
+
+type ErrorPayload_Code int32
+
+const (
+	ErrorPayload_INTERNAL            ErrorPayload_Code = 0
+	ErrorPayload_MALFORMED_FRAME     ErrorPayload_Code = 1 // Кадр не разбирается как protobuf
+	ErrorPayload_UNAUTHORIZED        ErrorPayload_Code = 2 // Действие запрещено этому устройству
+	ErrorPayload_RECIPIENT_NOT_FOUND ErrorPayload_Code = 3 // Получателя нет
+	ErrorPayload_RATE_LIMITED        ErrorPayload_Code = 4 // Слишком много кадров, повторить позже
+	ErrorPayload_PERSISTENCE_FAILED  ErrorPayload_Code = 5 // Не удалось сохранить сообщение
+	ErrorPayload_INVALID_MESSAGE     ErrorPayload_Code = 6 // Кадр разобран, но поля неверные
+	ErrorPayload_NOT_GROUP_MEMBER    ErrorPayload_Code = 7 // Отправитель не состоит в группе (или группы нет)
+	ErrorPayload_STALE_GROUP_EPOCH   ErrorPayload_Code = 8 // Состав группы изменился: нужно разослать новый ключ и отправить заново
+)
+
+// Enum value maps for ErrorPayload_Code.
+var (
+	ErrorPayload_Code_name = map[int32]string{
+		0: "INTERNAL",
+		1: "MALFORMED_FRAME",
+		2: "UNAUTHORIZED",
+		3: "RECIPIENT_NOT_FOUND",
+		4: "RATE_LIMITED",
+		5: "PERSISTENCE_FAILED",
+		6: "INVALID_MESSAGE",
+		7: "NOT_GROUP_MEMBER",
+		8: "STALE_GROUP_EPOCH",
+	}
+	ErrorPayload_Code_value = map[string]int32{
+		"INTERNAL":            0,
+		"MALFORMED_FRAME":     1,
+		"UNAUTHORIZED":        2,
+		"RECIPIENT_NOT_FOUND": 3,
+		"RATE_LIMITED":        4,
+		"PERSISTENCE_FAILED":  5,
+		"INVALID_MESSAGE":     6,
+		"NOT_GROUP_MEMBER":    7,
+		"STALE_GROUP_EPOCH":   8,
+	}
+)
+
+func (x ErrorPayload_Code) Enum() *ErrorPayload_Code {
+	p := new(ErrorPayload_Code)
+	*p = x
+	return p
+}
+
+func (x ErrorPayload_Code) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorPayload_Code) Descriptor() protoreflect.EnumDescriptor {
+	return file_chat_proto_enumTypes[3].Descriptor()
+}
+
+func (ErrorPayload_Code) Type() protoreflect.EnumType {
+	return &file_chat_proto_enumTypes[3]
+}
+
+func (x ErrorPayload_Code) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorPayload_Code.Descriptor instead.
+func (ErrorPayload_Code) EnumDescriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{5, 0}
+}
+
+type GroupEvent_Kind int32
+
+const (
+	GroupEvent_CREATED        GroupEvent_Kind = 0 // Группа создана, user_ids — первые участники
+	GroupEvent_MEMBERS_ADDED  GroupEvent_Kind = 1 // Админ добавил участников
+	GroupEvent_MEMBER_LEFT    GroupEvent_Kind = 2 // Участник вышел сам
+	GroupEvent_MEMBER_REMOVED GroupEvent_Kind = 3 // Админ исключил участника
+	GroupEvent_ROLE_CHANGED   GroupEvent_Kind = 4 // Роль участника изменилась (role)
+	GroupEvent_UPDATED        GroupEvent_Kind = 5 // Изменены метаданные группы (metadata)
+)
+
+// Enum value maps for GroupEvent_Kind.
+var (
+	GroupEvent_Kind_name = map[int32]string{
+		0: "CREATED",
+		1: "MEMBERS_ADDED",
+		2: "MEMBER_LEFT",
+		3: "MEMBER_REMOVED",
+		4: "ROLE_CHANGED",
+		5: "UPDATED",
+	}
+	GroupEvent_Kind_value = map[string]int32{
+		"CREATED":        0,
+		"MEMBERS_ADDED":  1,
+		"MEMBER_LEFT":    2,
+		"MEMBER_REMOVED": 3,
+		"ROLE_CHANGED":   4,
+		"UPDATED":        5,
+	}
+)
+
+func (x GroupEvent_Kind) Enum() *GroupEvent_Kind {
+	p := new(GroupEvent_Kind)
+	*p = x
+	return p
+}
+
+func (x GroupEvent_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (GroupEvent_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_chat_proto_enumTypes[4].Descriptor()
+}
+
+func (GroupEvent_Kind) Type() protoreflect.EnumType {
+	return &file_chat_proto_enumTypes[4]
+}
+
+func (x GroupEvent_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use GroupEvent_Kind.Descriptor instead.
+func (GroupEvent_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{9, 0}
+}
+
 type WebSocketMessage struct {
 	state     protoimpl.MessageState `protogen:"open.v1"`
 	Type      WebSocketMessage_Type  `protobuf:"varint,1,opt,name=type,proto3,enum=securemesh.WebSocketMessage_Type" json:"type,omitempty"`
@@ -86,10 +330,15 @@ type WebSocketMessage struct {
 	Payload   []byte                 `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
 	Timestamp int64                  `protobuf:"varint,4,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
 	// === НОВЫЕ ПОЛЯ ===
-	SenderId      string `protobuf:"bytes,5,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`          // Кто отправил (UUID)
-	RecipientId   string `protobuf:"bytes,6,opt,name=recipient_id,json=recipientId,proto3" json:"recipient_id,omitempty"` // Кому отправить (UUID)
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	SenderId          string   `protobuf:"bytes,5,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`                               // Кто отправил (UUID)
+	RecipientId       string   `protobuf:"bytes,6,opt,name=recipient_id,json=recipientId,proto3" json:"recipient_id,omitempty"`                      // Кому отправить (UUID)
+	SenderDeviceId    string   `protobuf:"bytes,7,opt,name=sender_device_id,json=senderDeviceId,proto3" json:"sender_device_id,omitempty"`           // С какого устройства отправлено (ставит сервер)
+	GroupId           string   `protobuf:"bytes,8,opt,name=group_id,json=groupId,proto3" json:"group_id,omitempty"`                                  // Групповой чат (UUID): кадр уходит всем участникам, recipient_id пуст
+	GroupEpoch        uint64   `protobuf:"varint,9,opt,name=group_epoch,json=groupEpoch,proto3" json:"group_epoch,omitempty"`                        // Эпоха группы, под ключами которой зашифровано сообщение
+	RecipientDeviceId string   `protobuf:"bytes,10,opt,name=recipient_device_id,json=recipientDeviceId,proto3" json:"recipient_device_id,omitempty"` // Только это устройство получателя (ставит сервер для SENDER_KEY_DISTRIBUTION)
+	AttachmentIds     []string `protobuf:"bytes,11,rep,name=attachment_ids,json=attachmentIds,proto3" json:"attachment_ids,omitempty"`               // Вложения сообщения: сервер проверяет, что их загрузил отправитель
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
 }
 
 func (x *WebSocketMessage) Reset() {
@@ -164,10 +413,46 @@ func (x *WebSocketMessage) GetRecipientId() string {
 	return ""
 }
 
+func (x *WebSocketMessage) GetSenderDeviceId() string {
+	if x != nil {
+		return x.SenderDeviceId
+	}
+	return ""
+}
+
+func (x *WebSocketMessage) GetGroupId() string {
+	if x != nil {
+		return x.GroupId
+	}
+	return ""
+}
+
+func (x *WebSocketMessage) GetGroupEpoch() uint64 {
+	if x != nil {
+		return x.GroupEpoch
+	}
+	return 0
+}
+
+func (x *WebSocketMessage) GetRecipientDeviceId() string {
+	if x != nil {
+		return x.RecipientDeviceId
+	}
+	return ""
+}
+
+func (x *WebSocketMessage) GetAttachmentIds() []string {
+	if x != nil {
+		return x.AttachmentIds
+	}
+	return nil
+}
+
 type AckPayload struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	MessageId     string                 `protobuf:"bytes,1,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
-	SenderId      string                 `protobuf:"bytes,2,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`
+	SenderId      string                 `protobuf:"bytes,2,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"` // Кто подтвердил (пусто для SERVER)
+	Status        AckPayload_Status      `protobuf:"varint,3,opt,name=status,proto3,enum=securemesh.AckPayload_Status" json:"status,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -216,33 +501,892 @@ func (x *AckPayload) GetSenderId() string {
 	return ""
 }
 
-var File_chat_proto protoreflect.FileDescriptor
+func (x *AckPayload) GetStatus() AckPayload_Status {
+	if x != nil {
+		return x.Status
+	}
+	return AckPayload_DELIVERED
+}
 
-const file_chat_proto_rawDesc = "" +
-	"\n" +
-	"\n" +
-	"chat.proto\x12\n" +
-	"securemesh\"\xa2\x02\n" +
-	"\x10WebSocketMessage\x125\n" +
-	"\x04type\x18\x01 \x01(\x0e2!.securemesh.WebSocketMessage.TypeR\x04type\x12\x0e\n" +
-	"\x02id\x18\x02 \x01(\tR\x02id\x12\x18\n" +
-	"\apayload\x18\x03 \x01(\fR\apayload\x12\x1c\n" +
-	"\ttimestamp\x18\x04 \x01(\x03R\ttimestamp\x12\x1b\n" +
-	"\tsender_id\x18\x05 \x01(\tR\bsenderId\x12!\n" +
-	"\frecipient_id\x18\x06 \x01(\tR\vrecipientId\"O\n" +
-	"\x04Type\x12\v\n" +
-	"\aUNKNOWN\x10\x00\x12\b\n" +
-	"\x04AUTH\x10\x01\x12\x10\n" +
-	"\fTEXT_MESSAGE\x10\x02\x12\a\n" +
-	"\x03ACK\x10\x03\x12\n" +
-	"\n" +
-	"\x06TYPING\x10\x04\x12\t\n" +
-	"\x05ERROR\x10\x05\"H\n" +
-	"\n" +
-	"AckPayload\x12\x1d\n" +
-	"\n" +
-	"message_id\x18\x01 \x01(\tR\tmessageId\x12\x1b\n" +
-	"\tsender_id\x18\x02 \x01(\tR\bsenderIdB7Z5github.com/yerkebulanrai/securemesh/backend/pkg/protob\x06proto3"
+// Индикатор набора текста (payload кадра TYPING)
+type TypingPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	State         TypingPayload_State    `protobuf:"varint,1,opt,name=state,proto3,enum=securemesh.TypingPayload_State" json:"state,omitempty"`
+	ExpiresIn     int32                  `protobuf:"varint,2,opt,name=expires_in,json=expiresIn,proto3" json:"expires_in,omitempty"` // Через сколько секунд погасить индикатор без STOPPED (ставит сервер)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TypingPayload) Reset() {
+	*x = TypingPayload{}
+	mi := &file_chat_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TypingPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TypingPayload) ProtoMessage() {}
+
+func (x *TypingPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TypingPayload.ProtoReflect.Descriptor instead.
+func (*TypingPayload) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *TypingPayload) GetState() TypingPayload_State {
+	if x != nil {
+		return x.State
+	}
+	return TypingPayload_STARTED
+}
+
+func (x *TypingPayload) GetExpiresIn() int32 {
+	if x != nil {
+		return x.ExpiresIn
+	}
+	return 0
+}
+
+// Онлайн-статус юзера (payload кадра PRESENCE)
+type PresencePayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Online        bool                   `protobuf:"varint,2,opt,name=online,proto3" json:"online,omitempty"`
+	LastSeen      int64                  `protobuf:"varint,3,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"` // Unix timestamp, 0 — скрыт настройками приватности или неизвестен
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PresencePayload) Reset() {
+	*x = PresencePayload{}
+	mi := &file_chat_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PresencePayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PresencePayload) ProtoMessage() {}
+
+func (x *PresencePayload) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PresencePayload.ProtoReflect.Descriptor instead.
+func (*PresencePayload) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PresencePayload) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *PresencePayload) GetOnline() bool {
+	if x != nil {
+		return x.Online
+	}
+	return false
+}
+
+func (x *PresencePayload) GetLastSeen() int64 {
+	if x != nil {
+		return x.LastSeen
+	}
+	return 0
+}
+
+// Подписка на статусы контактов (payload кадра PRESENCE_SUBSCRIBE).
+// Действует ограниченное время, клиент повторяет её после переподключения.
+type PresenceSubscribe struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserIds       []string               `protobuf:"bytes,1,rep,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PresenceSubscribe) Reset() {
+	*x = PresenceSubscribe{}
+	mi := &file_chat_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PresenceSubscribe) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PresenceSubscribe) ProtoMessage() {}
+
+func (x *PresenceSubscribe) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PresenceSubscribe.ProtoReflect.Descriptor instead.
+func (*PresenceSubscribe) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PresenceSubscribe) GetUserIds() []string {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+// Ошибка обработки кадра (payload кадра ERROR, id — как у отклонённого кадра)
+type ErrorPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          ErrorPayload_Code      `protobuf:"varint,1,opt,name=code,proto3,enum=securemesh.ErrorPayload_Code" json:"code,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`                          // Описание для логов, не для показа юзеру
+	MessageId     string                 `protobuf:"bytes,3,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`     // Какой кадр отклонён (пусто, если id не разобрать)
+	Retryable     bool                   `protobuf:"varint,4,opt,name=retryable,proto3" json:"retryable,omitempty"`                     // Имеет ли смысл повторить тот же кадр
+	GroupEpoch    uint64                 `protobuf:"varint,5,opt,name=group_epoch,json=groupEpoch,proto3" json:"group_epoch,omitempty"` // Для STALE_GROUP_EPOCH: текущая эпоха группы
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ErrorPayload) Reset() {
+	*x = ErrorPayload{}
+	mi := &file_chat_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ErrorPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ErrorPayload) ProtoMessage() {}
+
+func (x *ErrorPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ErrorPayload.ProtoReflect.Descriptor instead.
+func (*ErrorPayload) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ErrorPayload) GetCode() ErrorPayload_Code {
+	if x != nil {
+		return x.Code
+	}
+	return ErrorPayload_INTERNAL
+}
+
+func (x *ErrorPayload) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ErrorPayload) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *ErrorPayload) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+func (x *ErrorPayload) GetGroupEpoch() uint64 {
+	if x != nil {
+		return x.GroupEpoch
+	}
+	return 0
+}
+
+// Запрос страницы истории: от новых к старым, курсор из предыдущего ответа
+type HistoryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PeerId        string                 `protobuf:"bytes,1,opt,name=peer_id,json=peerId,proto3" json:"peer_id,omitempty"` // Только переписка с этим юзером (пусто — вся)
+	Cursor        string                 `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`               // Пусто — с самых новых
+	Limit         int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	GroupId       string                 `protobuf:"bytes,4,opt,name=group_id,json=groupId,proto3" json:"group_id,omitempty"` // Только переписка в этой группе (вместо peer_id)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryRequest) Reset() {
+	*x = HistoryRequest{}
+	mi := &file_chat_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryRequest) ProtoMessage() {}
+
+func (x *HistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryRequest.ProtoReflect.Descriptor instead.
+func (*HistoryRequest) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *HistoryRequest) GetPeerId() string {
+	if x != nil {
+		return x.PeerId
+	}
+	return ""
+}
+
+func (x *HistoryRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *HistoryRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *HistoryRequest) GetGroupId() string {
+	if x != nil {
+		return x.GroupId
+	}
+	return ""
+}
+
+type HistoryResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*WebSocketMessage    `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"` // Пусто — дальше сообщений нет
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HistoryResponse) Reset() {
+	*x = HistoryResponse{}
+	mi := &file_chat_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HistoryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HistoryResponse) ProtoMessage() {}
+
+func (x *HistoryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HistoryResponse.ProtoReflect.Descriptor instead.
+func (*HistoryResponse) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *HistoryResponse) GetMessages() []*WebSocketMessage {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+func (x *HistoryResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+// Смена ключей устройства (payload кадра KEY_CHANGED).
+// Клиент проверяет proof старым ключом подписи и показывает предупреждение о смене кода безопасности.
+type KeyChangedPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	DeviceId      string                 `protobuf:"bytes,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	IdentityKey   []byte                 `protobuf:"bytes,3,opt,name=identity_key,json=identityKey,proto3" json:"identity_key,omitempty"` // Новый Curve25519
+	SigningKey    []byte                 `protobuf:"bytes,4,opt,name=signing_key,json=signingKey,proto3" json:"signing_key,omitempty"`    // Новый Ed25519
+	Proof         []byte                 `protobuf:"bytes,5,opt,name=proof,proto3" json:"proof,omitempty"`                                // Подпись старым ключом (пусто, если ключи сменены через перерегистрацию)
+	ChangedAt     int64                  `protobuf:"varint,6,opt,name=changed_at,json=changedAt,proto3" json:"changed_at,omitempty"`      // Unix timestamp
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyChangedPayload) Reset() {
+	*x = KeyChangedPayload{}
+	mi := &file_chat_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyChangedPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyChangedPayload) ProtoMessage() {}
+
+func (x *KeyChangedPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyChangedPayload.ProtoReflect.Descriptor instead.
+func (*KeyChangedPayload) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *KeyChangedPayload) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *KeyChangedPayload) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *KeyChangedPayload) GetIdentityKey() []byte {
+	if x != nil {
+		return x.IdentityKey
+	}
+	return nil
+}
+
+func (x *KeyChangedPayload) GetSigningKey() []byte {
+	if x != nil {
+		return x.SigningKey
+	}
+	return nil
+}
+
+func (x *KeyChangedPayload) GetProof() []byte {
+	if x != nil {
+		return x.Proof
+	}
+	return nil
+}
+
+func (x *KeyChangedPayload) GetChangedAt() int64 {
+	if x != nil {
+		return x.ChangedAt
+	}
+	return 0
+}
+
+// Системное событие группы (payload кадра GROUP_EVENT, group_id — в самом кадре).
+// Сохраняется как сообщение группы: участники, бывшие офлайн, получат его из очереди.
+type GroupEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Kind          GroupEvent_Kind        `protobuf:"varint,1,opt,name=kind,proto3,enum=securemesh.GroupEvent_Kind" json:"kind,omitempty"`
+	ActorId       string                 `protobuf:"bytes,2,opt,name=actor_id,json=actorId,proto3" json:"actor_id,omitempty"` // Кто совершил действие
+	UserIds       []string               `protobuf:"bytes,3,rep,name=user_ids,json=userIds,proto3" json:"user_ids,omitempty"` // Кого касается событие
+	Role          string                 `protobuf:"bytes,4,opt,name=role,proto3" json:"role,omitempty"`                      // Новая роль для ROLE_CHANGED (owner, admin, member)
+	Metadata      []byte                 `protobuf:"bytes,5,opt,name=metadata,proto3" json:"metadata,omitempty"`              // Для CREATED и UPDATED: зашифрованные клиентами название и аватар
+	Epoch         uint64                 `protobuf:"varint,6,opt,name=epoch,proto3" json:"epoch,omitempty"`                   // Новая эпоха для CREATED и смен состава (сигнал сменить ключ отправителя), иначе 0
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GroupEvent) Reset() {
+	*x = GroupEvent{}
+	mi := &file_chat_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GroupEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GroupEvent) ProtoMessage() {}
+
+func (x *GroupEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GroupEvent.ProtoReflect.Descriptor instead.
+func (*GroupEvent) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GroupEvent) GetKind() GroupEvent_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return GroupEvent_CREATED
+}
+
+func (x *GroupEvent) GetActorId() string {
+	if x != nil {
+		return x.ActorId
+	}
+	return ""
+}
+
+func (x *GroupEvent) GetUserIds() []string {
+	if x != nil {
+		return x.UserIds
+	}
+	return nil
+}
+
+func (x *GroupEvent) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *GroupEvent) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *GroupEvent) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+// Ссылка на вложение. Кладётся клиентом внутрь зашифрованного payload кадра ATTACHMENT:
+// сервер видит только id, ключ и хэш знают лишь собеседники.
+type AttachmentPointer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`         // id из POST /attachments, по нему — ссылка на скачивание
+	Key           []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`       // Ключ, которым клиент зашифровал файл
+	Digest        []byte                 `protobuf:"bytes,3,opt,name=digest,proto3" json:"digest,omitempty"` // SHA-256 зашифрованного файла: проверяется после скачивания
+	Size          uint64                 `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`    // Размер зашифрованного файла
+	ContentType   string                 `protobuf:"bytes,5,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	FileName      string                 `protobuf:"bytes,6,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	Width         uint32                 `protobuf:"varint,7,opt,name=width,proto3" json:"width,omitempty"` // Для изображений и видео
+	Height        uint32                 `protobuf:"varint,8,opt,name=height,proto3" json:"height,omitempty"`
+	Thumbnail     []byte                 `protobuf:"bytes,9,opt,name=thumbnail,proto3" json:"thumbnail,omitempty"` // Маленькое превью (внутри шифротекста, отдельно не загружается)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AttachmentPointer) Reset() {
+	*x = AttachmentPointer{}
+	mi := &file_chat_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AttachmentPointer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AttachmentPointer) ProtoMessage() {}
+
+func (x *AttachmentPointer) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AttachmentPointer.ProtoReflect.Descriptor instead.
+func (*AttachmentPointer) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *AttachmentPointer) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AttachmentPointer) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *AttachmentPointer) GetDigest() []byte {
+	if x != nil {
+		return x.Digest
+	}
+	return nil
+}
+
+func (x *AttachmentPointer) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *AttachmentPointer) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *AttachmentPointer) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *AttachmentPointer) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *AttachmentPointer) GetHeight() uint32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *AttachmentPointer) GetThumbnail() []byte {
+	if x != nil {
+		return x.Thumbnail
+	}
+	return nil
+}
+
+// Ключ отправителя для одного устройства участника: шифруется клиентом попарной сессией с устройством
+type SenderKeyMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RecipientId   string                 `protobuf:"bytes,1,opt,name=recipient_id,json=recipientId,proto3" json:"recipient_id,omitempty"`
+	DeviceId      string                 `protobuf:"bytes,2,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Ciphertext    []byte                 `protobuf:"bytes,3,opt,name=ciphertext,proto3" json:"ciphertext,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SenderKeyMessage) Reset() {
+	*x = SenderKeyMessage{}
+	mi := &file_chat_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SenderKeyMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SenderKeyMessage) ProtoMessage() {}
+
+func (x *SenderKeyMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SenderKeyMessage.ProtoReflect.Descriptor instead.
+func (*SenderKeyMessage) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SenderKeyMessage) GetRecipientId() string {
+	if x != nil {
+		return x.RecipientId
+	}
+	return ""
+}
+
+func (x *SenderKeyMessage) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+func (x *SenderKeyMessage) GetCiphertext() []byte {
+	if x != nil {
+		return x.Ciphertext
+	}
+	return nil
+}
+
+// Рассылка ключа отправителя (payload кадра SENDER_KEY_DISTRIBUTION от клиента, group_id и group_epoch — в кадре).
+// Сервер раскладывает её по устройствам: каждое получает только свой шифротекст.
+type SenderKeyBundle struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*SenderKeyMessage    `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SenderKeyBundle) Reset() {
+	*x = SenderKeyBundle{}
+	mi := &file_chat_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SenderKeyBundle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SenderKeyBundle) ProtoMessage() {}
+
+func (x *SenderKeyBundle) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SenderKeyBundle.ProtoReflect.Descriptor instead.
+func (*SenderKeyBundle) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SenderKeyBundle) GetMessages() []*SenderKeyMessage {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+var File_chat_proto protoreflect.FileDescriptor
+
+const file_chat_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"chat.proto\x12\n" +
+	"securemesh\"\x80\x05\n" +
+	"\x10WebSocketMessage\x125\n" +
+	"\x04type\x18\x01 \x01(\x0e2!.securemesh.WebSocketMessage.TypeR\x04type\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\x12\x18\n" +
+	"\apayload\x18\x03 \x01(\fR\apayload\x12\x1c\n" +
+	"\ttimestamp\x18\x04 \x01(\x03R\ttimestamp\x12\x1b\n" +
+	"\tsender_id\x18\x05 \x01(\tR\bsenderId\x12!\n" +
+	"\frecipient_id\x18\x06 \x01(\tR\vrecipientId\x12(\n" +
+	"\x10sender_device_id\x18\a \x01(\tR\x0esenderDeviceId\x12\x19\n" +
+	"\bgroup_id\x18\b \x01(\tR\agroupId\x12\x1f\n" +
+	"\vgroup_epoch\x18\t \x01(\x04R\n" +
+	"groupEpoch\x12.\n" +
+	"\x13recipient_device_id\x18\n" +
+	" \x01(\tR\x11recipientDeviceId\x12%\n" +
+	"\x0eattachment_ids\x18\v \x03(\tR\rattachmentIds\"\xef\x01\n" +
+	"\x04Type\x12\v\n" +
+	"\aUNKNOWN\x10\x00\x12\b\n" +
+	"\x04AUTH\x10\x01\x12\x10\n" +
+	"\fTEXT_MESSAGE\x10\x02\x12\a\n" +
+	"\x03ACK\x10\x03\x12\n" +
+	"\n" +
+	"\x06TYPING\x10\x04\x12\t\n" +
+	"\x05ERROR\x10\x05\x12\x13\n" +
+	"\x0fHISTORY_REQUEST\x10\x06\x12\x14\n" +
+	"\x10HISTORY_RESPONSE\x10\a\x12\f\n" +
+	"\bPRESENCE\x10\b\x12\x16\n" +
+	"\x12PRESENCE_SUBSCRIBE\x10\t\x12\x0f\n" +
+	"\vKEY_CHANGED\x10\n" +
+	"\x12\x0f\n" +
+	"\vGROUP_EVENT\x10\v\x12\x1b\n" +
+	"\x17SENDER_KEY_DISTRIBUTION\x10\f\x12\x0e\n" +
+	"\n" +
+	"ATTACHMENT\x10\r\"\xae\x01\n" +
+	"\n" +
+	"AckPayload\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x01 \x01(\tR\tmessageId\x12\x1b\n" +
+	"\tsender_id\x18\x02 \x01(\tR\bsenderId\x125\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x1d.securemesh.AckPayload.StatusR\x06status\"-\n" +
+	"\x06Status\x12\r\n" +
+	"\tDELIVERED\x10\x00\x12\b\n" +
+	"\x04READ\x10\x01\x12\n" +
+	"\n" +
+	"\x06SERVER\x10\x02\"\x88\x01\n" +
+	"\rTypingPayload\x125\n" +
+	"\x05state\x18\x01 \x01(\x0e2\x1f.securemesh.TypingPayload.StateR\x05state\x12\x1d\n" +
+	"\n" +
+	"expires_in\x18\x02 \x01(\x05R\texpiresIn\"!\n" +
+	"\x05State\x12\v\n" +
+	"\aSTARTED\x10\x00\x12\v\n" +
+	"\aSTOPPED\x10\x01\"_\n" +
+	"\x0fPresencePayload\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06online\x18\x02 \x01(\bR\x06online\x12\x1b\n" +
+	"\tlast_seen\x18\x03 \x01(\x03R\blastSeen\".\n" +
+	"\x11PresenceSubscribe\x12\x19\n" +
+	"\buser_ids\x18\x01 \x03(\tR\auserIds\"\xfc\x02\n" +
+	"\fErrorPayload\x121\n" +
+	"\x04code\x18\x01 \x01(\x0e2\x1d.securemesh.ErrorPayload.CodeR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x03 \x01(\tR\tmessageId\x12\x1c\n" +
+	"\tretryable\x18\x04 \x01(\bR\tretryable\x12\x1f\n" +
+	"\vgroup_epoch\x18\x05 \x01(\x04R\n" +
+	"groupEpoch\"\xc0\x01\n" +
+	"\x04Code\x12\f\n" +
+	"\bINTERNAL\x10\x00\x12\x13\n" +
+	"\x0fMALFORMED_FRAME\x10\x01\x12\x10\n" +
+	"\fUNAUTHORIZED\x10\x02\x12\x17\n" +
+	"\x13RECIPIENT_NOT_FOUND\x10\x03\x12\x10\n" +
+	"\fRATE_LIMITED\x10\x04\x12\x16\n" +
+	"\x12PERSISTENCE_FAILED\x10\x05\x12\x13\n" +
+	"\x0fINVALID_MESSAGE\x10\x06\x12\x14\n" +
+	"\x10NOT_GROUP_MEMBER\x10\a\x12\x15\n" +
+	"\x11STALE_GROUP_EPOCH\x10\b\"r\n" +
+	"\x0eHistoryRequest\x12\x17\n" +
+	"\apeer_id\x18\x01 \x01(\tR\x06peerId\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\tR\x06cursor\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x12\x19\n" +
+	"\bgroup_id\x18\x04 \x01(\tR\agroupId\"l\n" +
+	"\x0fHistoryResponse\x128\n" +
+	"\bmessages\x18\x01 \x03(\v2\x1c.securemesh.WebSocketMessageR\bmessages\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"\xc2\x01\n" +
+	"\x11KeyChangedPayload\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\tR\bdeviceId\x12!\n" +
+	"\fidentity_key\x18\x03 \x01(\fR\videntityKey\x12\x1f\n" +
+	"\vsigning_key\x18\x04 \x01(\fR\n" +
+	"signingKey\x12\x14\n" +
+	"\x05proof\x18\x05 \x01(\fR\x05proof\x12\x1d\n" +
+	"\n" +
+	"changed_at\x18\x06 \x01(\x03R\tchangedAt\"\xa5\x02\n" +
+	"\n" +
+	"GroupEvent\x12/\n" +
+	"\x04kind\x18\x01 \x01(\x0e2\x1b.securemesh.GroupEvent.KindR\x04kind\x12\x19\n" +
+	"\bactor_id\x18\x02 \x01(\tR\aactorId\x12\x19\n" +
+	"\buser_ids\x18\x03 \x03(\tR\auserIds\x12\x12\n" +
+	"\x04role\x18\x04 \x01(\tR\x04role\x12\x1a\n" +
+	"\bmetadata\x18\x05 \x01(\fR\bmetadata\x12\x14\n" +
+	"\x05epoch\x18\x06 \x01(\x04R\x05epoch\"j\n" +
+	"\x04Kind\x12\v\n" +
+	"\aCREATED\x10\x00\x12\x11\n" +
+	"\rMEMBERS_ADDED\x10\x01\x12\x0f\n" +
+	"\vMEMBER_LEFT\x10\x02\x12\x12\n" +
+	"\x0eMEMBER_REMOVED\x10\x03\x12\x10\n" +
+	"\fROLE_CHANGED\x10\x04\x12\v\n" +
+	"\aUPDATED\x10\x05\"\xed\x01\n" +
+	"\x11AttachmentPointer\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12\x16\n" +
+	"\x06digest\x18\x03 \x01(\fR\x06digest\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x04R\x04size\x12!\n" +
+	"\fcontent_type\x18\x05 \x01(\tR\vcontentType\x12\x1b\n" +
+	"\tfile_name\x18\x06 \x01(\tR\bfileName\x12\x14\n" +
+	"\x05width\x18\a \x01(\rR\x05width\x12\x16\n" +
+	"\x06height\x18\b \x01(\rR\x06height\x12\x1c\n" +
+	"\tthumbnail\x18\t \x01(\fR\tthumbnail\"r\n" +
+	"\x10SenderKeyMessage\x12!\n" +
+	"\frecipient_id\x18\x01 \x01(\tR\vrecipientId\x12\x1b\n" +
+	"\tdevice_id\x18\x02 \x01(\tR\bdeviceId\x12\x1e\n" +
+	"\n" +
+	"ciphertext\x18\x03 \x01(\fR\n" +
+	"ciphertext\"K\n" +
+	"\x0fSenderKeyBundle\x128\n" +
+	"\bmessages\x18\x01 \x03(\v2\x1c.securemesh.SenderKeyMessageR\bmessagesB7Z5github.com/yerkebulanrai/securemesh/backend/pkg/protob\x06proto3"
 
 var (
 	file_chat_proto_rawDescOnce sync.Once
@@ -256,20 +1400,41 @@ func file_chat_proto_rawDescGZIP() []byte {
 	return file_chat_proto_rawDescData
 }
 
-var file_chat_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_chat_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_chat_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_chat_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_chat_proto_goTypes = []any{
 	(WebSocketMessage_Type)(0), // 0: securemesh.WebSocketMessage.Type
-	(*WebSocketMessage)(nil),   // 1: securemesh.WebSocketMessage
-	(*AckPayload)(nil),         // 2: securemesh.AckPayload
+	(AckPayload_Status)(0),     // 1: securemesh.AckPayload.Status
+	(TypingPayload_State)(0),   // 2: securemesh.TypingPayload.State
+	(ErrorPayload_Code)(0),     // 3: securemesh.ErrorPayload.Code
+	(GroupEvent_Kind)(0),       // 4: securemesh.GroupEvent.Kind
+	(*WebSocketMessage)(nil),   // 5: securemesh.WebSocketMessage
+	(*AckPayload)(nil),         // 6: securemesh.AckPayload
+	(*TypingPayload)(nil),      // 7: securemesh.TypingPayload
+	(*PresencePayload)(nil),    // 8: securemesh.PresencePayload
+	(*PresenceSubscribe)(nil),  // 9: securemesh.PresenceSubscribe
+	(*ErrorPayload)(nil),       // 10: securemesh.ErrorPayload
+	(*HistoryRequest)(nil),     // 11: securemesh.HistoryRequest
+	(*HistoryResponse)(nil),    // 12: securemesh.HistoryResponse
+	(*KeyChangedPayload)(nil),  // 13: securemesh.KeyChangedPayload
+	(*GroupEvent)(nil),         // 14: securemesh.GroupEvent
+	(*AttachmentPointer)(nil),  // 15: securemesh.AttachmentPointer
+	(*SenderKeyMessage)(nil),   // 16: securemesh.SenderKeyMessage
+	(*SenderKeyBundle)(nil),    // 17: securemesh.SenderKeyBundle
 }
 var file_chat_proto_depIdxs = []int32{
-	0, // 0: securemesh.WebSocketMessage.type:type_name -> securemesh.WebSocketMessage.Type
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	0,  // 0: securemesh.WebSocketMessage.type:type_name -> securemesh.WebSocketMessage.Type
+	1,  // 1: securemesh.AckPayload.status:type_name -> securemesh.AckPayload.Status
+	2,  // 2: securemesh.TypingPayload.state:type_name -> securemesh.TypingPayload.State
+	3,  // 3: securemesh.ErrorPayload.code:type_name -> securemesh.ErrorPayload.Code
+	5,  // 4: securemesh.HistoryResponse.messages:type_name -> securemesh.WebSocketMessage
+	4,  // 5: securemesh.GroupEvent.kind:type_name -> securemesh.GroupEvent.Kind
+	16, // 6: securemesh.SenderKeyBundle.messages:type_name -> securemesh.SenderKeyMessage
+	7,  // [7:7] is the sub-list for method output_type
+	7,  // [7:7] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_chat_proto_init() }
@@ -282,8 +1447,8 @@ func file_chat_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_chat_proto_rawDesc), len(file_chat_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   2,
+			NumEnums:      5,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,71 @@
+// Package ratelimit — ограничение частоты запросов, общее для всех узлов API.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+const keyPrefix = "securemesh:ratelimit:"
+
+// allowTimeout — сколько ждём Redis, прежде чем отказать в запросе
+const allowTimeout = time.Second
+
+// tokenBucket — token bucket в хэше {tokens, ts}. Время берётся у Redis,
+// чтобы расхождение часов узлов не влияло на лимит. Возвращает 1, если запрос разрешён.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return allowed
+`)
+
+// RedisStore — лимит "limit запросов в секунду, подряд не больше burst" на ключ, общий для всех узлов.
+// Реализует middleware.RateLimiterStore из echo.
+type RedisStore struct {
+	client *redis.Client
+	name   string
+	limit  rate.Limit
+	burst  int
+}
+
+// NewRedisStore создаёт лимит. name отделяет ключи разных лимитов друг от друга.
+func NewRedisStore(client *redis.Client, name string, limit rate.Limit, burst int) *RedisStore {
+	return &RedisStore{client: client, name: name, limit: limit, burst: burst}
+}
+
+// Allow расходует одну попытку identifier. Если Redis недоступен — отказ с ошибкой.
+func (s *RedisStore) Allow(identifier string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), allowTimeout)
+	defer cancel()
+
+	key := keyPrefix + s.name + ":" + identifier
+	allowed, err := tokenBucket.Run(ctx, s.client, []string{key}, float64(s.limit), s.burst).Int()
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки лимита %s: %w", s.name, err)
+	}
+	return allowed == 1, nil
+}
@@ -0,0 +1,31 @@
+package transparency
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var ErrNoLogKey = errors.New("KT_SIGNING_KEY не задан (ключ можно не задавать только при APP_ENV=dev)")
+
+// LoadSigningKey читает ключ подписи корней журнала из KT_SIGNING_KEY (Base64 seed Ed25519, 32 байта).
+// Ключ нельзя менять: аудиторы проверяют им все корни. Без него стартуем только при APP_ENV=dev.
+func LoadSigningKey() (ed25519.PrivateKey, error) {
+	encoded := os.Getenv("KT_SIGNING_KEY")
+	if encoded == "" {
+		if os.Getenv("APP_ENV") != "dev" {
+			return nil, ErrNoLogKey
+		}
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("KT_SIGNING_KEY: ожидается Base64 seed Ed25519 (%d байта)", ed25519.SeedSize)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
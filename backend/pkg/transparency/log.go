@@ -0,0 +1,71 @@
+package transparency
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Entry — запись журнала: какие ключи опубликованы для устройства юзера.
+// Epoch растёт на единицу с каждой записью юзера, так что пропуск или откат версии заметен.
+type Entry struct {
+	UserID      string
+	DeviceID    string
+	Epoch       uint64
+	IdentityKey []byte // Curve25519
+	SigningKey  []byte // Ed25519
+}
+
+// entryVersion — версия формата записи, первый байт данных листа
+const entryVersion = 1
+
+// MarshalBinary — каноническое представление записи (данные листа):
+// версия (1 байт), затем поля user_id, device_id, identity_key, signing_key
+// с длиной (2 байта, big-endian) перед каждым и epoch (8 байт, big-endian) в конце
+func (e Entry) MarshalBinary() ([]byte, error) {
+	fields := [][]byte{[]byte(e.UserID), []byte(e.DeviceID), e.IdentityKey, e.SigningKey}
+
+	buf := []byte{entryVersion}
+	for _, f := range fields {
+		if len(f) > 0xFFFF {
+			return nil, errors.New("поле записи журнала слишком длинное")
+		}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(f)))
+		buf = append(buf, f...)
+	}
+	return binary.BigEndian.AppendUint64(buf, e.Epoch), nil
+}
+
+// TreeHead — подписанный корень дерева (STH).
+// Два корня одного размера с разными хэшами, подписанные сервером, — доказательство подмены.
+type TreeHead struct {
+	TreeSize  uint64
+	RootHash  []byte
+	Timestamp time.Time
+	Signature []byte
+}
+
+// treeHeadContext отделяет подписи STH от любых других подписей тем же ключом
+const treeHeadContext = "securemesh:kt:sth:v1"
+
+// signedData — то, что подписывается: контекст, размер, время (мс) и корень
+func (h TreeHead) signedData() []byte {
+	buf := []byte(treeHeadContext)
+	buf = binary.BigEndian.AppendUint64(buf, h.TreeSize)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(h.Timestamp.UnixMilli()))
+	return append(buf, h.RootHash...)
+}
+
+// Sign подписывает корень ключом журнала
+func (h *TreeHead) Sign(key ed25519.PrivateKey) {
+	h.Signature = ed25519.Sign(key, h.signedData())
+}
+
+// Verify проверяет подпись корня публичным ключом журнала
+func (h TreeHead) Verify(key ed25519.PublicKey) error {
+	if !ed25519.Verify(key, h.signedData(), h.Signature) {
+		return ErrInvalidProof
+	}
+	return nil
+}
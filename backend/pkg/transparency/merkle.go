@@ -0,0 +1,270 @@
+// Package transparency — журнал прозрачности ключей: дерево Меркла только на добавление (RFC 6962).
+// Сервер не может незаметно подменить ключ юзера: любой выданный ключ должен быть в журнале,
+// а журнал нельзя переписать, не нарушив доказательств согласованности между подписанными корнями.
+package transparency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+	"sync"
+)
+
+// Префиксы хэшей из RFC 6962: лист и внутренний узел не спутать
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// memoMinSize — полные поддеревья от этого размера кэшируются: в журнале только на добавление
+// они никогда не меняются, поэтому корень и доказательства считаются за O(log n)
+const memoMinSize = 16
+
+var (
+	ErrIndexOutOfRange = errors.New("индекс за пределами дерева")
+	ErrInvalidProof    = errors.New("доказательство не сходится")
+)
+
+// LeafHash — хэш листа: SHA-256(0x00 || data)
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// nodeHash — хэш внутреннего узла: SHA-256(0x01 || left || right)
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split — наибольшая степень двойки, меньшая n (n > 1)
+func split(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// Tree — дерево Меркла над хэшами листьев. Безопасно для параллельного использования.
+type Tree struct {
+	mu     sync.RWMutex
+	leaves [][]byte
+	memo   map[[2]uint64][]byte // (начало, размер) полного поддерева -> хэш
+}
+
+func NewTree() *Tree {
+	return &Tree{memo: make(map[[2]uint64][]byte)}
+}
+
+// Append добавляет хэши листьев в конец дерева
+func (t *Tree) Append(leafHashes ...[]byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.leaves = append(t.leaves, leafHashes...)
+}
+
+// Size — число листьев
+func (t *Tree) Size() uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return uint64(len(t.leaves))
+}
+
+// Root — корень дерева из первых size листьев (MTH из RFC 6962)
+func (t *Tree) Root(size uint64) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if size > uint64(len(t.leaves)) {
+		return nil, ErrIndexOutOfRange
+	}
+	return t.subtree(0, size), nil
+}
+
+// InclusionProof — путь аудита для листа index в дереве из size листьев (PATH из RFC 6962)
+func (t *Tree) InclusionProof(index, size uint64) ([][]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if size > uint64(len(t.leaves)) || index >= size {
+		return nil, ErrIndexOutOfRange
+	}
+	return t.path(index, 0, size), nil
+}
+
+// ConsistencyProof доказывает, что дерево из first листьев — префикс дерева из second (PROOF из RFC 6962)
+func (t *Tree) ConsistencyProof(first, second uint64) ([][]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if second > uint64(len(t.leaves)) || first > second {
+		return nil, ErrIndexOutOfRange
+	}
+	if first == 0 || first == second {
+		return [][]byte{}, nil
+	}
+	return t.subproof(first, 0, second, true), nil
+}
+
+// subtree — MTH(D[lo:hi])
+func (t *Tree) subtree(lo, hi uint64) []byte {
+	n := hi - lo
+	switch n {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return t.leaves[lo]
+	}
+
+	full := n&(n-1) == 0 && n >= memoMinSize
+	if full {
+		if hash, ok := t.memo[[2]uint64{lo, n}]; ok {
+			return hash
+		}
+	}
+
+	k := split(n)
+	hash := nodeHash(t.subtree(lo, lo+k), t.subtree(lo+k, hi))
+	if full {
+		t.memo[[2]uint64{lo, n}] = hash
+	}
+	return hash
+}
+
+// path — PATH(m, D[lo:hi]), m отсчитывается от lo
+func (t *Tree) path(m, lo, hi uint64) [][]byte {
+	n := hi - lo
+	if n <= 1 {
+		return [][]byte{}
+	}
+
+	k := split(n)
+	if m < k {
+		return append(t.path(m, lo, lo+k), t.subtree(lo+k, hi))
+	}
+	return append(t.path(m-k, lo+k, hi), t.subtree(lo, lo+k))
+}
+
+// subproof — SUBPROOF(m, D[lo:hi], b)
+func (t *Tree) subproof(m, lo, hi uint64, b bool) [][]byte {
+	n := hi - lo
+	if m == n {
+		if b {
+			return [][]byte{}
+		}
+		return [][]byte{t.subtree(lo, hi)}
+	}
+
+	k := split(n)
+	if m <= k {
+		return append(t.subproof(m, lo, lo+k, b), t.subtree(lo+k, hi))
+	}
+	return append(t.subproof(m-k, lo+k, hi, false), t.subtree(lo, lo+k))
+}
+
+// VerifyInclusion проверяет путь аудита листа (RFC 9162, 2.1.3.2)
+func VerifyInclusion(index, size uint64, leafHash []byte, proof [][]byte, root []byte) error {
+	if index >= size {
+		return ErrIndexOutOfRange
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyConsistency проверяет, что дерево с корнем secondRoot продолжает дерево с корнем firstRoot
+// (RFC 9162, 2.1.4.2)
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot []byte, proof [][]byte) error {
+	switch {
+	case first > second:
+		return ErrIndexOutOfRange
+	case first == second:
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrInvalidProof
+		}
+		return nil
+	case first == 0:
+		// Пустое дерево — префикс любого
+		if len(proof) != 0 {
+			return ErrInvalidProof
+		}
+		return nil
+	case len(proof) == 0:
+		return ErrInvalidProof
+	}
+
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// Truncate откатывает дерево до size листьев (если добавленные листья не удалось сохранить)
+func (t *Tree) Truncate(size uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if size >= uint64(len(t.leaves)) {
+		return
+	}
+	t.leaves = t.leaves[:size]
+	for key := range t.memo {
+		if key[0]+key[1] > size {
+			delete(t.memo, key)
+		}
+	}
+}
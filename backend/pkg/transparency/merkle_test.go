@@ -0,0 +1,298 @@
+package transparency
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// Тестовые векторы дерева Меркла из RFC 6962 (те же, что в certificate-transparency):
+// листья, корни деревьев из 1..8 листьев и доказательства для них
+var rfc6962Leaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+var rfc6962Roots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("hex %q: %v", s, err)
+	}
+	return b
+}
+
+func mustHexes(t *testing.T, ss []string) [][]byte {
+	t.Helper()
+	out := make([][]byte, 0, len(ss))
+	for _, s := range ss {
+		out = append(out, mustHex(t, s))
+	}
+	return out
+}
+
+// rfc6962Tree — дерево из восьми листьев тестовых векторов
+func rfc6962Tree(t *testing.T) *Tree {
+	t.Helper()
+	tree := NewTree()
+	for _, leaf := range rfc6962Leaves {
+		tree.Append(LeafHash(mustHex(t, leaf)))
+	}
+	return tree
+}
+
+func TestRoot(t *testing.T) {
+	tree := rfc6962Tree(t)
+
+	empty, err := tree.Root(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(empty), "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"; got != want {
+		t.Errorf("Root(0) = %s, want %s", got, want)
+	}
+
+	for i, want := range rfc6962Roots {
+		size := uint64(i + 1)
+		root, err := tree.Root(size)
+		if err != nil {
+			t.Fatalf("Root(%d): %v", size, err)
+		}
+		if got := hex.EncodeToString(root); got != want {
+			t.Errorf("Root(%d) = %s, want %s", size, got, want)
+		}
+	}
+
+	if _, err := tree.Root(9); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("Root(9) error = %v, want ErrIndexOutOfRange", err)
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	tests := []struct {
+		index, size uint64
+		proof       []string
+	}{
+		{0, 1, nil},
+		{0, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{5, 8, []string{
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 3, []string{
+			"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		}},
+		{1, 5, []string{
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+
+	tree := rfc6962Tree(t)
+	for _, tt := range tests {
+		want := mustHexes(t, tt.proof)
+		proof, err := tree.InclusionProof(tt.index, tt.size)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d, %d): %v", tt.index, tt.size, err)
+		}
+		if !equalProofs(proof, want) {
+			t.Errorf("InclusionProof(%d, %d) = %x, want %x", tt.index, tt.size, proof, want)
+		}
+
+		leaf := LeafHash(mustHex(t, rfc6962Leaves[tt.index]))
+		root := mustHex(t, rfc6962Roots[tt.size-1])
+		if err := VerifyInclusion(tt.index, tt.size, leaf, want, root); err != nil {
+			t.Errorf("VerifyInclusion(%d, %d): %v", tt.index, tt.size, err)
+		}
+		// Чужой лист по тому же пути не проходит
+		other := LeafHash([]byte("not a leaf"))
+		if err := VerifyInclusion(tt.index, tt.size, other, want, root); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("VerifyInclusion(%d, %d) with a foreign leaf = %v, want ErrInvalidProof", tt.index, tt.size, err)
+		}
+	}
+}
+
+func TestInclusionProofAllLeaves(t *testing.T) {
+	tree := rfc6962Tree(t)
+	for size := uint64(1); size <= uint64(len(rfc6962Leaves)); size++ {
+		root := mustHex(t, rfc6962Roots[size-1])
+		for index := uint64(0); index < size; index++ {
+			proof, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d): %v", index, size, err)
+			}
+			leaf := LeafHash(mustHex(t, rfc6962Leaves[index]))
+			if err := VerifyInclusion(index, size, leaf, proof, root); err != nil {
+				t.Errorf("VerifyInclusion(%d, %d): %v", index, size, err)
+			}
+			if len(proof) > 0 {
+				truncated := proof[:len(proof)-1]
+				if err := VerifyInclusion(index, size, leaf, truncated, root); !errors.Is(err, ErrInvalidProof) {
+					t.Errorf("VerifyInclusion(%d, %d) with a truncated proof = %v, want ErrInvalidProof", index, size, err)
+				}
+			}
+		}
+	}
+
+	if _, err := tree.InclusionProof(8, 8); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("InclusionProof(8, 8) error = %v, want ErrIndexOutOfRange", err)
+	}
+	if err := VerifyInclusion(8, 8, nil, nil, nil); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("VerifyInclusion(8, 8) error = %v, want ErrIndexOutOfRange", err)
+	}
+}
+
+func TestConsistencyProof(t *testing.T) {
+	tests := []struct {
+		first, second uint64
+		proof         []string
+	}{
+		{1, 1, nil},
+		{1, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{6, 8, []string{
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{2, 5, []string{
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+	}
+
+	tree := rfc6962Tree(t)
+	for _, tt := range tests {
+		want := mustHexes(t, tt.proof)
+		proof, err := tree.ConsistencyProof(tt.first, tt.second)
+		if err != nil {
+			t.Fatalf("ConsistencyProof(%d, %d): %v", tt.first, tt.second, err)
+		}
+		if !equalProofs(proof, want) {
+			t.Errorf("ConsistencyProof(%d, %d) = %x, want %x", tt.first, tt.second, proof, want)
+		}
+
+		firstRoot := mustHex(t, rfc6962Roots[tt.first-1])
+		secondRoot := mustHex(t, rfc6962Roots[tt.second-1])
+		if err := VerifyConsistency(tt.first, tt.second, firstRoot, secondRoot, want); err != nil {
+			t.Errorf("VerifyConsistency(%d, %d): %v", tt.first, tt.second, err)
+		}
+		// Подменённый старый корень не проходит
+		if tt.first != tt.second {
+			forged := LeafHash([]byte("forged root"))
+			if err := VerifyConsistency(tt.first, tt.second, forged, secondRoot, want); !errors.Is(err, ErrInvalidProof) {
+				t.Errorf("VerifyConsistency(%d, %d) with a forged root = %v, want ErrInvalidProof", tt.first, tt.second, err)
+			}
+		}
+	}
+}
+
+func TestConsistencyProofAllSizes(t *testing.T) {
+	tree := rfc6962Tree(t)
+	for second := uint64(1); second <= uint64(len(rfc6962Leaves)); second++ {
+		secondRoot := mustHex(t, rfc6962Roots[second-1])
+		for first := uint64(1); first <= second; first++ {
+			firstRoot := mustHex(t, rfc6962Roots[first-1])
+			proof, err := tree.ConsistencyProof(first, second)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d): %v", first, second, err)
+			}
+			if err := VerifyConsistency(first, second, firstRoot, secondRoot, proof); err != nil {
+				t.Errorf("VerifyConsistency(%d, %d): %v", first, second, err)
+			}
+		}
+	}
+
+	if err := VerifyConsistency(0, 8, nil, mustHex(t, rfc6962Roots[7]), nil); err != nil {
+		t.Errorf("VerifyConsistency(0, 8): %v", err)
+	}
+	if err := VerifyConsistency(3, 8, mustHex(t, rfc6962Roots[2]), mustHex(t, rfc6962Roots[7]), nil); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("VerifyConsistency(3, 8) with an empty proof = %v, want ErrInvalidProof", err)
+	}
+	if _, err := tree.ConsistencyProof(5, 4); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("ConsistencyProof(5, 4) error = %v, want ErrIndexOutOfRange", err)
+	}
+}
+
+// TestMemoizedSubtrees сверяет корни большого дерева (с кэшем полных поддеревьев)
+// с деревом, которое строится заново для каждого размера
+func TestMemoizedSubtrees(t *testing.T) {
+	tree := NewTree()
+	for i := 0; i < 100; i++ {
+		tree.Append(LeafHash([]byte{byte(i)}))
+	}
+	for size := uint64(1); size <= 100; size++ {
+		got, err := tree.Root(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fresh := NewTree()
+		for i := uint64(0); i < size; i++ {
+			fresh.Append(LeafHash([]byte{byte(i)}))
+		}
+		want := fresh.subtreeNoMemo(0, size)
+		if !bytes.Equal(got, want) {
+			t.Errorf("Root(%d) = %x, want %x", size, got, want)
+		}
+	}
+
+	tree.Truncate(40)
+	tree.Append(LeafHash([]byte("replaced")))
+	got, _ := tree.Root(41)
+	fresh := NewTree()
+	for i := 0; i < 40; i++ {
+		fresh.Append(LeafHash([]byte{byte(i)}))
+	}
+	fresh.Append(LeafHash([]byte("replaced")))
+	if want := fresh.subtreeNoMemo(0, 41); !bytes.Equal(got, want) {
+		t.Errorf("Root(41) after Truncate = %x, want %x", got, want)
+	}
+}
+
+// subtreeNoMemo — MTH(D[lo:hi]) без кэша, прямо по определению из RFC 6962
+func (t *Tree) subtreeNoMemo(lo, hi uint64) []byte {
+	if hi-lo == 1 {
+		return t.leaves[lo]
+	}
+	k := split(hi - lo)
+	return nodeHash(t.subtreeNoMemo(lo, lo+k), t.subtreeNoMemo(lo+k, hi))
+}
+
+func equalProofs(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}